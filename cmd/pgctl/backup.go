@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"pg-management-system/internal/backup"
+	"pg-management-system/internal/blob"
+	"pg-management-system/internal/database"
+)
+
+func runBackup(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	out := fs.String("o", "", "archive to write (default: pgms-<timestamp>.pgbak)")
+	exclude := fs.String("exclude", strings.Join(backup.DefaultExclude, ","), "comma-separated tables to leave out")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: pgctl backup [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	path := *out
+	if path == "" {
+		path = "pgms-" + time.Now().Format("20060102-150405") + ".pgbak"
+	}
+
+	if err := database.Connect(); err != nil {
+		return err
+	}
+	store, err := blob.FromEnv()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	manifest, err := backup.Create(ctx, f, splitList(*exclude), store)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	for _, t := range manifest.Tables {
+		if t.Files > 0 {
+			fmt.Printf("%-20s %d rows, %d files\n", t.Name, t.Rows, t.Files)
+		} else {
+			fmt.Printf("%-20s %d rows\n", t.Name, t.Rows)
+		}
+	}
+	fmt.Printf("wrote %s\n", path)
+	return nil
+}
+
+func runRestore(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: pgctl restore <archive>")
+		fmt.Fprintln(fs.Output(), "The target database must be empty; the schema is created if missing.")
+		fmt.Fprintln(fs.Output(), "Document files are put into the blob store configured by BLOB_STORE.")
+		fmt.Fprintln(fs.Output(), "Personal data stays encrypted: use the PII_KEYS and PII_INDEX_KEY of the server that made the backup.")
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected an archive")
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	if err := database.Connect(); err != nil {
+		return err
+	}
+	database.InitSchema()
+	store, err := blob.FromEnv()
+	if err != nil {
+		return err
+	}
+
+	restored, err := backup.Restore(ctx, f, info.Size(), store)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(restored))
+	for name := range restored {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%-20s %d rows\n", name, restored[name])
+	}
+	return nil
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"pg-management-system/internal/database"
+	"pg-management-system/internal/importer"
+)
+
+func runImport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "validate and report without saving anything")
+	partial := fs.Bool("partial", false, "save valid rows even if some rows fail")
+	format := fs.String("format", "", "csv or xlsx (default: from file extension)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: pgctl import [flags] rooms|guests <file>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("expected an entity kind and a file")
+	}
+	kind, path := fs.Arg(0), fs.Arg(1)
+
+	fileFormat, err := importer.DetectFormat(*format, path, "")
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	table, err := importer.ReadTable(f, fileFormat)
+	if err != nil {
+		return err
+	}
+
+	if err := database.Connect(); err != nil {
+		return err
+	}
+	report, err := importer.Run(ctx, table, importer.Options{Kind: kind, DryRun: *dryRun, Partial: *partial})
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	if report.Failed > 0 && !report.DryRun {
+		return fmt.Errorf("%d of %d rows failed", report.Failed, report.Total)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"pg-management-system/internal/database"
+)
+
+func runInvoices(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("invoices", flag.ExitOnError)
+	month := fs.String("month", time.Now().Format("2006-01"), "billing month as YYYY-MM")
+	format := fs.String("format", "json", "json or csv")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: pgctl invoices [flags]")
+		fmt.Fprintln(fs.Output(), "Prints one invoice per active guest: room rent, payments in the month and balance due.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	period, err := time.Parse("2006-01", *month)
+	if err != nil {
+		return fmt.Errorf("invalid -month %q, expected YYYY-MM", *month)
+	}
+	if *format != "json" && *format != "csv" {
+		return fmt.Errorf("unknown -format %q", *format)
+	}
+
+	if err := database.Connect(); err != nil {
+		return err
+	}
+	invoices, err := database.GetMonthlyInvoices(ctx, period)
+	if err != nil {
+		return err
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(invoices)
+	}
+
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"number", "guest_id", "guest_name", "guest_email", "room_number", "period_start", "period_end", "rent", "paid", "balance"})
+	for _, inv := range invoices {
+		w.Write([]string{
+			inv.Number,
+			strconv.Itoa(inv.GuestID),
+			inv.GuestName,
+			inv.GuestEmail,
+			inv.RoomNumber,
+			inv.PeriodStart.Format("2006-01-02"),
+			inv.PeriodEnd.Format("2006-01-02"),
+			strconv.FormatFloat(inv.Rent, 'f', 2, 64),
+			strconv.FormatFloat(inv.Paid, 'f', 2, 64),
+			strconv.FormatFloat(inv.Balance, 'f', 2, 64),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
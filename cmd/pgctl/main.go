@@ -0,0 +1,80 @@
+// Command pgctl runs administrative tasks against the PG Management System database.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"pg-management-system/internal/database"
+
+	"github.com/joho/godotenv"
+)
+
+type command struct {
+	summary string
+	run     func(ctx context.Context, args []string) error
+}
+
+var commands = map[string]command{
+	"import":   {"import rooms or guests from a CSV/XLSX file", runImport},
+	"backup":   {"write every table to a compressed archive", runBackup},
+	"restore":  {"load a backup archive into an empty database", runRestore},
+	"user":     {"create users or change their role", runUser},
+	"migrate":  {"create tables and apply schema migrations", runMigrate},
+	"seed":     {"load demo data into an empty database", runSeed},
+	"invoices": {"print monthly rent invoices for active guests", runInvoices},
+	"token":    {"issue a short-lived JWT for scripting", runToken},
+	"queries":  {"allowlist GraphQL operations for persisted queries", runQueries},
+	"pii":      {"report on or rotate the keys encrypting personal data", runPII},
+}
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+
+	loadEnv()
+	if err := cmd.run(cliContext(), os.Args[2:]); err != nil {
+		log.Fatalf("pgctl %s: %v", os.Args[1], err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: pgctl <command> [flags] [args]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintln(os.Stderr, "\nRun 'pgctl <command> -h' for command flags.")
+}
+
+func loadEnv() {
+	if err := godotenv.Load(); err != nil {
+		godotenv.Load("../../.env")
+	}
+}
+
+// cliContext attributes CLI changes in the audit log
+func cliContext() context.Context {
+	actor := database.Actor{Email: "pgctl", IP: "local"}
+	if user := os.Getenv("USER"); user != "" {
+		actor.Email = "pgctl:" + user
+	}
+	return database.WithActor(context.Background(), actor)
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"pg-management-system/internal/database"
+)
+
+func runMigrate(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: pgctl migrate")
+		fmt.Fprintln(fs.Output(), "Creates missing tables and applies schema migrations, as the server does on startup.")
+	}
+	fs.Parse(args)
+
+	if err := database.Connect(); err != nil {
+		return err
+	}
+	database.InitSchema()
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"pg-management-system/internal/database"
+	"pg-management-system/internal/pii"
+)
+
+func runPII(ctx context.Context, args []string) error {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, "Usage: pgctl pii status")
+		fmt.Fprintln(os.Stderr, "       pgctl pii rotate")
+		fmt.Fprintln(os.Stderr, "       pgctl pii keygen")
+	}
+	if len(args) == 0 {
+		usage()
+		return errors.New("expected a subcommand")
+	}
+
+	switch args[0] {
+	case "status":
+		return runPIIStatus(ctx, args[1:])
+	case "rotate":
+		return runPIIRotate(ctx, args[1:])
+	case "keygen":
+		return runPIIKeygen(args[1:])
+	}
+	usage()
+	return fmt.Errorf("unknown pii subcommand %q", args[0])
+}
+
+func runPIIStatus(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("pii status", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: pgctl pii status")
+		fmt.Fprintln(fs.Output(), "Counts the encrypted values of each column by the master key they are wrapped with.")
+	}
+	fs.Parse(args)
+
+	ring, err := pii.Default()
+	if err != nil {
+		return err
+	}
+	if err := database.Connect(); err != nil {
+		return err
+	}
+	usage, err := database.GetPIIKeyUsage(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "COLUMN\tKEY\tVALUES")
+	for _, u := range usage {
+		key := u.Key
+		if key == ring.ActiveKey() {
+			key += " (active)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\n", u.Column, key, u.Values)
+	}
+	return w.Flush()
+}
+
+func runPIIRotate(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("pii rotate", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: pgctl pii rotate")
+		fmt.Fprintln(fs.Output(), "Rewraps every value with the active key, the first in PII_KEYS, and encrypts any")
+		fmt.Fprintln(fs.Output(), "plaintext left. Older keys can be dropped from PII_KEYS once status shows them unused.")
+	}
+	fs.Parse(args)
+
+	ring, err := pii.Default()
+	if err != nil {
+		return err
+	}
+	if err := database.Connect(); err != nil {
+		return err
+	}
+	n, err := database.ProtectPII(ctx, true)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("rewrapped %d value(s) with key %s\n", n, ring.ActiveKey())
+	return nil
+}
+
+func runPIIKeygen(args []string) error {
+	fs := flag.NewFlagSet("pii keygen", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: pgctl pii keygen")
+		fmt.Fprintln(fs.Output(), "Prints a random 32-byte key in base64, for PII_KEYS or PII_INDEX_KEY.")
+	}
+	fs.Parse(args)
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	fmt.Println(base64.StdEncoding.EncodeToString(key))
+	return nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"pg-management-system/internal/database"
+	"pg-management-system/internal/gql"
+	"pg-management-system/internal/models"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+func runQueries(ctx context.Context, args []string) error {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, "Usage: pgctl queries register <file.graphql|manifest.json>...")
+		fmt.Fprintln(os.Stderr, "       pgctl queries list [-all]")
+		fmt.Fprintln(os.Stderr, "       pgctl queries remove <hash>")
+	}
+	if len(args) == 0 {
+		usage()
+		return errors.New("expected a subcommand")
+	}
+
+	switch args[0] {
+	case "register":
+		return runQueriesRegister(ctx, args[1:])
+	case "list":
+		return runQueriesList(ctx, args[1:])
+	case "remove":
+		return runQueriesRemove(ctx, args[1:])
+	}
+	usage()
+	return fmt.Errorf("unknown queries subcommand %q", args[0])
+}
+
+// persistedManifest is the Apollo persisted query manifest format, as written by
+// @apollo/generate-persisted-query-manifest
+type persistedManifest struct {
+	Format     string `json:"format"`
+	Version    int    `json:"version"`
+	Operations []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+		Body string `json:"body"`
+	} `json:"operations"`
+}
+
+func runQueriesRegister(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("queries register", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: pgctl queries register <file.graphql|manifest.json>...")
+		fmt.Fprintln(fs.Output(), "Allowlists operations. A .graphql file is one document, hashed byte for byte;")
+		fmt.Fprintln(fs.Output(), "a .json file is an Apollo persisted query manifest.")
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("expected at least one file")
+	}
+
+	// Check every file before writing anything
+	var queries []*models.PersistedQuery
+	for _, path := range fs.Args() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if strings.EqualFold(filepath.Ext(path), ".json") {
+			var m persistedManifest
+			if err := json.Unmarshal(data, &m); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			if m.Format != "apollo-persisted-query-manifest" || m.Version != 1 {
+				return fmt.Errorf("%s: not an apollo-persisted-query-manifest version 1", path)
+			}
+			for _, op := range m.Operations {
+				q, err := persistedQuery(op.Body)
+				if err != nil {
+					return fmt.Errorf("%s: operation %s: %w", path, op.Name, err)
+				}
+				if op.ID != q.Hash {
+					return fmt.Errorf("%s: operation %s: id %s is not the SHA-256 of its body", path, op.Name, op.ID)
+				}
+				queries = append(queries, q)
+			}
+			continue
+		}
+		q, err := persistedQuery(string(data))
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		queries = append(queries, q)
+	}
+
+	if err := database.Connect(); err != nil {
+		return err
+	}
+	for _, q := range queries {
+		if err := database.SavePersistedQuery(ctx, q); err != nil {
+			return err
+		}
+		fmt.Printf("%s %s\n", q.Hash, q.OperationName)
+	}
+	fmt.Fprintf(os.Stderr, "registered %d operation(s); running servers pick them up on first use\n", len(queries))
+	return nil
+}
+
+// persistedQuery checks the document against the schema and names it after its first operation
+func persistedQuery(query string) (*models.PersistedQuery, error) {
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(query)})})
+	if err != nil {
+		return nil, err
+	}
+	if result := graphql.ValidateDocument(&gql.Schema, doc, nil); !result.IsValid {
+		return nil, errors.New(result.Errors[0].Message)
+	}
+
+	q := &models.PersistedQuery{Hash: gql.QueryHash(query), Query: query, Allowlisted: true}
+	for _, def := range doc.Definitions {
+		if op, ok := def.(*ast.OperationDefinition); ok && op.Name != nil {
+			q.OperationName = op.Name.Value
+			break
+		}
+	}
+	return q, nil
+}
+
+func runQueriesList(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("queries list", flag.ExitOnError)
+	all := fs.Bool("all", false, "include queries registered automatically by clients")
+	fs.Parse(args)
+
+	if err := database.Connect(); err != nil {
+		return err
+	}
+	queries, err := database.GetPersistedQueries(ctx, !*all)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "HASH\tOPERATION\tALLOWLISTED\tCREATED")
+	for _, q := range queries {
+		fmt.Fprintf(w, "%s\t%s\t%v\t%s\n", q.Hash, q.OperationName, q.Allowlisted, q.CreatedAt.Format("2006-01-02 15:04"))
+	}
+	return w.Flush()
+}
+
+func runQueriesRemove(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("queries remove", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected a hash")
+	}
+
+	if err := database.Connect(); err != nil {
+		return err
+	}
+	if err := database.DeletePersistedQuery(ctx, fs.Arg(0)); err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("no persisted query %s", fs.Arg(0))
+		}
+		return err
+	}
+	fmt.Println("removed; restart servers to drop it from their caches")
+	return nil
+}
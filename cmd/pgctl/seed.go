@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"pg-management-system/internal/database"
+	"pg-management-system/internal/seed"
+)
+
+func runSeed(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ExitOnError)
+	seedValue := fs.Uint64("seed", seed.DefaultSeed, "random seed; the same seed always gives the same data")
+	properties := fs.Int("properties", seed.DefaultProperties, "number of properties (at most 6)")
+	rooms := fs.Int("rooms", seed.DefaultRoomsPerProperty, "rooms per property")
+	until := fs.String("until", seed.DefaultUntil.Format("2006-01-02"), "end of the generated year of history")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: pgctl seed [flags]")
+		fmt.Fprintln(fs.Output(), "Generates demo rooms, guests and a year of payments into an empty database.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	end, err := time.Parse("2006-01-02", *until)
+	if err != nil {
+		return fmt.Errorf("invalid -until %q, expected YYYY-MM-DD", *until)
+	}
+
+	if err := database.Connect(); err != nil {
+		return err
+	}
+	database.InitSchema()
+
+	counts, err := seed.Run(ctx, seed.Options{
+		Seed:             *seedValue,
+		Properties:       *properties,
+		RoomsPerProperty: *rooms,
+		Until:            end,
+	})
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(os.Stdout).Encode(counts)
+}
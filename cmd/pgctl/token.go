@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"pg-management-system/internal/database"
+	"pg-management-system/internal/handlers"
+)
+
+// maxTokenTTL keeps scripting tokens short-lived
+const maxTokenTTL = 24 * time.Hour
+
+func runToken(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("token", flag.ExitOnError)
+	ttl := fs.Duration("ttl", 15*time.Minute, "token lifetime (at most 24h)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: pgctl token [-ttl 15m] <email>")
+		fmt.Fprintln(fs.Output(), "Prints a JWT for an existing user, with their current role.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected an email")
+	}
+	if *ttl <= 0 || *ttl > maxTokenTTL {
+		return fmt.Errorf("-ttl must be between 0 and %v", maxTokenTTL)
+	}
+	if os.Getenv("JWT_SECRET") == "" {
+		return errors.New("JWT_SECRET is not set")
+	}
+
+	if err := database.Connect(); err != nil {
+		return err
+	}
+	user, err := database.GetUserByEmail(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return fmt.Errorf("no user with email %s", fs.Arg(0))
+	}
+
+	token, err := handlers.GenerateTokenWithTTL(user.ID, user.Email, user.Name, user.Role, *ttl)
+	if err != nil {
+		return err
+	}
+	fmt.Println(token)
+	return nil
+}
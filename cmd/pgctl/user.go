@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"pg-management-system/internal/database"
+	"pg-management-system/internal/models"
+)
+
+// roles accepted by the RBAC middleware
+var roles = map[string]bool{"admin": true, "staff": true, "user": true}
+
+func runUser(ctx context.Context, args []string) error {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, "Usage: pgctl user create -email <email> [-name <name>] [-role user|staff|admin]")
+		fmt.Fprintln(os.Stderr, "       pgctl user promote [-role admin] <email>")
+	}
+	if len(args) == 0 {
+		usage()
+		return errors.New("expected a subcommand")
+	}
+
+	switch args[0] {
+	case "create":
+		return runUserCreate(ctx, args[1:])
+	case "promote":
+		return runUserPromote(ctx, args[1:])
+	}
+	usage()
+	return fmt.Errorf("unknown user subcommand %q", args[0])
+}
+
+func runUserCreate(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("user create", flag.ExitOnError)
+	email := fs.String("email", "", "email address (required)")
+	name := fs.String("name", "", "display name")
+	role := fs.String("role", "user", "user, staff or admin")
+	fs.Parse(args)
+	if *email == "" {
+		fs.Usage()
+		return errors.New("-email is required")
+	}
+	if !roles[*role] {
+		return fmt.Errorf("unknown role %q", *role)
+	}
+
+	if err := database.Connect(); err != nil {
+		return err
+	}
+	existing, err := database.GetUserByEmail(ctx, *email)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("user %s already exists; use 'pgctl user promote' to change their role", *email)
+	}
+
+	user := &models.User{Email: *email, Name: *name, Role: *role}
+	if err := database.CreateUser(ctx, user); err != nil {
+		return err
+	}
+	return json.NewEncoder(os.Stdout).Encode(user)
+}
+
+func runUserPromote(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("user promote", flag.ExitOnError)
+	role := fs.String("role", "admin", "role to grant")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected an email")
+	}
+	if !roles[*role] {
+		return fmt.Errorf("unknown role %q", *role)
+	}
+
+	if err := database.Connect(); err != nil {
+		return err
+	}
+	if err := database.SetUserRole(ctx, fs.Arg(0), *role); err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("no user with email %s", fs.Arg(0))
+		}
+		return err
+	}
+	fmt.Printf("%s is now %s; existing tokens keep their old role until they expire\n", fs.Arg(0), *role)
+	return nil
+}
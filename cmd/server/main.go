@@ -1,19 +1,22 @@
 package main
 
 import (
+	"context"
+	"expvar"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"pg-management-system/internal/database"
+	"pg-management-system/internal/documents"
 	"pg-management-system/internal/gql"
-	"pg-management-system/internal/handlers"
 	"pg-management-system/internal/middleware"
+	"pg-management-system/internal/pii"
 
 	"net/http/pprof"
 
-	"github.com/graphql-go/handler"
 	"github.com/rs/cors"
 
 	"github.com/gorilla/mux"
@@ -28,57 +31,20 @@ func main() {
 		}
 	}
 
-	database.Connect()
+	if _, err := pii.Default(); err != nil {
+		log.Fatal("Personal data encryption unavailable: ", err)
+	}
+	if err := database.Connect(); err != nil {
+		log.Fatal("Database unavailable: ", err)
+	}
 	database.InitSchema()
+	if err := documents.Init(); err != nil {
+		log.Fatal("Document storage unavailable: ", err)
+	}
+	database.StartPurgeJob(context.Background(), envDuration("SOFT_DELETE_RETENTION", 90*24*time.Hour), envDuration("PURGE_INTERVAL", 24*time.Hour))
 
-	r := mux.NewRouter()
-
-	r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("PG Management System is running"))
-	}).Methods("GET")
-
-	// Auth Routes
-	r.HandleFunc("/auth/google/login", handlers.GoogleLogin).Methods("GET")
-	r.HandleFunc("/auth/google/callback", handlers.GoogleCallback).Methods("GET")
-
-	// Protected API Routes
-	api := r.PathPrefix("/api").Subrouter()
-	api.Use(middleware.AuthMiddleware)
-
-	// Room Routes
-	api.HandleFunc("/rooms", handlers.CreateRoom).Methods("POST")
-	api.HandleFunc("/rooms", handlers.GetAllRooms).Methods("GET")
-	api.HandleFunc("/rooms/{id}", handlers.GetRoomByID).Methods("GET")
-
-	adminOnly := api.PathPrefix("").Subrouter()
-	adminOnly.Use(middleware.RBAC("admin"))
-
-	adminOnly.HandleFunc("/rooms/{id}", handlers.UpdateRoom).Methods("PUT")
-	adminOnly.HandleFunc("/rooms/{id}", handlers.DeleteRoom).Methods("DELETE")
-
-	// Guest Routes
-	api.HandleFunc("/guests", handlers.CreateGuest).Methods("POST")
-	api.HandleFunc("/guests", handlers.GetAllGuests).Methods("GET")
-	api.HandleFunc("/guests/{id}", handlers.GetGuestByID).Methods("GET")
-	adminOnly.HandleFunc("/guests/{id}", handlers.UpdateGuest).Methods("PUT")
-	adminOnly.HandleFunc("/guests/{id}", handlers.DeleteGuest).Methods("DELETE")
-
-	// Payment Routes
-	api.HandleFunc("/payments", handlers.CreatePayment).Methods("POST")
-	api.HandleFunc("/payments", handlers.GetAllPayments).Methods("GET")
-	api.HandleFunc("/payments/{id}", handlers.GetPaymentByID).Methods("GET")
-	adminOnly.HandleFunc("/payments/{id}", handlers.UpdatePayment).Methods("PUT")
-	adminOnly.HandleFunc("/payments/{id}", handlers.DeletePayment).Methods("DELETE")
-	api.HandleFunc("/payments/guest/{id}", handlers.GetPaymentsByGuestID).Methods("GET")
-
-	// GraphQL Route (Protected)
-	h := handler.New(&handler.Config{
-		Schema:   &gql.Schema,
-		Pretty:   true,
-		GraphiQL: true,
-	})
-	api.Handle("/graphql", h)
+	limits := gql.LimitsFromEnv()
+	r := newRouter(limits, gql.QueryStoreFromEnv())
 
 	// Profiling Routes
 	r.HandleFunc("/debug/pprof/", pprof.Index)
@@ -93,6 +59,9 @@ func main() {
 	r.Handle("/debug/pprof/mutex", pprof.Handler("mutex"))
 	r.Handle("/debug/pprof/threadcreate", pprof.Handler("threadcreate"))
 
+	// Runtime and connection pool metrics
+	r.Handle("/debug/vars", expvar.Handler())
+
 	// Print all registered routes
 	r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
 		path, err := route.GetPathTemplate()
@@ -114,8 +83,9 @@ func main() {
 	// Enable CORS
 	c := cors.New(cors.Options{
 		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", "If-Match", middleware.ReadYourWritesHeader},
+		ExposedHeaders:   []string{"ETag", "Content-Disposition"},
 		AllowCredentials: true,
 	})
 
@@ -126,3 +96,12 @@ func main() {
 		log.Fatal("ListenAndServe error: ", err)
 	}
 }
+
+// envDuration reads a duration such as "720h" from the environment
+func envDuration(key string, fallback time.Duration) time.Duration {
+	v, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || v <= 0 {
+		return fallback
+	}
+	return v
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"pg-management-system/internal/database"
+	"pg-management-system/internal/gql"
+	"pg-management-system/internal/handlers"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	_ "github.com/lib/pq"
+)
+
+var roles = []string{"admin", "staff", "user"}
+
+// accessRules pairs each REST route with the GraphQL operations that do the same
+// thing, and the roles allowed to use both. A nil roles list means any signed-in
+// user. Every route and every root field must appear here.
+var accessRules = []struct {
+	name  string
+	roles []string
+	rest  []string
+	gql   []string
+}{
+	{
+		name: "read rooms",
+		rest: []string{"GET /api/rooms", "GET /api/rooms/{id}"},
+		gql: []string{
+			`{ rooms { id } }`,
+			`{ room(id: 1) { id } }`,
+		},
+	},
+	{
+		name:  "write rooms",
+		roles: []string{"admin"},
+		rest:  []string{"POST /api/rooms", "PUT /api/rooms/{id}", "PATCH /api/rooms/{id}", "DELETE /api/rooms/{id}", "POST /api/rooms/{id}/restore"},
+		gql: []string{
+			`mutation { createRoom(input: {room_number: "R1", capacity: 1, price: "100.00"}) { room { id } } }`,
+			`mutation { updateRoom(input: {id: 1, room_number: "R1", capacity: 1, price: "100.00"}) { room { id } } }`,
+			`mutation { deleteRoom(id: 1) { deleted } }`,
+			`mutation { restoreRoom(id: 1) { room { id } } }`,
+		},
+	},
+	{
+		name: "read guests",
+		rest: []string{"GET /api/guests", "GET /api/guests/{id}"},
+		gql: []string{
+			`{ guests { id } }`,
+			`{ guest(id: 1) { id } }`,
+		},
+	},
+	{
+		name:  "write guests",
+		roles: []string{"admin"},
+		rest:  []string{"POST /api/guests", "PUT /api/guests/{id}", "PATCH /api/guests/{id}", "DELETE /api/guests/{id}", "POST /api/guests/{id}/restore"},
+		gql: []string{
+			`mutation { createGuest(input: {name: "A", email: "a@example.com", room_id: 1}) { guest { id } } }`,
+			`mutation { updateGuest(input: {id: 1, name: "A", email: "a@example.com", room_id: 1}) { guest { id } } }`,
+			`mutation { deleteGuest(id: 1) { deleted } }`,
+			`mutation { restoreGuest(id: 1) { guest { id } } }`,
+		},
+	},
+	{
+		name: "read payments",
+		rest: []string{"GET /api/payments", "GET /api/payments/{id}", "GET /api/payments/guest/{id}"},
+		gql: []string{
+			`{ allPayments { id } }`,
+			`{ payment(id: 1) { id } }`,
+			`{ payments(guest_id: 1) { id } }`,
+		},
+	},
+	{
+		name:  "write payments",
+		roles: []string{"admin"},
+		rest:  []string{"POST /api/payments", "PUT /api/payments/{id}", "PATCH /api/payments/{id}", "DELETE /api/payments/{id}", "POST /api/payments/{id}/restore"},
+		gql: []string{
+			`mutation { createPayment(input: {guest_id: 1, amount: "100.00", payment_method: "cash"}) { payment { id } } }`,
+			`mutation { updatePayment(input: {id: 1, guest_id: 1, amount: "100.00", payment_method: "cash"}) { payment { id } } }`,
+			`mutation { deletePayment(id: 1) { deleted } }`,
+			`mutation { restorePayment(id: 1) { payment { id } } }`,
+		},
+	},
+	{
+		name:  "read and upload documents",
+		roles: []string{"admin", "staff"},
+		rest:  []string{"POST /api/guests/{id}/documents", "GET /api/guests/{id}/documents", "GET /api/documents", "GET /api/documents/{id}", "GET /api/documents/{id}/file"},
+		gql: []string{
+			`{ document(id: 1) { id } }`,
+			`{ documents(guest_id: 1) { id } }`,
+			`mutation ($file: Upload!) { uploadGuestDocument(input: {guest_id: 1, type: "passport", file: $file}) { document { id } } }`,
+		},
+	},
+	{
+		name:  "review documents",
+		roles: []string{"admin"},
+		rest:  []string{"PUT /api/documents/{id}/review", "DELETE /api/documents/{id}"},
+		gql: []string{
+			`mutation { reviewGuestDocument(input: {id: 1, status: "verified"}) { document { id } } }`,
+			`mutation { deleteGuestDocument(id: 1) { deleted } }`,
+		},
+	},
+	{
+		name:  "import and export",
+		roles: []string{"admin"},
+		rest:  []string{"POST /api/import/{kind}", "GET /api/export/{kind}"},
+	},
+	{
+		name:  "audit log",
+		roles: []string{"admin"},
+		rest:  []string{"GET /api/audit"},
+		gql:   []string{`{ auditLog { id } }`},
+	},
+	{
+		name: "subscriptions",
+		gql: []string{
+			`subscription { roomOccupancyChanged { id } }`,
+			`subscription { paymentReceived { id } }`,
+			`subscription { guestCheckedIn { id } }`,
+		},
+	},
+}
+
+func allowed(ruleRoles []string, role string) bool {
+	if role == "" {
+		return false
+	}
+	if ruleRoles == nil {
+		return true
+	}
+	for _, r := range ruleRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// newTestServer serves the API against a database that refuses connections, so
+// requests that pass the access checks fail later instead of touching data
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	t.Setenv("JWT_SECRET", "test-secret")
+
+	db, err := sql.Open("postgres", "host=127.0.0.1 port=1 sslmode=disable connect_timeout=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = prev
+		db.Close()
+	})
+
+	limits := gql.LimitsFromEnv()
+	limits.Production = true
+	srv := httptest.NewServer(newRouter(limits, gql.NewQueryStore(false)))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func tokenFor(t *testing.T, role string) string {
+	t.Helper()
+	if role == "" {
+		return ""
+	}
+	token, err := handlers.GenerateTokenWithTTL(1, role+"@example.com", role, role, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestEveryRouteAndFieldHasAnAccessRule(t *testing.T) {
+	listed := map[string]bool{}
+	fields := map[string]bool{}
+	for _, rule := range accessRules {
+		for _, route := range rule.rest {
+			if listed[route] {
+				t.Errorf("%s is listed twice", route)
+			}
+			listed[route] = true
+		}
+		for _, op := range rule.gql {
+			fields[rootField(t, op)] = true
+		}
+	}
+
+	r := newRouter(gql.Limits{}, gql.NewQueryStore(false))
+	r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		methods, _ := route.GetMethods()
+		if err != nil || len(methods) == 0 || !strings.HasPrefix(path, "/api/") || strings.HasPrefix(path, "/api/graphql") {
+			return nil
+		}
+		for _, method := range methods {
+			key := method + " " + path
+			if !listed[key] {
+				t.Errorf("route %s has no access rule", key)
+			}
+			delete(listed, key)
+		}
+		return nil
+	})
+	for key := range listed {
+		t.Errorf("access rule lists %s, which is not a route", key)
+	}
+
+	var missing []string
+	for _, root := range []*graphql.Object{gql.Schema.QueryType(), gql.Schema.MutationType(), gql.Schema.SubscriptionType()} {
+		for name := range root.Fields() {
+			if !fields[root.Name()+"."+name] {
+				missing = append(missing, root.Name()+"."+name)
+			}
+		}
+	}
+	sort.Strings(missing)
+	for _, field := range missing {
+		t.Errorf("GraphQL field %s has no access rule", field)
+	}
+}
+
+// rootField names the root type and field an operation selects
+func rootField(t *testing.T, query string) string {
+	t.Helper()
+	doc, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	op := doc.Definitions[0].(*ast.OperationDefinition)
+	root := map[string]string{
+		ast.OperationTypeQuery:        "Query",
+		ast.OperationTypeMutation:     "Mutation",
+		ast.OperationTypeSubscription: "Subscription",
+	}[op.Operation]
+	return root + "." + op.SelectionSet.Selections[0].(*ast.Field).Name.Value
+}
+
+// TestRESTAndGraphQLAgreeOnAccess runs every route and operation as each role and
+// as an anonymous caller, and checks that both APIs let in exactly the rule's roles
+func TestRESTAndGraphQLAgreeOnAccess(t *testing.T) {
+	srv := newTestServer(t)
+
+	for _, rule := range accessRules {
+		for _, role := range append([]string{""}, roles...) {
+			want := allowed(rule.roles, role)
+			token := tokenFor(t, role)
+			who := role
+			if who == "" {
+				who = "anonymous"
+			}
+
+			for _, route := range rule.rest {
+				status := restStatus(t, srv, route, token)
+				got := status != http.StatusUnauthorized && status != http.StatusForbidden
+				if got != want {
+					t.Errorf("%s: %s as %s got %d, allowed=%v", rule.name, route, who, status, want)
+				}
+			}
+			for _, op := range rule.gql {
+				var got bool
+				var code string
+				if strings.HasPrefix(op, "subscription") {
+					got, code = subscriptionAllowed(t, srv, op, token)
+				} else {
+					got, code = graphqlAllowed(t, srv, op, token)
+				}
+				if got != want {
+					t.Errorf("%s: %s as %s got %q, allowed=%v", rule.name, rootField(t, op), who, code, want)
+				}
+			}
+		}
+	}
+}
+
+func restStatus(t *testing.T, srv *httptest.Server, route, token string) int {
+	t.Helper()
+	method, path, _ := strings.Cut(route, " ")
+	path = strings.NewReplacer("{id}", "1", "{kind}", "rooms").Replace(path)
+	var body *strings.Reader
+	if method == http.MethodGet || method == http.MethodDelete {
+		body = strings.NewReader("")
+	} else {
+		body = strings.NewReader("{}")
+	}
+	req, _ := http.NewRequest(method, srv.URL+path, body)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// graphqlAllowed reports whether an operation got past @auth: it was executed
+// (the response has data) and no field was refused
+func graphqlAllowed(t *testing.T, srv *httptest.Server, query, token string) (bool, string) {
+	t.Helper()
+	var req *http.Request
+	if strings.Contains(query, "Upload!") {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		operations, _ := json.Marshal(map[string]interface{}{"query": query, "variables": map[string]interface{}{"file": nil}})
+		mw.WriteField("operations", string(operations))
+		mw.WriteField("map", `{"0": ["variables.file"]}`)
+		part, _ := mw.CreateFormFile("0", "id.pdf")
+		part.Write([]byte("%PDF-1.4\n"))
+		mw.Close()
+		req, _ = http.NewRequest(http.MethodPost, srv.URL+"/api/graphql", &buf)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+	} else {
+		body, _ := json.Marshal(map[string]string{"query": query})
+		req, _ = http.NewRequest(http.MethodPost, srv.URL+"/api/graphql", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return false, resp.Status
+	}
+
+	var result struct {
+		Data   map[string]interface{} `json:"data"`
+		Errors []struct {
+			Message    string                 `json:"message"`
+			Extensions map[string]interface{} `json:"extensions"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	for _, e := range result.Errors {
+		if code, _ := e.Extensions["code"].(string); code == "FORBIDDEN" || code == "UNAUTHENTICATED" {
+			return false, code
+		}
+	}
+	if result.Data == nil {
+		t.Fatalf("%s was not executed: %+v", query, result.Errors)
+	}
+	return true, ""
+}
+
+// subscriptionAllowed starts a subscription over the WebSocket route. A refused
+// subscription ends with an error; an allowed one stays open waiting for events.
+func subscriptionAllowed(t *testing.T, srv *httptest.Server, query, token string) (bool, string) {
+	t.Helper()
+	dialer := websocket.Dialer{Subprotocols: []string{"graphql-transport-ws"}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/api/graphql/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	type message struct {
+		ID      string          `json:"id,omitempty"`
+		Type    string          `json:"type"`
+		Payload json.RawMessage `json:"payload,omitempty"`
+	}
+	init, _ := json.Marshal(map[string]string{"Authorization": "Bearer " + token})
+	conn.WriteJSON(message{Type: "connection_init", Payload: init})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var ack message
+	if err := conn.ReadJSON(&ack); err != nil {
+		if ce, ok := err.(*websocket.CloseError); ok {
+			return false, ce.Text
+		}
+		t.Fatal(err)
+	}
+
+	payload, _ := json.Marshal(map[string]string{"query": query})
+	conn.WriteJSON(message{ID: "1", Type: "subscribe", Payload: payload})
+	conn.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+	var msg message
+	if err := conn.ReadJSON(&msg); err != nil {
+		if ne, ok := err.(interface{ Timeout() bool }); ok && ne.Timeout() {
+			return true, ""
+		}
+		t.Fatal(err)
+	}
+	if msg.Type != "error" {
+		t.Fatalf("%s: unexpected %s message %s", query, msg.Type, msg.Payload)
+	}
+	var errs []struct {
+		Extensions map[string]interface{} `json:"extensions"`
+	}
+	json.Unmarshal(msg.Payload, &errs)
+	for _, e := range errs {
+		if code, _ := e.Extensions["code"].(string); code == "FORBIDDEN" || code == "UNAUTHENTICATED" {
+			return false, code
+		}
+	}
+	t.Fatalf("%s failed: %s", query, msg.Payload)
+	return false, ""
+}
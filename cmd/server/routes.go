@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+
+	"pg-management-system/internal/gql"
+	"pg-management-system/internal/handlers"
+	"pg-management-system/internal/middleware"
+
+	"github.com/gorilla/mux"
+	"github.com/graphql-go/handler"
+)
+
+// newRouter registers the health check, auth, REST and GraphQL routes. Which
+// roles may use each is checked against GraphQL by rbac_test.go.
+func newRouter(limits gql.Limits, persisted *gql.QueryStore) *mux.Router {
+	r := mux.NewRouter()
+
+	r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("PG Management System is running"))
+	}).Methods("GET")
+
+	// Auth Routes
+	r.HandleFunc("/auth/google/login", handlers.GoogleLogin).Methods("GET")
+	r.HandleFunc("/auth/google/callback", handlers.GoogleCallback).Methods("GET")
+
+	// GraphQL subscriptions authenticate inside the WebSocket, since browsers cannot
+	// set headers on the handshake; registered before /api so AuthMiddleware skips it
+	r.Handle("/api/graphql/ws", gql.SubscriptionHandler(limits, persisted)).Methods("GET")
+
+	// Protected API Routes
+	api := r.PathPrefix("/api").Subrouter()
+	api.Use(middleware.AuthMiddleware)
+	api.Use(middleware.ReadYourWrites)
+	api.Use(middleware.AuditActor)
+
+	// Reads are open to every signed-in user and writes need an admin; guests' ID
+	// documents are for staff only. Keep in step with the @auth directives in
+	// internal/gql/schema.graphql.
+	adminOnly := api.PathPrefix("").Subrouter()
+	adminOnly.Use(middleware.RBAC("admin"))
+	staffOnly := api.PathPrefix("").Subrouter()
+	staffOnly.Use(middleware.RBAC("admin", "staff"))
+
+	// Room Routes
+	adminOnly.HandleFunc("/rooms", handlers.CreateRoom).Methods("POST")
+	api.HandleFunc("/rooms", handlers.GetAllRooms).Methods("GET")
+	api.HandleFunc("/rooms/{id}", handlers.GetRoomByID).Methods("GET")
+	adminOnly.HandleFunc("/rooms/{id}", handlers.UpdateRoom).Methods("PUT")
+	adminOnly.HandleFunc("/rooms/{id}", handlers.PatchRoom).Methods("PATCH")
+	adminOnly.HandleFunc("/rooms/{id}", handlers.DeleteRoom).Methods("DELETE")
+	adminOnly.HandleFunc("/rooms/{id}/restore", handlers.RestoreRoom).Methods("POST")
+
+	// Guest Routes
+	adminOnly.HandleFunc("/guests", handlers.CreateGuest).Methods("POST")
+	api.HandleFunc("/guests", handlers.GetAllGuests).Methods("GET")
+	api.HandleFunc("/guests/{id}", handlers.GetGuestByID).Methods("GET")
+	adminOnly.HandleFunc("/guests/{id}", handlers.UpdateGuest).Methods("PUT")
+	adminOnly.HandleFunc("/guests/{id}", handlers.PatchGuest).Methods("PATCH")
+	adminOnly.HandleFunc("/guests/{id}", handlers.DeleteGuest).Methods("DELETE")
+	adminOnly.HandleFunc("/guests/{id}/restore", handlers.RestoreGuest).Methods("POST")
+
+	// Payment Routes
+	adminOnly.HandleFunc("/payments", handlers.CreatePayment).Methods("POST")
+	api.HandleFunc("/payments", handlers.GetAllPayments).Methods("GET")
+	api.HandleFunc("/payments/{id}", handlers.GetPaymentByID).Methods("GET")
+	adminOnly.HandleFunc("/payments/{id}", handlers.UpdatePayment).Methods("PUT")
+	adminOnly.HandleFunc("/payments/{id}", handlers.PatchPayment).Methods("PATCH")
+	adminOnly.HandleFunc("/payments/{id}", handlers.DeletePayment).Methods("DELETE")
+	adminOnly.HandleFunc("/payments/{id}/restore", handlers.RestorePayment).Methods("POST")
+	api.HandleFunc("/payments/guest/{id}", handlers.GetPaymentsByGuestID).Methods("GET")
+
+	// Guest Document Routes
+	staffOnly.HandleFunc("/guests/{id}/documents", handlers.UploadGuestDocument).Methods("POST")
+	staffOnly.HandleFunc("/guests/{id}/documents", handlers.GetGuestDocuments).Methods("GET")
+	staffOnly.HandleFunc("/documents", handlers.GetDocuments).Methods("GET")
+	staffOnly.HandleFunc("/documents/{id}", handlers.GetDocumentByID).Methods("GET")
+	staffOnly.HandleFunc("/documents/{id}/file", handlers.DownloadDocument).Methods("GET")
+	adminOnly.HandleFunc("/documents/{id}/review", handlers.ReviewDocument).Methods("PUT")
+	adminOnly.HandleFunc("/documents/{id}", handlers.DeleteDocument).Methods("DELETE")
+
+	// Bulk Import / Export
+	adminOnly.HandleFunc("/import/{kind}", handlers.ImportData).Methods("POST")
+	adminOnly.HandleFunc("/export/{kind}", handlers.ExportData).Methods("GET")
+
+	// Audit Log
+	adminOnly.HandleFunc("/audit", handlers.GetAuditLog).Methods("GET")
+
+	// GraphQL Route (Protected)
+	h := handler.New(&handler.Config{
+		Schema:   &gql.Schema,
+		Pretty:   true,
+		GraphiQL: !limits.Production,
+	})
+	api.Handle("/graphql", gql.Uploads(limits, gql.Batch(limits,
+		gql.PersistedQueries(persisted, gql.Guard(limits, gql.WithLoaders(h))))))
+
+	return r
+}
@@ -12,6 +12,7 @@ require (
 
 require (
 	github.com/golang-jwt/jwt/v5 v5.3.1
+	github.com/gorilla/websocket v1.5.3
 	github.com/rs/cors v1.11.1
 	golang.org/x/oauth2 v0.35.0
 )
@@ -0,0 +1,516 @@
+// Package backup dumps every table of the database into a compressed archive and
+// restores it into an empty database. Tables are discovered from the catalog, so
+// new tables are included without changes here. On restore, rows get fresh serial
+// ids and foreign keys are rewritten to match.
+//
+// An archive is a zip file holding manifest.json and one tables/<name>.ndjson file
+// per table, each line being a row as produced by row_to_json. Files in the blob
+// store that rows point at, such as guests' ID documents, are kept under
+// files/<key>.
+package backup
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"pg-management-system/internal/blob"
+	"pg-management-system/internal/database"
+
+	"github.com/lib/pq"
+)
+
+// Format identifies backup archives; FormatVersion is bumped when the layout changes
+const (
+	Format        = "pgms-backup"
+	FormatVersion = 2
+)
+
+// fileColumns names the column of each table holding the blob store key of a file
+// its rows point at. Those files are archived and restored with the rows.
+var fileColumns = map[string]string{"guest_documents": "storage_key"}
+
+// DefaultExclude lists tables left out unless asked for. Audit entries point at
+// entities by plain id rather than by foreign key, so they cannot be remapped.
+var DefaultExclude = []string{"audit_log"}
+
+// ErrNotEmpty is returned when restoring into a database that already holds data
+var ErrNotEmpty = errors.New("target database is not empty")
+
+// Manifest is stored as manifest.json in every archive
+type Manifest struct {
+	Format    string      `json:"format"`
+	Version   int         `json:"version"`
+	CreatedAt time.Time   `json:"created_at"`
+	Tables    []TableInfo `json:"tables"`
+}
+
+// TableInfo records what was dumped for one table
+type TableInfo struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	Rows    int      `json:"rows"`
+	Files   int      `json:"files,omitempty"`
+}
+
+// Create writes an archive of every table except those in exclude to w, with the
+// files from store that rows point at. All tables are read from one snapshot, so
+// the archive is consistent; a file missing from store fails the backup.
+func Create(ctx context.Context, w io.Writer, exclude []string, store blob.Store) (*Manifest, error) {
+	tx, err := database.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	catalog, err := loadCatalog(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	skip := map[string]bool{}
+	for _, name := range exclude {
+		skip[name] = true
+	}
+	names := make([]string, 0, len(catalog))
+	for name := range catalog {
+		if !skip[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	zw := zip.NewWriter(w)
+	manifest := &Manifest{Format: Format, Version: FormatVersion, CreatedAt: time.Now().UTC()}
+	for _, name := range names {
+		t := catalog[name]
+		count, keys, err := dumpTable(ctx, tx, zw, t)
+		if err != nil {
+			return nil, fmt.Errorf("dump %s: %w", name, err)
+		}
+		if err := dumpFiles(ctx, zw, store, keys); err != nil {
+			return nil, fmt.Errorf("dump %s: %w", name, err)
+		}
+		manifest.Tables = append(manifest.Tables, TableInfo{Name: name, Columns: t.columns, Rows: count, Files: len(keys)})
+	}
+
+	f, err := zw.Create("manifest.json")
+	if err != nil {
+		return nil, err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		return nil, err
+	}
+	return manifest, zw.Close()
+}
+
+// dumpTable writes the rows of t and returns how many there were, with the keys
+// of the files they point at
+func dumpTable(ctx context.Context, tx *sql.Tx, zw *zip.Writer, t *table) (int, []string, error) {
+	query := `SELECT row_to_json(t) FROM ` + pq.QuoteIdentifier(t.name) + ` t`
+	if t.serialID {
+		query += ` ORDER BY id`
+	}
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+
+	f, err := zw.Create("tables/" + t.name + ".ndjson")
+	if err != nil {
+		return 0, nil, err
+	}
+	out := bufio.NewWriter(f)
+
+	count := 0
+	var keys []string
+	for rows.Next() {
+		var row []byte
+		if err := rows.Scan(&row); err != nil {
+			return 0, nil, err
+		}
+		if key, err := fileKey(t.name, row); err != nil {
+			return 0, nil, fmt.Errorf("row %d: %w", count+1, err)
+		} else if key != "" {
+			keys = append(keys, key)
+		}
+		out.Write(row)
+		if err := out.WriteByte('\n'); err != nil {
+			return 0, nil, err
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+	return count, keys, out.Flush()
+}
+
+// fileKey returns the blob store key a row of table points at, if any
+func fileKey(table string, row []byte) (string, error) {
+	column := fileColumns[table]
+	if column == "" {
+		return "", nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(row, &fields); err != nil {
+		return "", err
+	}
+	var key string
+	if raw, ok := fields[column]; ok && string(raw) != "null" {
+		if err := json.Unmarshal(raw, &key); err != nil {
+			return "", fmt.Errorf("%s: %w", column, err)
+		}
+	}
+	return key, nil
+}
+
+// dumpFiles copies the files under keys from store into the archive
+func dumpFiles(ctx context.Context, zw *zip.Writer, store blob.Store, keys []string) error {
+	if len(keys) > 0 && store == nil {
+		return errors.New("rows point at files but no blob store is configured")
+	}
+	for _, key := range keys {
+		if err := dumpFile(ctx, zw, store, key); err != nil {
+			return fmt.Errorf("file %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func dumpFile(ctx context.Context, zw *zip.Writer, store blob.Store, key string) error {
+	rc, err := store.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	f, err := zw.Create("files/" + key)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, rc)
+	return err
+}
+
+// Restore loads the archive at r into the connected database, which must already
+// have the schema (InitSchema) and no rows in any of the archived tables, and puts
+// the archived files into store. Rows whose file is not in the archive, as in
+// archives made before files were included, stop the restore. It returns the
+// number of rows restored per table.
+func Restore(ctx context.Context, r io.ReaderAt, size int64, store blob.Store) (map[string]int, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("not a backup archive: %w", err)
+	}
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	manifest, err := readManifest(files["manifest.json"])
+	if err != nil {
+		return nil, err
+	}
+
+	catalog, err := loadCatalog(ctx, database.DB)
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range manifest.Tables {
+		if catalog[info.Name] == nil {
+			return nil, fmt.Errorf("table %s from the backup does not exist; run migrations first", info.Name)
+		}
+		if files["tables/"+info.Name+".ndjson"] == nil {
+			return nil, fmt.Errorf("archive is missing rows for table %s", info.Name)
+		}
+		var exists bool
+		query := `SELECT EXISTS (SELECT 1 FROM ` + pq.QuoteIdentifier(info.Name) + `)`
+		if err := database.DB.QueryRowContext(ctx, query).Scan(&exists); err != nil {
+			return nil, err
+		}
+		if exists {
+			return nil, fmt.Errorf("%w: table %s has rows", ErrNotEmpty, info.Name)
+		}
+	}
+
+	order, err := restoreOrder(manifest, catalog)
+	if err != nil {
+		return nil, err
+	}
+
+	// Files go in first, so committed rows never point at missing files. Those
+	// added are removed again if the rows cannot be restored.
+	added, err := restoreFiles(ctx, files, manifest, store)
+	if err != nil {
+		return nil, err
+	}
+
+	var restored map[string]int
+	err = database.WithTx(ctx, func(tx *sql.Tx) error {
+		restored = map[string]int{}
+		ids := map[string]map[int64]int64{}
+		for _, info := range order {
+			count, err := restoreTable(ctx, tx, files["tables/"+info.Name+".ndjson"], info, catalog[info.Name], ids)
+			if err != nil {
+				return fmt.Errorf("restore %s: %w", info.Name, err)
+			}
+			restored[info.Name] = count
+		}
+		return nil
+	})
+	if err != nil {
+		removeFiles(store, added)
+		return nil, err
+	}
+	return restored, nil
+}
+
+// restoreFiles checks that the archive holds the file of every row that points at
+// one, then puts those missing from store. Keys are random and never reused, so a
+// file already in store is the same file. It returns the keys it added.
+func restoreFiles(ctx context.Context, files map[string]*zip.File, m *Manifest, store blob.Store) ([]string, error) {
+	var keys []string
+	for _, info := range m.Tables {
+		if fileColumns[info.Name] == "" {
+			continue
+		}
+		tableKeys, err := archivedKeys(files["tables/"+info.Name+".ndjson"], info.Name)
+		if err != nil {
+			return nil, fmt.Errorf("restore %s: %w", info.Name, err)
+		}
+		for _, key := range tableKeys {
+			if files["files/"+key] == nil {
+				return nil, fmt.Errorf("restore %s: the archive has no file %s; it was made without the files and its %s rows cannot be restored", info.Name, key, info.Name)
+			}
+		}
+		keys = append(keys, tableKeys...)
+	}
+	if len(keys) > 0 && store == nil {
+		return nil, errors.New("the archive holds files but no blob store is configured")
+	}
+
+	var added []string
+	for _, key := range keys {
+		ok, err := putFile(ctx, store, key, files["files/"+key])
+		if err != nil {
+			removeFiles(store, added)
+			return nil, fmt.Errorf("restore file %s: %w", key, err)
+		}
+		if ok {
+			added = append(added, key)
+		}
+	}
+	return added, nil
+}
+
+// archivedKeys lists the file keys of an archived table's rows
+func archivedKeys(f *zip.File, table string) ([]string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var keys []string
+	scanner := bufio.NewScanner(rc)
+	scanner.Buffer(nil, 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		key, err := fileKey(table, scanner.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", line, err)
+		}
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys, scanner.Err()
+}
+
+// putFile stores an archived file unless store already has it, reporting whether it did
+func putFile(ctx context.Context, store blob.Store, key string, f *zip.File) (bool, error) {
+	existing, err := store.Get(ctx, key)
+	if err == nil {
+		existing.Close()
+		return false, nil
+	}
+	if !errors.Is(err, blob.ErrNotFound) {
+		return false, err
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return false, err
+	}
+	defer rc.Close()
+	return true, store.Put(ctx, key, rc, int64(f.UncompressedSize64), "")
+}
+
+func removeFiles(store blob.Store, keys []string) {
+	for _, key := range keys {
+		if err := store.Delete(context.Background(), key); err != nil {
+			log.Printf("Warning: failed to remove restored file %s: %v", key, err)
+		}
+	}
+}
+
+func readManifest(f *zip.File) (*Manifest, error) {
+	if f == nil {
+		return nil, errors.New("not a backup archive: manifest.json is missing")
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var m Manifest
+	if err := json.NewDecoder(rc).Decode(&m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if m.Format != Format {
+		return nil, fmt.Errorf("not a backup archive: format %q", m.Format)
+	}
+	if m.Version > FormatVersion {
+		return nil, fmt.Errorf("backup format version %d is newer than supported version %d", m.Version, FormatVersion)
+	}
+	return &m, nil
+}
+
+// restoreOrder sorts the archived tables so every table comes after the tables it
+// references. Rows are remapped as they are inserted, so a table whose rows reference
+// other rows of the same table cannot be restored.
+func restoreOrder(m *Manifest, catalog map[string]*table) ([]TableInfo, error) {
+	pending := map[string]TableInfo{}
+	for _, info := range m.Tables {
+		for column, ref := range catalog[info.Name].refs {
+			if ref == info.Name {
+				return nil, fmt.Errorf("cannot restore table %s: its column %s references the table itself", info.Name, column)
+			}
+		}
+		pending[info.Name] = info
+	}
+
+	var order []TableInfo
+	for len(pending) > 0 {
+		var ready []string
+		for name := range pending {
+			blocked := false
+			for _, ref := range catalog[name].refs {
+				if _, waiting := pending[ref]; waiting {
+					blocked = true
+					break
+				}
+			}
+			if !blocked {
+				ready = append(ready, name)
+			}
+		}
+		if len(ready) == 0 {
+			return nil, errors.New("cannot order tables: circular foreign keys")
+		}
+		sort.Strings(ready)
+		for _, name := range ready {
+			order = append(order, pending[name])
+			delete(pending, name)
+		}
+	}
+	return order, nil
+}
+
+func restoreTable(ctx context.Context, tx *sql.Tx, f *zip.File, info TableInfo, t *table, ids map[string]map[int64]int64) (int, error) {
+	// Columns in both the archive and the database. Columns added since the
+	// backup take their defaults; columns since dropped are ignored.
+	present := map[string]bool{}
+	for _, c := range t.columns {
+		present[c] = true
+	}
+	var columns []string
+	for _, c := range info.Columns {
+		if present[c] && !(t.serialID && c == "id") {
+			columns = append(columns, pq.QuoteIdentifier(c))
+		}
+	}
+	if len(columns) == 0 {
+		return 0, nil
+	}
+
+	list := strings.Join(columns, ", ")
+	query := `INSERT INTO ` + pq.QuoteIdentifier(t.name) + ` (` + list + `) SELECT ` + list +
+		` FROM json_populate_record(NULL::` + pq.QuoteIdentifier(t.name) + `, $1)`
+	if t.serialID {
+		query += ` RETURNING id`
+		ids[t.name] = map[int64]int64{}
+	}
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	rc, err := f.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	dec := json.NewDecoder(rc)
+	count := 0
+	for {
+		var row map[string]json.RawMessage
+		if err := dec.Decode(&row); err == io.EOF {
+			break
+		} else if err != nil {
+			return count, fmt.Errorf("row %d: %w", count+1, err)
+		}
+
+		for column, ref := range t.refs {
+			raw, ok := row[column]
+			if !ok || string(raw) == "null" {
+				continue
+			}
+			old, err := strconv.ParseInt(string(raw), 10, 64)
+			if err != nil {
+				return count, fmt.Errorf("row %d: %s: %w", count+1, column, err)
+			}
+			id, ok := ids[ref][old]
+			if !ok {
+				return count, fmt.Errorf("row %d: %s %d references a %s row missing from the backup", count+1, column, old, ref)
+			}
+			row[column] = json.RawMessage(strconv.FormatInt(id, 10))
+		}
+
+		body, err := json.Marshal(row)
+		if err != nil {
+			return count, err
+		}
+
+		if !t.serialID {
+			if _, err := stmt.ExecContext(ctx, string(body)); err != nil {
+				return count, fmt.Errorf("row %d: %w", count+1, err)
+			}
+		} else {
+			var old, id int64
+			if err := json.Unmarshal(row["id"], &old); err != nil {
+				return count, fmt.Errorf("row %d: id: %w", count+1, err)
+			}
+			if err := stmt.QueryRowContext(ctx, string(body)).Scan(&id); err != nil {
+				return count, fmt.Errorf("row %d: %w", count+1, err)
+			}
+			ids[t.name][old] = id
+		}
+		count++
+	}
+	return count, nil
+}
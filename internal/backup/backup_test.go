@@ -0,0 +1,329 @@
+package backup
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"pg-management-system/internal/blob"
+)
+
+// archive builds the zip entries of an archive
+func archive(t *testing.T, entries map[string]string) map[string]*zip.File {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range entries {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(body))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	return files
+}
+
+var documentsManifest = &Manifest{Tables: []TableInfo{{Name: "guests"}, {Name: "guest_documents"}}}
+
+const documentRows = `{"id": 1, "guest_id": 4, "storage_key": "guests/4/aaa"}
+{"id": 2, "guest_id": 4, "storage_key": "guests/4/bbb"}
+`
+
+func TestRestoreRefusesDocumentsWithoutFiles(t *testing.T) {
+	store, err := blob.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// As written before files were archived, or with one file lost
+	files := archive(t, map[string]string{
+		"tables/guests.ndjson":          `{"id": 4}` + "\n",
+		"tables/guest_documents.ndjson": documentRows,
+		"files/guests/4/aaa":            "first",
+	})
+	_, err = restoreFiles(context.Background(), files, documentsManifest, store)
+	if err == nil || !strings.Contains(err.Error(), "guests/4/bbb") {
+		t.Fatalf("restoreFiles = %v, want an error naming the missing file", err)
+	}
+	// Nothing is put before every file has been found
+	if _, err := store.Get(context.Background(), "guests/4/aaa"); !errors.Is(err, blob.ErrNotFound) {
+		t.Errorf("a file was restored although the restore was refused: %v", err)
+	}
+}
+
+func TestRestorePutsArchivedFiles(t *testing.T) {
+	ctx := context.Background()
+	store, err := blob.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A file already in the store is kept and not counted as added
+	if err := store.Put(ctx, "guests/4/aaa", strings.NewReader("first"), 5, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	files := archive(t, map[string]string{
+		"tables/guests.ndjson":          `{"id": 4}` + "\n",
+		"tables/guest_documents.ndjson": documentRows,
+		"files/guests/4/aaa":            "first",
+		"files/guests/4/bbb":            "second",
+	})
+	added, err := restoreFiles(ctx, files, documentsManifest, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(added) != 1 || added[0] != "guests/4/bbb" {
+		t.Errorf("added = %v, want [guests/4/bbb]", added)
+	}
+	rc, err := store.Get(ctx, "guests/4/bbb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(body) != "second" {
+		t.Errorf("restored file = %q", body)
+	}
+
+	// A failed restore takes back only the files it added
+	removeFiles(store, added)
+	if _, err := store.Get(ctx, "guests/4/bbb"); !errors.Is(err, blob.ErrNotFound) {
+		t.Errorf("added file survived removal: %v", err)
+	}
+	if rc, err := store.Get(ctx, "guests/4/aaa"); err != nil {
+		t.Errorf("existing file was removed: %v", err)
+	} else {
+		rc.Close()
+	}
+}
+
+func TestDumpFilesFailsOnMissingFile(t *testing.T) {
+	store, err := blob.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(io.Discard)
+	err = dumpFiles(context.Background(), zw, store, []string{"guests/4/gone"})
+	if !errors.Is(err, blob.ErrNotFound) {
+		t.Errorf("dumpFiles = %v, want ErrNotFound", err)
+	}
+	if err := dumpFiles(context.Background(), zw, nil, []string{"guests/4/aaa"}); err == nil {
+		t.Error("dumpFiles without a store accepted rows with files")
+	}
+}
+
+func TestRestoreOrder(t *testing.T) {
+	catalog := map[string]*table{
+		"rooms":           {name: "rooms", serialID: true, refs: map[string]string{}},
+		"guests":          {name: "guests", serialID: true, refs: map[string]string{"room_id": "rooms"}},
+		"payments":        {name: "payments", serialID: true, refs: map[string]string{"guest_id": "guests"}},
+		"guest_documents": {name: "guest_documents", serialID: true, refs: map[string]string{"guest_id": "guests"}},
+		"settings":        {name: "settings", refs: map[string]string{}},
+	}
+	m := &Manifest{Tables: []TableInfo{{Name: "payments"}, {Name: "settings"}, {Name: "guest_documents"}, {Name: "guests"}, {Name: "rooms"}}}
+
+	order, err := restoreOrder(m, catalog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, info := range order {
+		names = append(names, info.Name)
+	}
+	want := []string{"rooms", "settings", "guests", "guest_documents", "payments"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("order = %v, want %v", names, want)
+	}
+
+	// A referenced table left out of the archive does not hold the others back
+	if _, err := restoreOrder(&Manifest{Tables: []TableInfo{{Name: "payments"}}}, catalog); err != nil {
+		t.Errorf("partial archive: %v", err)
+	}
+
+	catalog["staff"] = &table{name: "staff", serialID: true, refs: map[string]string{"manager_id": "staff"}}
+	if _, err := restoreOrder(&Manifest{Tables: []TableInfo{{Name: "rooms"}, {Name: "staff"}}}, catalog); err == nil || !strings.Contains(err.Error(), "references the table itself") {
+		t.Errorf("self-referencing table: err = %v", err)
+	}
+
+	catalog["a"] = &table{name: "a", serialID: true, refs: map[string]string{"b_id": "b"}}
+	catalog["b"] = &table{name: "b", serialID: true, refs: map[string]string{"a_id": "a"}}
+	if _, err := restoreOrder(&Manifest{Tables: []TableInfo{{Name: "a"}, {Name: "b"}}}, catalog); err == nil || !strings.Contains(err.Error(), "circular") {
+		t.Errorf("circular references: err = %v", err)
+	}
+}
+
+// insertDriver stands in for the restore transaction: every insert returns the
+// next id of its table, counting up from 101, and the rows are recorded
+type insertDriver struct {
+	mu       sync.Mutex
+	next     map[string]int64
+	inserted map[string][]string
+}
+
+var inserts = &insertDriver{}
+
+func init() {
+	sql.Register("backup-inserts", inserts)
+}
+
+func (d *insertDriver) Open(string) (driver.Conn, error) { return insertConn{d}, nil }
+
+type insertConn struct{ d *insertDriver }
+
+func (c insertConn) Prepare(query string) (driver.Stmt, error) {
+	table := strings.Trim(strings.Fields(strings.TrimPrefix(query, "INSERT INTO "))[0], `"`)
+	return insertStmt{c.d, table}, nil
+}
+func (c insertConn) Close() error              { return nil }
+func (c insertConn) Begin() (driver.Tx, error) { return c, nil }
+func (c insertConn) Commit() error             { return nil }
+func (c insertConn) Rollback() error           { return nil }
+
+type insertStmt struct {
+	d     *insertDriver
+	table string
+}
+
+func (s insertStmt) Close() error  { return nil }
+func (s insertStmt) NumInput() int { return 1 }
+
+func (s insertStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.insert(args)
+	return driver.RowsAffected(1), nil
+}
+
+func (s insertStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &idRows{id: s.insert(args)}, nil
+}
+
+func (s insertStmt) insert(args []driver.Value) int64 {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	s.d.inserted[s.table] = append(s.d.inserted[s.table], args[0].(string))
+	if s.d.next[s.table] == 0 {
+		s.d.next[s.table] = 100
+	}
+	s.d.next[s.table]++
+	return s.d.next[s.table]
+}
+
+type idRows struct {
+	id   int64
+	done bool
+}
+
+func (r *idRows) Columns() []string { return []string{"id"} }
+func (r *idRows) Close() error      { return nil }
+
+func (r *idRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	dest[0], r.done = r.id, true
+	return nil
+}
+
+func TestRestoreTableRemapsIDs(t *testing.T) {
+	inserts.mu.Lock()
+	inserts.next, inserts.inserted = map[string]int64{}, map[string][]string{}
+	inserts.mu.Unlock()
+
+	db, err := sql.Open("backup-inserts", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	catalog := map[string]*table{
+		"rooms":    {name: "rooms", columns: []string{"id", "room_number"}, serialID: true, refs: map[string]string{}},
+		"guests":   {name: "guests", columns: []string{"id", "name", "room_id"}, serialID: true, refs: map[string]string{"room_id": "rooms"}},
+		"payments": {name: "payments", columns: []string{"id", "guest_id", "amount"}, serialID: true, refs: map[string]string{"guest_id": "guests"}},
+	}
+	// Ids with gaps, as left by deleted rows, and a guest without a room
+	files := archive(t, map[string]string{
+		"tables/rooms.ndjson": `{"id": 3, "room_number": "101"}` + "\n" +
+			`{"id": 7, "room_number": "102"}` + "\n",
+		"tables/guests.ndjson": `{"id": 10, "name": "Asha", "room_id": 7}` + "\n" +
+			`{"id": 12, "name": "Ravi", "room_id": 3}` + "\n" +
+			`{"id": 15, "name": "Old", "room_id": null}` + "\n",
+		"tables/payments.ndjson": `{"id": 40, "guest_id": 12, "amount": 5000}` + "\n" +
+			`{"id": 41, "guest_id": 10, "amount": 4500}` + "\n" +
+			`{"id": 42, "guest_id": 15, "amount": 100}` + "\n",
+	})
+
+	ids := map[string]map[int64]int64{}
+	for _, name := range []string{"rooms", "guests", "payments"} {
+		info := TableInfo{Name: name, Columns: catalog[name].columns}
+		if _, err := restoreTable(ctx, tx, files["tables/"+name+".ndjson"], info, catalog[name], ids); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+
+	want := map[string]map[int64]int64{
+		"rooms":    {3: 101, 7: 102},
+		"guests":   {10: 101, 12: 102, 15: 103},
+		"payments": {40: 101, 41: 102, 42: 103},
+	}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("ids = %v, want %v", ids, want)
+	}
+
+	// References are rewritten to the new ids
+	wantRows := map[string][]map[string]any{
+		"guests": {
+			{"id": 10.0, "name": "Asha", "room_id": 102.0},
+			{"id": 12.0, "name": "Ravi", "room_id": 101.0},
+			{"id": 15.0, "name": "Old", "room_id": nil},
+		},
+		"payments": {
+			{"id": 40.0, "guest_id": 102.0, "amount": 5000.0},
+			{"id": 41.0, "guest_id": 101.0, "amount": 4500.0},
+			{"id": 42.0, "guest_id": 103.0, "amount": 100.0},
+		},
+	}
+	for name, rows := range wantRows {
+		var got []map[string]any
+		for _, body := range inserts.inserted[name] {
+			var row map[string]any
+			if err := json.Unmarshal([]byte(body), &row); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, row)
+		}
+		if !reflect.DeepEqual(got, rows) {
+			t.Errorf("%s inserted %v, want %v", name, got, rows)
+		}
+	}
+
+	// A reference to a row that is not in the backup stops the restore
+	orphan := archive(t, map[string]string{"tables/payments.ndjson": `{"id": 50, "guest_id": 99, "amount": 1}` + "\n"})
+	info := TableInfo{Name: "payments", Columns: catalog["payments"].columns}
+	if _, err := restoreTable(ctx, tx, orphan["tables/payments.ndjson"], info, catalog["payments"], ids); err == nil || !strings.Contains(err.Error(), "guest_id 99") {
+		t.Errorf("orphaned payment: err = %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// table describes a table in the connected database
+type table struct {
+	name    string
+	columns []string
+	// serialID is set when rows get their id from a sequence, so restored rows are
+	// given new ids and references to them are remapped
+	serialID bool
+	// refs maps a column to the table whose serial id it references
+	refs map[string]string
+}
+
+// loadCatalog reads the base tables of the current schema, their columns and single-column foreign keys
+func loadCatalog(ctx context.Context, q interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}) (map[string]*table, error) {
+	tables := map[string]*table{}
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT c.table_name, c.column_name, COALESCE(c.column_default, ''), c.is_identity
+		FROM information_schema.columns c
+		JOIN information_schema.tables t
+		  ON t.table_schema = c.table_schema AND t.table_name = c.table_name
+		WHERE c.table_schema = current_schema() AND t.table_type = 'BASE TABLE'
+		ORDER BY c.table_name, c.ordinal_position
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, column, def, identity string
+		if err := rows.Scan(&name, &column, &def, &identity); err != nil {
+			return nil, err
+		}
+		t, ok := tables[name]
+		if !ok {
+			t = &table{name: name, refs: map[string]string{}}
+			tables[name] = t
+		}
+		t.columns = append(t.columns, column)
+		if column == "id" && (strings.HasPrefix(def, "nextval(") || identity == "YES") {
+			t.serialID = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	fks, err := q.QueryContext(ctx, `
+		SELECT cl.relname, att.attname, ref.relname, refatt.attname
+		FROM pg_constraint con
+		JOIN pg_class cl ON cl.oid = con.conrelid
+		JOIN pg_namespace n ON n.oid = cl.relnamespace
+		JOIN pg_class ref ON ref.oid = con.confrelid
+		JOIN pg_attribute att ON att.attrelid = con.conrelid AND att.attnum = con.conkey[1]
+		JOIN pg_attribute refatt ON refatt.attrelid = con.confrelid AND refatt.attnum = con.confkey[1]
+		WHERE con.contype = 'f' AND n.nspname = current_schema() AND array_length(con.conkey, 1) = 1
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer fks.Close()
+
+	for fks.Next() {
+		var name, column, refName, refColumn string
+		if err := fks.Scan(&name, &column, &refName, &refColumn); err != nil {
+			return nil, err
+		}
+		t, ref := tables[name], tables[refName]
+		if t != nil && ref != nil && ref.serialID && refColumn == "id" {
+			t.refs[column] = refName
+		}
+	}
+	return tables, fks.Err()
+}
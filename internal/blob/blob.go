@@ -0,0 +1,74 @@
+// Package blob stores file contents, such as guest ID documents, outside the
+// database. Rows keep only the key a file was stored under.
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrNotFound is returned when no object is stored under a key
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps objects under keys such as guests/12/3f9a1c. Keys use only
+// letters, digits, '-', '_', '.' and '/'.
+type Store interface {
+	// Put stores size bytes read from r under key, replacing any object there
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get returns the object's content, or ErrNotFound
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object; deleting a missing key is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// FromEnv opens the store named by BLOB_STORE: "local" (the default) keeps files
+// under BLOB_DIR, and "s3" talks to an S3-compatible service such as MinIO
+func FromEnv() (Store, error) {
+	switch kind := os.Getenv("BLOB_STORE"); kind {
+	case "", "local":
+		dir := os.Getenv("BLOB_DIR")
+		if dir == "" {
+			dir = "data/blobs"
+		}
+		return NewLocal(dir)
+	case "s3":
+		return NewS3(S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+		})
+	default:
+		return nil, fmt.Errorf("unknown BLOB_STORE %q, expected local or s3", kind)
+	}
+}
+
+// validKey rejects keys that could escape the store's directory or bucket prefix
+func validKey(key string) error {
+	if key == "" || key[0] == '/' || key[len(key)-1] == '/' {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	prev := byte('/')
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+		case c == '.':
+			if prev == '/' || prev == '.' {
+				return fmt.Errorf("invalid blob key %q", key)
+			}
+		case c == '/':
+			if prev == '/' {
+				return fmt.Errorf("invalid blob key %q", key)
+			}
+		default:
+			return fmt.Errorf("invalid blob key %q", key)
+		}
+		prev = c
+	}
+	return nil
+}
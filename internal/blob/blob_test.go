@@ -0,0 +1,96 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidKey(t *testing.T) {
+	valid := []string{
+		"guests/12/3f9a1c",
+		"a",
+		"guests/12/id.front.pdf",
+		"A-Z_0-9/x",
+	}
+	for _, key := range valid {
+		if err := validKey(key); err != nil {
+			t.Errorf("validKey(%q) = %v", key, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"/etc/passwd",
+		"guests/",
+		"guests//12",
+		"..",
+		"../secret",
+		"guests/../../secret",
+		"guests/12/..",
+		"guests/.hidden",
+		"guests/12/a..b",
+		`guests\..\secret`,
+		"guests/12/a b",
+		"guests/12/ä",
+		"guests/12/a\x00",
+		"C:/windows",
+	}
+	for _, key := range invalid {
+		if err := validKey(key); err == nil {
+			t.Errorf("validKey(%q) accepted an unsafe key", key)
+		}
+	}
+}
+
+func TestLocalStaysInsideItsDirectory(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "blobs")
+	l, err := NewLocal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := l.Put(ctx, "../outside", strings.NewReader("x"), 1, ""); err == nil {
+		t.Error("Put wrote outside the store")
+	}
+	if _, err := os.Stat(filepath.Join(root, "outside")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("file outside the store: %v", err)
+	}
+	if _, err := l.Get(ctx, "../blobs/../outside"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of an unsafe key = %v, want a key error", err)
+	}
+
+	if err := l.Put(ctx, "guests/1/doc", strings.NewReader("content"), 7, "application/pdf"); err != nil {
+		t.Fatal(err)
+	}
+	rc, err := l.Get(ctx, "guests/1/doc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(body) != "content" {
+		t.Errorf("Get = %q", body)
+	}
+
+	// A short write leaves nothing behind
+	if err := l.Put(ctx, "guests/1/short", strings.NewReader("abc"), 10, ""); err == nil {
+		t.Error("Put accepted fewer bytes than its size")
+	}
+	if _, err := l.Get(ctx, "guests/1/short"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after a short write = %v, want ErrNotFound", err)
+	}
+
+	if err := l.Delete(ctx, "guests/1/doc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Delete(ctx, "guests/1/doc"); err != nil {
+		t.Errorf("deleting a missing key: %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"pg-management-system/internal/events"
+	"pg-management-system/internal/models"
+)
+
+var (
+	ErrRoomFull     = errors.New("room is at full capacity")
+	ErrRoomNotFound = errors.New("room not found")
+)
+
+// reserveBed locks the room row and takes one bed, failing with ErrRoomFull when none are free
+func reserveBed(ctx context.Context, tx *sql.Tx, roomID int) error {
+	var capacity, occupancy int
+	err := tx.QueryRowContext(ctx,
+		`SELECT capacity, occupancy FROM rooms WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, roomID,
+	).Scan(&capacity, &occupancy)
+	if err == sql.ErrNoRows {
+		return ErrRoomNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if occupancy >= capacity {
+		return ErrRoomFull
+	}
+
+	row := tx.QueryRowContext(ctx,
+		`UPDATE rooms SET occupancy = occupancy + 1, version = version + 1 WHERE id = $1 RETURNING `+roomColumns, roomID,
+	)
+	return publishRoom(tx, row)
+}
+
+// releaseBed gives a bed back to the room, never dropping occupancy below zero
+func releaseBed(ctx context.Context, tx *sql.Tx, roomID int) error {
+	row := tx.QueryRowContext(ctx,
+		`UPDATE rooms SET occupancy = GREATEST(occupancy - 1, 0), version = version + 1 WHERE id = $1 RETURNING `+roomColumns, roomID,
+	)
+	err := publishRoom(tx, row)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	return err
+}
+
+// publishRoom scans the updated room and announces its occupancy once tx commits
+func publishRoom(tx *sql.Tx, row *sql.Row) error {
+	var room models.Room
+	if err := scanRoom(row, &room); err != nil {
+		return err
+	}
+	afterCommit(tx, func() { events.Publish(events.RoomOccupancyChanged, room) })
+	return nil
+}
+
+// lockRooms takes row locks on both rooms in id order so concurrent moves cannot deadlock
+func lockRooms(ctx context.Context, tx *sql.Tx, a, b int) error {
+	if a > b {
+		a, b = b, a
+	}
+	_, err := tx.ExecContext(ctx,
+		`SELECT id FROM rooms WHERE id IN ($1, $2) ORDER BY id FOR UPDATE`, a, b,
+	)
+	return err
+}
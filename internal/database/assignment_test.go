@@ -0,0 +1,122 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"pg-management-system/internal/models"
+)
+
+func TestParallelCheckInsFillOneBedOnce(t *testing.T) {
+	useTestDB(t)
+	ctx := context.Background()
+
+	room := models.Room{RoomNumber: uniqueName("T"), Capacity: 1, Price: 5000}
+	if err := CreateRoom(ctx, &room); err != nil {
+		t.Fatal(err)
+	}
+
+	const guests = 8
+	errs := make([]error, guests)
+	var wg sync.WaitGroup
+	for i := 0; i < guests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = CreateGuest(ctx, &models.Guest{
+				Name:   "Guest",
+				Email:  fmt.Sprintf("%s@example.com", uniqueName(fmt.Sprint("g", i))),
+				RoomID: room.ID,
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, ErrRoomFull):
+			t.Errorf("check-in failed with %v, want ErrRoomFull", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("%d check-ins succeeded, want exactly 1", succeeded)
+	}
+
+	got, err := GetRoomByID(WithPrimary(ctx), room.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Occupancy != 1 {
+		t.Errorf("occupancy = %d, want 1", got.Occupancy)
+	}
+}
+
+func TestUpdateRoomKeepsOccupancyAndCapacityForGuests(t *testing.T) {
+	useTestDB(t)
+	ctx := context.Background()
+
+	room := models.Room{RoomNumber: uniqueName("T"), Capacity: 2, Price: 5000}
+	if err := CreateRoom(ctx, &room); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		guest := models.Guest{Name: "Guest", Email: uniqueName(fmt.Sprint("g", i)) + "@example.com", RoomID: room.ID}
+		if err := CreateGuest(ctx, &guest); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A client leaving occupancy out, or sending 0, must not free the beds
+	update := models.Room{RoomNumber: room.RoomNumber, Capacity: 3, Price: 5500}
+	if err := UpdateRoom(ctx, room.ID, &update); err != nil {
+		t.Fatal(err)
+	}
+	if update.Occupancy != 2 {
+		t.Errorf("occupancy after update = %d, want 2", update.Occupancy)
+	}
+
+	shrink := models.Room{RoomNumber: room.RoomNumber, Capacity: 1, Price: 5500}
+	if err := UpdateRoom(ctx, room.ID, &shrink); !errors.Is(err, ErrCapacityBelowGuests) {
+		t.Errorf("shrinking below active guests: got %v, want ErrCapacityBelowGuests", err)
+	}
+
+	if err := DeleteRoom(ctx, room.ID); !errors.Is(err, ErrRoomOccupied) {
+		t.Errorf("deleting an occupied room: got %v, want ErrRoomOccupied", err)
+	}
+}
+
+func TestDeleteRoomBlocksConcurrentCheckIn(t *testing.T) {
+	useTestDB(t)
+	ctx := context.Background()
+
+	for i := 0; i < 20; i++ {
+		room := models.Room{RoomNumber: uniqueName("T"), Capacity: 1, Price: 5000}
+		if err := CreateRoom(ctx, &room); err != nil {
+			t.Fatal(err)
+		}
+
+		var deleteErr, checkInErr error
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			deleteErr = DeleteRoom(ctx, room.ID)
+		}()
+		go func() {
+			defer wg.Done()
+			checkInErr = CreateGuest(ctx, &models.Guest{Name: "Guest", Email: uniqueName("g") + "@example.com", RoomID: room.ID})
+		}()
+		wg.Wait()
+
+		// Whichever goes first wins; a deleted room must never end up with a guest
+		if deleteErr == nil && checkInErr == nil {
+			t.Fatalf("room %d was deleted while a guest checked in", room.ID)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"pg-management-system/internal/models"
+)
+
+// Audit actions
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+)
+
+// Actor identifies who performed a mutation
+type Actor struct {
+	UserID int
+	Email  string
+	IP     string
+}
+
+type actorKey struct{}
+
+// WithActor attaches the acting user to ctx so mutations made with it are attributed in the audit log
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+func actorFrom(ctx context.Context) Actor {
+	actor, _ := ctx.Value(actorKey{}).(Actor)
+	return actor
+}
+
+// audited wraps a single-row mutation on table, recording the row before and after it
+// in audit_log within the same transaction. id may be filled in by mutate on create.
+func audited(ctx context.Context, tx *sql.Tx, action, table string, id *int, mutate func() error) error {
+	var before json.RawMessage
+	if action != ActionCreate {
+		var err error
+		if before, err = snapshot(ctx, tx, table, *id); err != nil {
+			return err
+		}
+	}
+
+	if err := mutate(); err != nil {
+		return err
+	}
+
+	after, err := snapshot(ctx, tx, table, *id)
+	if err != nil {
+		return err
+	}
+	return writeAudit(ctx, tx, action, table, *id, before, after)
+}
+
+// writeAudit records one audit entry for the acting user
+func writeAudit(ctx context.Context, tx *sql.Tx, action, table string, id int, before, after json.RawMessage) error {
+	actor := actorFrom(ctx)
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO audit_log (actor_id, actor_email, action, entity, entity_id, before, after, ip)
+		VALUES (NULLIF($1, 0), $2, $3, $4, $5, $6, $7, $8)
+	`, actor.UserID, actor.Email, action, table, id, nullJSON(before), nullJSON(after), actor.IP)
+	return err
+}
+
+// snapshot returns the row as JSON, locking it for the rest of the transaction.
+// Personal data is masked, see redactSnapshot.
+func snapshot(ctx context.Context, tx *sql.Tx, table string, id int) (json.RawMessage, error) {
+	var row json.RawMessage
+	query := fmt.Sprintf(`SELECT row_to_json(t) FROM %s t WHERE t.id = $1 FOR UPDATE`, table)
+	if err := tx.QueryRowContext(ctx, query, id).Scan(&row); err != nil {
+		return nil, err
+	}
+	row, _, err := redactSnapshot(table, row)
+	return row, err
+}
+
+func nullJSON(raw json.RawMessage) any {
+	if raw == nil {
+		return nil
+	}
+	return []byte(raw)
+}
+
+// AuditFilter narrows audit log queries. Zero values are ignored.
+type AuditFilter struct {
+	Entity   string
+	EntityID int
+	Actor    string // user id or email
+	From     time.Time
+	To       time.Time
+	Limit    int
+}
+
+// GetAuditLog returns matching audit entries, newest first
+func GetAuditLog(ctx context.Context, filter AuditFilter) ([]models.AuditEntry, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var (
+		conds []string
+		args  []any
+	)
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if filter.Entity != "" {
+		add("entity = $%d", filter.Entity)
+	}
+	if filter.EntityID != 0 {
+		add("entity_id = $%d", filter.EntityID)
+	}
+	if filter.Actor != "" {
+		add("(actor_email = $%[1]d OR actor_id::text = $%[1]d)", filter.Actor)
+	}
+	if !filter.From.IsZero() {
+		add("created_at >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		add("created_at < $%d", filter.To)
+	}
+
+	query := `SELECT id, COALESCE(actor_id, 0), actor_email, action, entity, entity_id, before, after, ip, created_at FROM audit_log`
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	limit := filter.Limit
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT %d", limit)
+
+	rows, err := readQuery(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		var e models.AuditEntry
+		var before, after []byte
+		if err := rows.Scan(&e.ID, &e.ActorID, &e.ActorEmail, &e.Action, &e.Entity, &e.EntityID, &before, &after, &e.IP, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.Before, e.After = before, after
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"context"
+
+	"pg-management-system/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// Batch lookups let GraphQL resolve a relation for many parents with one query.
+// Lookups by id include soft-deleted rows, since the reference itself still exists;
+// lists by parent honour the filter like the top-level lists.
+
+// GetRoomsByIDs returns the rooms with the given ids, including deleted ones
+func GetRoomsByIDs(ctx context.Context, ids []int) ([]models.Room, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := readQuery(ctx, `SELECT `+roomColumns+` FROM rooms WHERE id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rooms := []models.Room{}
+	for rows.Next() {
+		var room models.Room
+		if err := scanRoom(rows, &room); err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, room)
+	}
+	return rooms, rows.Err()
+}
+
+// GetGuestsByIDs returns the guests with the given ids, including deleted ones
+func GetGuestsByIDs(ctx context.Context, ids []int) ([]models.Guest, error) {
+	return queryGuests(ctx, `SELECT `+guestColumns+` FROM guests WHERE id = ANY($1)`, pq.Array(ids))
+}
+
+// GetGuestsByRoomIDs returns the guests living in any of the given rooms
+func GetGuestsByRoomIDs(ctx context.Context, roomIDs []int, filter ListFilter) ([]models.Guest, error) {
+	return queryGuests(ctx, `SELECT `+guestColumns+` FROM guests WHERE room_id = ANY($1)`+filter.andClause()+` ORDER BY id`, pq.Array(roomIDs))
+}
+
+func queryGuests(ctx context.Context, query string, args ...any) ([]models.Guest, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := readQuery(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	guests := []models.Guest{}
+	for rows.Next() {
+		var guest models.Guest
+		if err := scanGuest(rows, &guest); err != nil {
+			return nil, err
+		}
+		guests = append(guests, guest)
+	}
+	return guests, rows.Err()
+}
+
+// GetPaymentsByGuestIDs returns the payments made by any of the given guests, oldest first
+func GetPaymentsByGuestIDs(ctx context.Context, guestIDs []int, filter ListFilter) ([]models.Payment, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT id, guest_id, amount, payment_date, payment_method, deleted_at, version
+		FROM payments
+		WHERE guest_id = ANY($1)` + filter.andClause() + `
+		ORDER BY payment_date, id
+	`
+
+	rows, err := readQuery(ctx, query, pq.Array(guestIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payments := []models.Payment{}
+	for rows.Next() {
+		var p models.Payment
+		if err := rows.Scan(&p.ID, &p.GuestID, &p.Amount, &p.PaymentDate, &p.PaymentMethod, &p.DeletedAt, &p.Version); err != nil {
+			return nil, err
+		}
+		payments = append(payments, p)
+	}
+	return payments, rows.Err()
+}
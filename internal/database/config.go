@@ -0,0 +1,126 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Config holds connection and pool settings, read from the environment by LoadConfig
+type Config struct {
+	DSN string
+
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	ConnectRetries int
+	RetryBackoff   time.Duration
+}
+
+// LoadConfig builds a Config from DATABASE_URL (or DB_URL), falling back to the
+// individual DB_HOST/DB_USER/... variables. TLS is controlled by DB_SSLMODE and
+// DB_SSLROOTCERT/DB_SSLCERT/DB_SSLKEY.
+func LoadConfig() Config {
+	cfg := Config{
+		MaxOpenConns:    envInt("DB_MAX_OPEN_CONNS", 25),
+		MaxIdleConns:    envInt("DB_MAX_IDLE_CONNS", 25),
+		ConnMaxLifetime: envDuration("DB_CONN_MAX_LIFETIME", 30*time.Minute),
+		ConnMaxIdleTime: envDuration("DB_CONN_MAX_IDLE_TIME", 5*time.Minute),
+		ConnectRetries:  envInt("DB_CONNECT_RETRIES", 5),
+		RetryBackoff:    envDuration("DB_CONNECT_BACKOFF", time.Second),
+	}
+
+	rawURL := os.Getenv("DATABASE_URL")
+	if rawURL == "" {
+		rawURL = os.Getenv("DB_URL")
+	}
+	if rawURL == "" {
+		rawURL = urlFromParts()
+	}
+
+	dsn, err := withTLSParams(rawURL)
+	if err != nil {
+		log.Printf("Warning: invalid database URL, using it unchanged: %v", err)
+		dsn = rawURL
+	}
+	cfg.DSN = dsn
+	return cfg
+}
+
+func urlFromParts() string {
+	u := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(envString("DB_USER", "postgres"), envString("DB_PASSWORD", "password")),
+		Host:   envString("DB_HOST", "localhost") + ":" + envString("DB_PORT", "5432"),
+		Path:   "/" + envString("DB_NAME", "pg_management"),
+	}
+	return u.String()
+}
+
+// withTLSParams applies the DB_SSL* settings to the URL. An explicit DB_SSLMODE
+// always wins; otherwise an sslmode already in the URL is kept, defaulting to disable.
+func withTLSParams(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "postgres" && u.Scheme != "postgresql" {
+		return "", fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+
+	q := u.Query()
+	if mode := os.Getenv("DB_SSLMODE"); mode != "" {
+		q.Set("sslmode", mode)
+	} else if q.Get("sslmode") == "" {
+		q.Set("sslmode", "disable")
+	}
+	for param, env := range map[string]string{
+		"sslrootcert": "DB_SSLROOTCERT",
+		"sslcert":     "DB_SSLCERT",
+		"sslkey":      "DB_SSLKEY",
+	} {
+		if v := os.Getenv(env); v != "" {
+			q.Set(param, v)
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+func envString(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func envInt(key string, fallback int) int {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		log.Printf("Warning: invalid %s %q, using %d", key, raw, fallback)
+		return fallback
+	}
+	return v
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+	v, err := time.ParseDuration(raw)
+	if err != nil {
+		log.Printf("Warning: invalid %s %q, using %v", key, raw, fallback)
+		return fallback
+	}
+	return v
+}
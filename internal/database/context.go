@@ -0,0 +1,67 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DefaultQueryTimeout is used when DB_QUERY_TIMEOUT is not set
+const DefaultQueryTimeout = 5 * time.Second
+
+var queryTimeout = DefaultQueryTimeout
+
+type timeoutKey struct{}
+
+// loadQueryTimeout reads DB_QUERY_TIMEOUT (e.g. "3s", "500ms"). A value of 0 disables the deadline.
+func loadQueryTimeout() {
+	raw := os.Getenv("DB_QUERY_TIMEOUT")
+	if raw == "" {
+		return
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d < 0 {
+		log.Printf("Warning: invalid DB_QUERY_TIMEOUT %q, using %v", raw, queryTimeout)
+		return
+	}
+	queryTimeout = d
+}
+
+// WithQueryTimeout overrides the query timeout for repository calls made with the returned context
+func WithQueryTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, timeoutKey{}, d)
+}
+
+// withTimeout derives the context a single repository call runs under
+func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	d := queryTimeout
+	if override, ok := ctx.Value(timeoutKey{}).(time.Duration); ok {
+		d = override
+	}
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// IsTimeout reports whether err was caused by a query running past its deadline
+func IsTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	// Postgres reports server-side cancellation as query_canceled
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "57014"
+}
+
+// IsCanceled reports whether err was caused by the caller abandoning the request
+func IsCanceled(err error) bool {
+	return errors.Is(err, context.Canceled)
+}
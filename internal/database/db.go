@@ -1,53 +1,63 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
-	"os"
+	"time"
 
 	_ "github.com/lib/pq"
 )
 
+// maxConnectBackoff caps the wait between startup connection attempts
+const maxConnectBackoff = 30 * time.Second
+
 var DB *sql.DB
 
-func Connect() {
-	var err error
-	host := os.Getenv("DB_HOST")
-	if host == "" {
-		host = "localhost"
-	}
-	user := os.Getenv("DB_USER")
-	if user == "" {
-		user = "postgres"
-	}
-	password := os.Getenv("DB_PASSWORD")
-	if password == "" {
-		password = "password"
-	}
-	dbname := os.Getenv("DB_NAME")
-	if dbname == "" {
-		dbname = "pg_management"
-	}
-	port := os.Getenv("DB_PORT")
-	if port == "" {
-		port = "5432"
+// Connect opens the connection pool described by the environment and waits for
+// the database to become reachable, retrying with exponential backoff.
+func Connect() error {
+	db, err := Open(LoadConfig())
+	if err != nil {
+		return err
 	}
+	DB = db
+
+	loadQueryTimeout()
+	connectReplica()
 
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-		host, user, password, dbname, port,
-	)
+	log.Println("Connected to Database successfully!")
+	return nil
+}
 
-	DB, err = sql.Open("postgres", dsn)
+// Open creates a pool with cfg's sizing and pings it until it answers or the retries run out
+func Open(cfg Config) (*sql.DB, error) {
+	db, err := sql.Open("postgres", cfg.DSN)
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	if err = DB.Ping(); err != nil {
-		log.Fatal("Failed to ping database:", err)
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+	backoff := cfg.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		if err = db.Ping(); err == nil {
+			return db, nil
+		}
+		if attempt > cfg.ConnectRetries {
+			db.Close()
+			return nil, fmt.Errorf("failed to ping database after %d attempts: %w", attempt, err)
+		}
+		log.Printf("Database not reachable (attempt %d/%d): %v; retrying in %v", attempt, cfg.ConnectRetries+1, err, backoff)
+		time.Sleep(backoff)
+		if backoff < maxConnectBackoff {
+			backoff *= 2
+		}
 	}
-
-	log.Println("Connected to Database successfully!")
 }
 
 func InitSchema() {
@@ -64,8 +74,9 @@ func InitSchema() {
 	CREATE TABLE IF NOT EXISTS guests (
 		id SERIAL PRIMARY KEY,
 		name VARCHAR(100) NOT NULL,
-		email VARCHAR(100) UNIQUE NOT NULL,
-		phone VARCHAR(20),
+		email TEXT NOT NULL,
+		phone TEXT,
+		email_bidx CHAR(64),
 		room_id INT REFERENCES rooms(id),
 		join_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 	);`
@@ -88,6 +99,54 @@ func InitSchema() {
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 	);`
 
+	createAuditLogTable := `
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id SERIAL PRIMARY KEY,
+		actor_id INT,
+		actor_email VARCHAR(100) NOT NULL DEFAULT '',
+		action VARCHAR(20) NOT NULL,
+		entity VARCHAR(50) NOT NULL,
+		entity_id INT NOT NULL,
+		before JSONB,
+		after JSONB,
+		ip VARCHAR(64) NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS audit_log_entity_idx ON audit_log (entity, entity_id);
+	CREATE INDEX IF NOT EXISTS audit_log_created_at_idx ON audit_log (created_at);`
+
+	createPersistedQueriesTable := `
+	CREATE TABLE IF NOT EXISTS persisted_queries (
+		hash CHAR(64) PRIMARY KEY,
+		query TEXT NOT NULL,
+		operation_name VARCHAR(200) NOT NULL DEFAULT '',
+		allowlisted BOOLEAN NOT NULL DEFAULT FALSE,
+		registered_by INT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	createGuestDocumentsTable := `
+	CREATE TABLE IF NOT EXISTS guest_documents (
+		id SERIAL PRIMARY KEY,
+		guest_id INT NOT NULL REFERENCES guests(id),
+		doc_type VARCHAR(30) NOT NULL,
+		doc_number TEXT NOT NULL DEFAULT '',
+		filename VARCHAR(255) NOT NULL DEFAULT '',
+		content_type VARCHAR(100) NOT NULL,
+		size BIGINT NOT NULL,
+		storage_key VARCHAR(200) NOT NULL UNIQUE,
+		status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'verified', 'rejected')),
+		rejection_reason TEXT NOT NULL DEFAULT '',
+		expires_at TIMESTAMP,
+		uploaded_by VARCHAR(100) NOT NULL DEFAULT '',
+		reviewed_by VARCHAR(100) NOT NULL DEFAULT '',
+		reviewed_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		version INT NOT NULL DEFAULT 1
+	);
+	CREATE INDEX IF NOT EXISTS guest_documents_guest_id_idx ON guest_documents (guest_id);
+	CREATE INDEX IF NOT EXISTS guest_documents_expires_at_idx ON guest_documents (expires_at) WHERE expires_at IS NOT NULL;`
+
 	if _, err := DB.Exec(createRoomsTable); err != nil {
 		log.Fatal("Failed to create rooms table:", err)
 	}
@@ -112,5 +171,25 @@ func InitSchema() {
 		log.Fatal("Failed to create users table:", err)
 	}
 
+	if _, err := DB.Exec(createAuditLogTable); err != nil {
+		log.Fatal("Failed to create audit_log table:", err)
+	}
+
+	if _, err := DB.Exec(createPersistedQueriesTable); err != nil {
+		log.Fatal("Failed to create persisted_queries table:", err)
+	}
+
+	if _, err := DB.Exec(createGuestDocumentsTable); err != nil {
+		log.Fatal("Failed to create guest_documents table:", err)
+	}
+
+	runMigrations()
+
+	if n, err := ProtectPII(context.Background(), false); err != nil {
+		log.Fatal("Failed to encrypt personal data:", err)
+	} else if n > 0 {
+		log.Printf("Protected %d plaintext personal data values and audit entries.", n)
+	}
+
 	log.Println("Database schema initialized successfully!")
 }
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	testDBOnce sync.Once
+	testDBErr  error
+)
+
+// useTestDB points DB at TEST_DATABASE_URL, a disposable database the tests may
+// write to, creating the schema on first use. Tests that need PostgreSQL are
+// skipped when it is not set.
+func useTestDB(t *testing.T) {
+	t.Helper()
+	rawURL := os.Getenv("TEST_DATABASE_URL")
+	if rawURL == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	usePIIKeys()
+	testDBOnce.Do(func() {
+		dsn, err := withTLSParams(rawURL)
+		if err != nil {
+			testDBErr = err
+			return
+		}
+		DB, testDBErr = Open(Config{DSN: dsn, MaxOpenConns: 20, MaxIdleConns: 20, RetryBackoff: time.Second})
+		if testDBErr == nil {
+			InitSchema()
+		}
+	})
+	if testDBErr != nil {
+		t.Fatal(testDBErr)
+	}
+}
+
+// usePIIKeys configures test keys for pii.Default unless the environment has some
+func usePIIKeys() {
+	for key, value := range map[string]string{
+		"PII_KEYS":      "test:" + base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32))),
+		"PII_INDEX_KEY": base64.StdEncoding.EncodeToString([]byte(strings.Repeat("i", 32))),
+	} {
+		if os.Getenv(key) == "" {
+			os.Setenv(key, value)
+		}
+	}
+}
+
+// uniqueName keeps rows from separate test runs apart in a shared database
+func uniqueName(prefix string) string {
+	return fmt.Sprintf("%s-%d", prefix, time.Now().UnixNano())
+}
@@ -0,0 +1,189 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"pg-management-system/internal/models"
+	"pg-management-system/internal/pii"
+
+	"github.com/lib/pq"
+)
+
+const documentColumns = `id, guest_id, doc_type, doc_number, filename, content_type, size, storage_key, status,
+	rejection_reason, expires_at, COALESCE(expires_at <= NOW(), FALSE), uploaded_by, reviewed_by, reviewed_at,
+	created_at, version`
+
+// documentFields lists where each of documentColumns is scanned to
+func documentFields(doc *models.GuestDocument) []any {
+	return []any{&doc.ID, &doc.GuestID, &doc.Type, &doc.Number, &doc.Filename, &doc.ContentType, &doc.Size,
+		&doc.StorageKey, &doc.Status, &doc.Reason, &doc.ExpiresAt, &doc.Expired, &doc.UploadedBy, &doc.ReviewedBy,
+		&doc.ReviewedAt, &doc.CreatedAt, &doc.Version}
+}
+
+// CreateGuestDocument records a document whose file is already in the blob store.
+// It starts out pending, attributed to the acting user.
+func CreateGuestDocument(ctx context.Context, doc *models.GuestDocument) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		INSERT INTO guest_documents (guest_id, doc_type, doc_number, filename, content_type, size, storage_key, expires_at, uploaded_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, status, COALESCE(expires_at <= NOW(), FALSE), created_at, version
+	`
+	doc.UploadedBy = actorFrom(ctx).Email
+	number, err := sealField(pii.DocumentNumber, doc.Number)
+	if err != nil {
+		return err
+	}
+
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		return audited(ctx, tx, ActionCreate, "guest_documents", &doc.ID, func() error {
+			return tx.QueryRowContext(ctx, query,
+				doc.GuestID, doc.Type, number, doc.Filename, doc.ContentType, doc.Size, doc.StorageKey, doc.ExpiresAt, doc.UploadedBy,
+			).Scan(&doc.ID, &doc.Status, &doc.Expired, &doc.CreatedAt, &doc.Version)
+		})
+	})
+}
+
+func GetGuestDocumentByID(ctx context.Context, id int) (*models.GuestDocument, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	doc := &models.GuestDocument{}
+	query := `SELECT ` + documentColumns + ` FROM guest_documents WHERE id = $1`
+	if err := readRow(ctx, query, []any{id}, documentFields(doc)...); err != nil {
+		return nil, err
+	}
+	var err error
+	if doc.Number, err = openField(pii.DocumentNumber, doc.Number); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// DocumentFilter narrows document queries. Zero values are ignored.
+type DocumentFilter struct {
+	GuestID int
+	Type    string
+	Status  string
+	// ExpiringBefore keeps documents that expire before it, including expired ones
+	ExpiringBefore time.Time
+	Limit          int
+}
+
+// GetGuestDocuments returns matching documents, soonest expiry first and then newest
+func GetGuestDocuments(ctx context.Context, filter DocumentFilter) ([]models.GuestDocument, error) {
+	var (
+		conds []string
+		args  []any
+	)
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if filter.GuestID != 0 {
+		add("guest_id = $%d", filter.GuestID)
+	}
+	if filter.Type != "" {
+		add("doc_type = $%d", filter.Type)
+	}
+	if filter.Status != "" {
+		add("status = $%d", filter.Status)
+	}
+	if !filter.ExpiringBefore.IsZero() {
+		add("expires_at < $%d", filter.ExpiringBefore)
+	}
+
+	query := `SELECT ` + documentColumns + ` FROM guest_documents`
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	limit := filter.Limit
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	query += fmt.Sprintf(" ORDER BY expires_at NULLS LAST, id DESC LIMIT %d", limit)
+
+	return queryDocuments(ctx, query, args...)
+}
+
+// GetDocumentsByGuestIDs returns the documents of any of the given guests, oldest first
+func GetDocumentsByGuestIDs(ctx context.Context, guestIDs []int) ([]models.GuestDocument, error) {
+	return queryDocuments(ctx, `SELECT `+documentColumns+` FROM guest_documents WHERE guest_id = ANY($1) ORDER BY id`, pq.Array(guestIDs))
+}
+
+func queryDocuments(ctx context.Context, query string, args ...any) ([]models.GuestDocument, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := readQuery(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	docs := []models.GuestDocument{}
+	for rows.Next() {
+		var doc models.GuestDocument
+		if err := rows.Scan(documentFields(&doc)...); err != nil {
+			return nil, err
+		}
+		if doc.Number, err = openField(pii.DocumentNumber, doc.Number); err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, rows.Err()
+}
+
+// ReviewGuestDocument records the acting user's decision on a document. A non-zero
+// review.Version must match the stored version; it is set to the new version.
+func ReviewGuestDocument(ctx context.Context, id int, review *models.DocumentReview) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE guest_documents
+		SET status = $1, rejection_reason = $2, reviewed_by = $3, reviewed_at = NOW(), version = version + 1
+		WHERE id = $4
+		RETURNING version
+	`
+
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		return audited(ctx, tx, ActionUpdate, "guest_documents", &id, func() error {
+			var current int
+			if err := tx.QueryRowContext(ctx, `SELECT version FROM guest_documents WHERE id = $1`, id).Scan(&current); err != nil {
+				return err
+			}
+			if review.Version != 0 && review.Version != current {
+				return ErrVersionConflict
+			}
+			return tx.QueryRowContext(ctx, query, review.Status, review.Reason, actorFrom(ctx).Email, id).Scan(&review.Version)
+		})
+	})
+}
+
+// DeleteGuestDocument removes the document's row and returns the key of its file,
+// which the caller deletes from the blob store once the row is gone
+func DeleteGuestDocument(ctx context.Context, id int) (string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var key string
+	err := WithTx(ctx, func(tx *sql.Tx) error {
+		before, err := snapshot(ctx, tx, "guest_documents", id)
+		if err != nil {
+			return err
+		}
+		if err := tx.QueryRowContext(ctx, `DELETE FROM guest_documents WHERE id = $1 RETURNING storage_key`, id).Scan(&key); err != nil {
+			return err
+		}
+		return writeAudit(ctx, tx, ActionDelete, "guest_documents", id, before, nil)
+	})
+	return key, err
+}
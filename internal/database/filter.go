@@ -0,0 +1,56 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ListFilter narrows the rows returned by list queries
+type ListFilter struct {
+	// IncludeDeleted also returns soft-deleted rows
+	IncludeDeleted bool
+}
+
+// whereClause returns the WHERE clause for the filter, or "" when nothing is filtered
+func (f ListFilter) whereClause() string {
+	if f.IncludeDeleted {
+		return ""
+	}
+	return " WHERE deleted_at IS NULL"
+}
+
+// Period limits date-based queries to [From, To). A zero bound leaves that side open.
+type Period struct {
+	From time.Time
+	To   time.Time
+}
+
+// where combines the list filter with the period applied to column
+func (p Period) where(filter ListFilter, column string) (string, []any) {
+	var conds []string
+	var args []any
+	if !filter.IncludeDeleted {
+		conds = append(conds, "deleted_at IS NULL")
+	}
+	if !p.From.IsZero() {
+		args = append(args, p.From)
+		conds = append(conds, fmt.Sprintf("%s >= $%d", column, len(args)))
+	}
+	if !p.To.IsZero() {
+		args = append(args, p.To)
+		conds = append(conds, fmt.Sprintf("%s < $%d", column, len(args)))
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// andClause is whereClause for queries that already have a WHERE
+func (f ListFilter) andClause() string {
+	if f.IncludeDeleted {
+		return ""
+	}
+	return " AND deleted_at IS NULL"
+}
@@ -1,83 +1,209 @@
 package database
 
 import (
+	"context"
 	"database/sql"
-	"time"
+	"errors"
+	"pg-management-system/internal/events"
 	"pg-management-system/internal/models"
+	"time"
 )
 
-func CreateGuest(guest *models.Guest) error {
-	query := `INSERT INTO guests (name, email, phone, room_id, join_date) 
-			  VALUES ($1, $2, $3, $4, $5) RETURNING id`
-	
+// ErrGuestLeft is returned when restoring or upserting a past resident. Their row
+// records a stay that ended, so they come back as a new guest instead.
+var ErrGuestLeft = errors.New("guest has checked out and cannot be restored")
+
+// CreateGuest inserts the guest and takes a bed in their room within one transaction
+func CreateGuest(ctx context.Context, guest *models.Guest) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		return createGuestTx(ctx, tx, guest)
+	})
+}
+
+func createGuestTx(ctx context.Context, tx *sql.Tx, guest *models.Guest) error {
+	query := `INSERT INTO guests (name, email, phone, email_bidx, room_id, join_date) 
+			  VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, version`
+
 	if guest.JoinDate.IsZero() {
 		guest.JoinDate = time.Now()
 	}
+	email, phone, emailIndex, err := sealGuest(guest)
+	if err != nil {
+		return err
+	}
 
-	return DB.QueryRow(query, guest.Name, guest.Email, guest.Phone, guest.RoomID, guest.JoinDate).Scan(&guest.ID)
+	return audited(ctx, tx, ActionCreate, "guests", &guest.ID, func() error {
+		if err := reserveBed(ctx, tx, guest.RoomID); err != nil {
+			return err
+		}
+		err := tx.QueryRowContext(ctx, query, guest.Name, email, phone, emailIndex, guest.RoomID, guest.JoinDate).Scan(&guest.ID, &guest.Version)
+		if err != nil {
+			return err
+		}
+		created := *guest
+		afterCommit(tx, func() { events.Publish(events.GuestCheckedIn, created) })
+		return nil
+	})
 }
 
-func GetGuestByID(id int) (*models.Guest, error) {
+const guestColumns = `id, name, email, phone, room_id, join_date, deleted_at, left_at, version`
+
+// scanGuest reads a row of guestColumns and decrypts its personal data
+func scanGuest(row interface{ Scan(...any) error }, guest *models.Guest) error {
+	if err := row.Scan(&guest.ID, &guest.Name, &guest.Email, &guest.Phone, &guest.RoomID, &guest.JoinDate, &guest.DeletedAt, &guest.LeftAt, &guest.Version); err != nil {
+		return err
+	}
+	return openGuest(guest)
+}
+
+func GetGuestByID(ctx context.Context, id int) (*models.Guest, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	guest := &models.Guest{}
-	query := `SELECT id, name, email, phone, room_id, join_date FROM guests WHERE id = $1`
-	
-	err := DB.QueryRow(query, id).Scan(&guest.ID, &guest.Name, &guest.Email, &guest.Phone, &guest.RoomID, &guest.JoinDate)
+	query := `SELECT ` + guestColumns + ` FROM guests WHERE id = $1 AND deleted_at IS NULL`
+
+	err := readRow(ctx, query, []any{id}, &guest.ID, &guest.Name, &guest.Email, &guest.Phone, &guest.RoomID, &guest.JoinDate, &guest.DeletedAt, &guest.LeftAt, &guest.Version)
 	if err != nil {
 		return nil, err
 	}
+	if err := openGuest(guest); err != nil {
+		return nil, err
+	}
 	return guest, nil
 }
 
-func GetAllGuests() ([]models.Guest, error) {
-	rows, err := DB.Query(`SELECT id, name, email, phone, room_id, join_date FROM guests`)
+func GetAllGuests(ctx context.Context, filter ListFilter) ([]models.Guest, error) {
+	guests := []models.Guest{}
+	err := EachGuest(ctx, filter, func(guest *models.Guest) error {
+		guests = append(guests, *guest)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	return guests, nil
+}
+
+// EachGuest calls fn for every guest as it is read, without buffering the result set
+func EachGuest(ctx context.Context, filter ListFilter, fn func(*models.Guest) error) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := readQuery(ctx, `SELECT `+guestColumns+` FROM guests`+filter.whereClause()+` ORDER BY id`)
+	if err != nil {
+		return err
+	}
 	defer rows.Close()
 
-	var guests []models.Guest
 	for rows.Next() {
 		var guest models.Guest
-		if err := rows.Scan(&guest.ID, &guest.Name, &guest.Email, &guest.Phone, &guest.RoomID, &guest.JoinDate); err != nil {
-			return nil, err
+		if err := scanGuest(rows, &guest); err != nil {
+			return err
+		}
+		if err := fn(&guest); err != nil {
+			return err
 		}
-		guests = append(guests, guest)
 	}
-	return guests, nil
+	return rows.Err()
 }
 
-func UpdateGuest(id int, guest *models.Guest) error {
-	query := `UPDATE guests SET name=$1, email=$2, phone=$3, room_id=$4 WHERE id=$5`
-	
-	res, err := DB.Exec(query, guest.Name, guest.Email, guest.Phone, guest.RoomID, id)
-	if err != nil {
-		return err
-	}
-	
-	count, err := res.RowsAffected()
-	if err != nil {
-		return err
-	}
-	if count == 0 {
-		return sql.ErrNoRows
-	}
-	return nil
+// UpdateGuest updates the guest and, when the room changes, moves their bed atomically.
+// A non-zero guest.Version must match the stored version.
+func UpdateGuest(ctx context.Context, id int, guest *models.Guest) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		return updateGuestTx(ctx, tx, id, guest)
+	})
 }
 
-func DeleteGuest(id int) error {
-	query := `DELETE FROM guests WHERE id=$1`
-	
-	res, err := DB.Exec(query, id)
-	if err != nil {
-		return err
-	}
-	
-	count, err := res.RowsAffected()
+func updateGuestTx(ctx context.Context, tx *sql.Tx, id int, guest *models.Guest) error {
+	query := `UPDATE guests SET name=$1, email=$2, phone=$3, email_bidx=$4, room_id=$5, version = version + 1
+			  WHERE id=$6 RETURNING version`
+
+	email, phone, emailIndex, err := sealGuest(guest)
 	if err != nil {
 		return err
 	}
-	if count == 0 {
-		return sql.ErrNoRows
-	}
-	return nil
+
+	return audited(ctx, tx, ActionUpdate, "guests", &id, func() error {
+		if err := checkVersion(ctx, tx, "guests", id, guest.Version); err != nil {
+			return err
+		}
+
+		var currentRoomID int
+		err := tx.QueryRowContext(ctx, `SELECT room_id FROM guests WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, id).Scan(&currentRoomID)
+		if err != nil {
+			return err
+		}
+
+		if currentRoomID != guest.RoomID {
+			if err := lockRooms(ctx, tx, currentRoomID, guest.RoomID); err != nil {
+				return err
+			}
+			if err := reserveBed(ctx, tx, guest.RoomID); err != nil {
+				return err
+			}
+			if err := releaseBed(ctx, tx, currentRoomID); err != nil {
+				return err
+			}
+		}
+
+		return tx.QueryRowContext(ctx, query, guest.Name, email, phone, emailIndex, guest.RoomID, id).Scan(&guest.Version)
+	})
+}
+
+// DeleteGuest soft-deletes the guest and frees their bed. Their payments are kept.
+func DeleteGuest(ctx context.Context, id int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		return audited(ctx, tx, ActionDelete, "guests", &id, func() error {
+			var roomID int
+			err := tx.QueryRowContext(ctx,
+				`UPDATE guests SET deleted_at = NOW(), version = version + 1 WHERE id=$1 AND deleted_at IS NULL RETURNING room_id`, id,
+			).Scan(&roomID)
+			if err != nil {
+				return err
+			}
+			return releaseBed(ctx, tx, roomID)
+		})
+	})
+}
+
+// RestoreGuest undeletes the guest, taking their bed back if the room still has space.
+// Past residents are refused with ErrGuestLeft.
+func RestoreGuest(ctx context.Context, id int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		return audited(ctx, tx, ActionRestore, "guests", &id, func() error {
+			var left bool
+			err := tx.QueryRowContext(ctx,
+				`SELECT left_at IS NOT NULL FROM guests WHERE id=$1 AND deleted_at IS NOT NULL FOR UPDATE`, id,
+			).Scan(&left)
+			if err != nil {
+				return err
+			}
+			if left {
+				return ErrGuestLeft
+			}
+
+			var roomID int
+			err = tx.QueryRowContext(ctx,
+				`UPDATE guests SET deleted_at = NULL, version = version + 1 WHERE id=$1 RETURNING room_id`, id,
+			).Scan(&roomID)
+			if err != nil {
+				return err
+			}
+			return reserveBed(ctx, tx, roomID)
+		})
+	})
 }
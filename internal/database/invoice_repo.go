@@ -0,0 +1,52 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"pg-management-system/internal/models"
+	"pg-management-system/internal/pii"
+)
+
+// GetMonthlyInvoices builds an invoice for every active guest who had joined by the
+// end of month: the room price as rent, and the payments dated within the month.
+func GetMonthlyInvoices(ctx context.Context, month time.Time) ([]models.Invoice, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	start := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+
+	query := `
+		SELECT g.id, g.name, g.email, r.room_number, r.price, COALESCE(SUM(p.amount), 0)
+		FROM guests g
+		JOIN rooms r ON r.id = g.room_id
+		LEFT JOIN payments p ON p.guest_id = g.id AND p.deleted_at IS NULL
+			AND p.payment_date >= $1 AND p.payment_date < $2
+		WHERE g.deleted_at IS NULL AND g.join_date < $2
+		GROUP BY g.id, r.id
+		ORDER BY r.room_number, g.name
+	`
+
+	rows, err := readQuery(ctx, query, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invoices := []models.Invoice{}
+	for rows.Next() {
+		inv := models.Invoice{PeriodStart: start, PeriodEnd: end.AddDate(0, 0, -1)}
+		if err := rows.Scan(&inv.GuestID, &inv.GuestName, &inv.GuestEmail, &inv.RoomNumber, &inv.Rent, &inv.Paid); err != nil {
+			return nil, err
+		}
+		if inv.GuestEmail, err = openField(pii.GuestEmail, inv.GuestEmail); err != nil {
+			return nil, err
+		}
+		inv.Number = fmt.Sprintf("INV-%s-%05d", start.Format("200601"), inv.GuestID)
+		inv.Balance = inv.Rent - inv.Paid
+		invoices = append(invoices, inv)
+	}
+	return invoices, rows.Err()
+}
@@ -0,0 +1,19 @@
+package database
+
+import "expvar"
+
+// Pool statistics are served with the other expvars at /debug/vars
+func init() {
+	expvar.Publish("db_pool", expvar.Func(func() any {
+		if DB == nil {
+			return nil
+		}
+		return DB.Stats()
+	}))
+	expvar.Publish("db_replica_pool", expvar.Func(func() any {
+		if Replica == nil {
+			return nil
+		}
+		return Replica.Stats()
+	}))
+}
@@ -0,0 +1,43 @@
+package database
+
+import "log"
+
+// schemaMigrations upgrade tables created by earlier releases. Each statement
+// must be idempotent because they run on every startup after InitSchema.
+var schemaMigrations = []string{
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) DEFAULT 'user'`,
+
+	// Soft delete
+	`ALTER TABLE rooms ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP`,
+	`ALTER TABLE guests ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP`,
+	`ALTER TABLE payments ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP`,
+
+	// Optimistic concurrency
+	`ALTER TABLE rooms ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1`,
+	`ALTER TABLE guests ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1`,
+	`ALTER TABLE payments ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1`,
+
+	// Past residents loaded by pgctl seed; they are hidden like deleted guests but
+	// are never restored or purged
+	`ALTER TABLE guests ADD COLUMN IF NOT EXISTS left_at TIMESTAMP`,
+
+	// Encrypted personal data, see ProtectPII. Uniqueness of emails moves to
+	// their blind index under the old constraint's name.
+	`ALTER TABLE guests ADD COLUMN IF NOT EXISTS email_bidx CHAR(64)`,
+	`ALTER TABLE guests ALTER COLUMN email TYPE TEXT, ALTER COLUMN phone TYPE TEXT`,
+	`ALTER TABLE guest_documents ALTER COLUMN doc_number TYPE TEXT`,
+	`ALTER TABLE guests DROP CONSTRAINT IF EXISTS guests_email_key`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS guests_email_key ON guests (email_bidx)`,
+
+	// Automatic persisted query registrations are counted per user
+	`ALTER TABLE persisted_queries ADD COLUMN IF NOT EXISTS registered_by INT`,
+	`CREATE INDEX IF NOT EXISTS persisted_queries_registered_by_idx ON persisted_queries (registered_by) WHERE NOT allowlisted`,
+}
+
+func runMigrations() {
+	for _, stmt := range schemaMigrations {
+		if _, err := DB.Exec(stmt); err != nil {
+			log.Fatalf("Failed to apply migration %q: %v", stmt, err)
+		}
+	}
+}
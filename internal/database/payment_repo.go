@@ -1,45 +1,64 @@
 package database
 
 import (
+	"context"
+	"database/sql"
 	"time"
 
+	"pg-management-system/internal/events"
 	"pg-management-system/internal/models"
 )
 
-func CreatePayment(payment *models.Payment) error {
+func CreatePayment(ctx context.Context, payment *models.Payment) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	query := `
 		INSERT INTO payments (guest_id, amount, payment_date, payment_method)
 		VALUES ($1, $2, $3, $4)
-		RETURNING id
+		RETURNING id, version
 	`
 
 	if payment.PaymentDate.IsZero() {
 		payment.PaymentDate = time.Now()
 	}
 
-	return DB.QueryRow(
-		query,
-		payment.GuestID,
-		payment.Amount,
-		payment.PaymentDate,
-		payment.PaymentMethod,
-	).Scan(&payment.ID)
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		return audited(ctx, tx, ActionCreate, "payments", &payment.ID, func() error {
+			err := tx.QueryRowContext(ctx,
+				query,
+				payment.GuestID,
+				payment.Amount,
+				payment.PaymentDate,
+				payment.PaymentMethod,
+			).Scan(&payment.ID, &payment.Version)
+			if err != nil {
+				return err
+			}
+			received := *payment
+			afterCommit(tx, func() { events.Publish(events.PaymentReceived, received) })
+			return nil
+		})
+	})
 }
 
-func GetPaymentsByGuestID(guestID int) ([]models.Payment, error) {
+func GetPaymentsByGuestID(ctx context.Context, guestID int) ([]models.Payment, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	query := `
-		SELECT id, guest_id, amount, payment_date, payment_method
+		SELECT id, guest_id, amount, payment_date, payment_method, deleted_at, version
 		FROM payments
-		WHERE guest_id = $1
+		WHERE guest_id = $1 AND deleted_at IS NULL
 	`
 
-	rows, err := DB.Query(query, guestID)
+	rows, err := readQuery(ctx, query, guestID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var payments []models.Payment
+	payments := []models.Payment{}
 	for rows.Next() {
 		var p models.Payment
 		if err := rows.Scan(
@@ -48,28 +67,46 @@ func GetPaymentsByGuestID(guestID int) ([]models.Payment, error) {
 			&p.Amount,
 			&p.PaymentDate,
 			&p.PaymentMethod,
+			&p.DeletedAt,
+			&p.Version,
 		); err != nil {
 			return nil, err
 		}
 		payments = append(payments, p)
 	}
 
+	return payments, rows.Err()
+}
+
+func GetAllPayments(ctx context.Context, filter ListFilter) ([]models.Payment, error) {
+	payments := []models.Payment{}
+	err := EachPayment(ctx, filter, Period{}, func(p *models.Payment) error {
+		payments = append(payments, *p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 	return payments, nil
 }
 
-func GetAllPayments() ([]models.Payment, error) {
+// EachPayment calls fn for every payment in the period as it is read, without buffering the result set
+func EachPayment(ctx context.Context, filter ListFilter, period Period, fn func(*models.Payment) error) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	where, args := period.where(filter, "payment_date")
 	query := `
-		SELECT id, guest_id, amount, payment_date, payment_method
+		SELECT id, guest_id, amount, payment_date, payment_method, deleted_at, version
 		FROM payments
-	`
+	` + where + ` ORDER BY payment_date, id`
 
-	rows, err := DB.Query(query)
+	rows, err := readQuery(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
 
-	var payments []models.Payment
 	for rows.Next() {
 		var p models.Payment
 		if err := rows.Scan(
@@ -78,29 +115,38 @@ func GetAllPayments() ([]models.Payment, error) {
 			&p.Amount,
 			&p.PaymentDate,
 			&p.PaymentMethod,
+			&p.DeletedAt,
+			&p.Version,
 		); err != nil {
-			return nil, err
+			return err
+		}
+		if err := fn(&p); err != nil {
+			return err
 		}
-		payments = append(payments, p)
 	}
 
-	return payments, nil
+	return rows.Err()
 }
 
-func GetPaymentByID(id int) (*models.Payment, error) {
+func GetPaymentByID(ctx context.Context, id int) (*models.Payment, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	query := `
-		SELECT id, guest_id, amount, payment_date, payment_method
+		SELECT id, guest_id, amount, payment_date, payment_method, deleted_at, version
 		FROM payments
-		WHERE id = $1
+		WHERE id = $1 AND deleted_at IS NULL
 	`
 
 	var p models.Payment
-	err := DB.QueryRow(query, id).Scan(
+	err := readRow(ctx, query, []any{id},
 		&p.ID,
 		&p.GuestID,
 		&p.Amount,
 		&p.PaymentDate,
 		&p.PaymentMethod,
+		&p.DeletedAt,
+		&p.Version,
 	)
 	if err != nil {
 		return nil, err
@@ -109,26 +155,65 @@ func GetPaymentByID(id int) (*models.Payment, error) {
 	return &p, nil
 }
 
-func UpdatePayment(payment *models.Payment) error {
+// UpdatePayment overwrites the payment. A non-zero payment.Version must match the stored version.
+func UpdatePayment(ctx context.Context, payment *models.Payment) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	query := `
 		UPDATE payments
-		SET guest_id = $1, amount = $2, payment_date = $3, payment_method = $4
+		SET guest_id = $1, amount = $2, payment_date = $3, payment_method = $4, version = version + 1
 		WHERE id = $5
+		RETURNING version
 	`
 
-	_, err := DB.Exec(
-		query,
-		payment.GuestID,
-		payment.Amount,
-		payment.PaymentDate,
-		payment.PaymentMethod,
-		payment.ID,
-	)
-	return err
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		return audited(ctx, tx, ActionUpdate, "payments", &payment.ID, func() error {
+			if err := checkVersion(ctx, tx, "payments", payment.ID, payment.Version); err != nil {
+				return err
+			}
+			return tx.QueryRowContext(ctx,
+				query,
+				payment.GuestID,
+				payment.Amount,
+				payment.PaymentDate,
+				payment.PaymentMethod,
+				payment.ID,
+			).Scan(&payment.Version)
+		})
+	})
+}
+
+// DeletePayment soft-deletes the payment
+func DeletePayment(ctx context.Context, id int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `UPDATE payments SET deleted_at = NOW(), version = version + 1 WHERE id = $1 AND deleted_at IS NULL`
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		return audited(ctx, tx, ActionDelete, "payments", &id, func() error {
+			res, err := tx.ExecContext(ctx, query, id)
+			if err != nil {
+				return err
+			}
+			return expectRow(res)
+		})
+	})
 }
 
-func DeletePayment(id int) error {
-	query := `DELETE FROM payments WHERE id = $1`
-	_, err := DB.Exec(query, id)
-	return err
+// RestorePayment clears the payment's deleted_at
+func RestorePayment(ctx context.Context, id int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `UPDATE payments SET deleted_at = NULL, version = version + 1 WHERE id = $1 AND deleted_at IS NOT NULL`
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		return audited(ctx, tx, ActionRestore, "payments", &id, func() error {
+			res, err := tx.ExecContext(ctx, query, id)
+			if err != nil {
+				return err
+			}
+			return expectRow(res)
+		})
+	})
 }
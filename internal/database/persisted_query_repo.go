@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"pg-management-system/internal/models"
+)
+
+const persistedQueryColumns = `hash, query, operation_name, allowlisted, created_at`
+
+// GetPersistedQuery looks a query up by hash, returning sql.ErrNoRows when it is unknown
+func GetPersistedQuery(ctx context.Context, hash string) (*models.PersistedQuery, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var q models.PersistedQuery
+	err := readRow(ctx, `SELECT `+persistedQueryColumns+` FROM persisted_queries WHERE hash = $1`, []any{hash},
+		&q.Hash, &q.Query, &q.OperationName, &q.Allowlisted, &q.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
+
+// SavePersistedQuery stores the query. Saving an existing hash can allowlist it but
+// never takes an allowlisting away.
+func SavePersistedQuery(ctx context.Context, q *models.PersistedQuery) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `INSERT INTO persisted_queries (hash, query, operation_name, allowlisted)
+			  VALUES ($1, $2, $3, $4)
+			  ON CONFLICT (hash) DO UPDATE SET
+			      allowlisted = persisted_queries.allowlisted OR EXCLUDED.allowlisted,
+			      operation_name = COALESCE(NULLIF(EXCLUDED.operation_name, ''), persisted_queries.operation_name)
+			  RETURNING allowlisted, created_at`
+
+	return DB.QueryRowContext(ctx, query, q.Hash, q.Query, q.OperationName, q.Allowlisted).Scan(&q.Allowlisted, &q.CreatedAt)
+}
+
+// RegisterPersistedQuery stores a query a client registered by sending it with its
+// hash, unless there are already total such queries or perUser from userID. It
+// reports whether the query was stored; an existing hash is left as it is.
+func RegisterPersistedQuery(ctx context.Context, q *models.PersistedQuery, userID, perUser, total int) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `INSERT INTO persisted_queries (hash, query, operation_name, registered_by)
+			  SELECT $1, $2, $3, NULLIF($4, 0)
+			  WHERE (SELECT COUNT(*) FROM persisted_queries WHERE NOT allowlisted) < $5
+			    AND (SELECT COUNT(*) FROM persisted_queries WHERE NOT allowlisted AND registered_by = $4) < $6
+			  ON CONFLICT (hash) DO NOTHING
+			  RETURNING created_at`
+
+	err := DB.QueryRowContext(ctx, query, q.Hash, q.Query, q.OperationName, userID, total, perUser).Scan(&q.CreatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// GetPersistedQueries lists stored queries, oldest first
+func GetPersistedQueries(ctx context.Context, allowlistedOnly bool) ([]models.PersistedQuery, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT ` + persistedQueryColumns + ` FROM persisted_queries`
+	if allowlistedOnly {
+		query += ` WHERE allowlisted`
+	}
+	rows, err := readQuery(ctx, query+` ORDER BY created_at, hash`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	queries := []models.PersistedQuery{}
+	for rows.Next() {
+		var q models.PersistedQuery
+		if err := rows.Scan(&q.Hash, &q.Query, &q.OperationName, &q.Allowlisted, &q.CreatedAt); err != nil {
+			return nil, err
+		}
+		queries = append(queries, q)
+	}
+	return queries, rows.Err()
+}
+
+// DeletePersistedQuery removes a query so it can no longer run by hash
+func DeletePersistedQuery(ctx context.Context, hash string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	res, err := DB.ExecContext(ctx, `DELETE FROM persisted_queries WHERE hash = $1`, hash)
+	if err != nil {
+		return err
+	}
+	return expectRow(res)
+}
@@ -0,0 +1,54 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"pg-management-system/internal/models"
+)
+
+func TestRegisterPersistedQueryLimits(t *testing.T) {
+	useTestDB(t)
+	ctx := context.Background()
+	userID := int(time.Now().UnixNano() % 1_000_000_000)
+
+	var hashes []string
+	t.Cleanup(func() {
+		for _, h := range hashes {
+			DeletePersistedQuery(context.Background(), h)
+		}
+	})
+	register := func(n int) bool {
+		t.Helper()
+		q := &models.PersistedQuery{Hash: fmt.Sprintf("test-%d-%d", userID, n), Query: fmt.Sprintf("{ q%d: rooms { id } }", n)}
+		hashes = append(hashes, q.Hash)
+		stored, err := RegisterPersistedQuery(ctx, q, userID, 2, 1<<30)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stored
+	}
+
+	if !register(1) || !register(2) {
+		t.Fatal("registrations under the per-user limit were refused")
+	}
+	if register(3) {
+		t.Error("registration past the per-user limit was stored")
+	}
+	if _, err := GetPersistedQuery(ctx, hashes[2]); err == nil {
+		t.Error("refused registration is in the table")
+	}
+
+	// Re-sending a known hash stores nothing new
+	stored, err := RegisterPersistedQuery(ctx, &models.PersistedQuery{Hash: hashes[0], Query: "{ rooms { id } }"}, userID, 10, 1<<30)
+	if err != nil || stored {
+		t.Errorf("re-registering = %v, %v, want false", stored, err)
+	}
+
+	// The total limit applies to everyone
+	if stored, err := RegisterPersistedQuery(ctx, &models.PersistedQuery{Hash: fmt.Sprintf("test-%d-other", userID), Query: "{ x }"}, userID+1, 10, 0); err != nil || stored {
+		t.Errorf("registration past the total limit = %v, %v", stored, err)
+	}
+}
@@ -0,0 +1,359 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"pg-management-system/internal/models"
+	"pg-management-system/internal/pii"
+
+	"github.com/lib/pq"
+)
+
+// sealGuest returns guest's email and phone as stored, and the blind index that
+// stands in for the email in lookups and the unique constraint
+func sealGuest(guest *models.Guest) (email, phone, emailIndex string, err error) {
+	ring, err := pii.Default()
+	if err != nil {
+		return "", "", "", err
+	}
+	if email, err = ring.Encrypt(pii.GuestEmail, guest.Email); err != nil {
+		return "", "", "", err
+	}
+	if phone, err = ring.Encrypt(pii.GuestPhone, guest.Phone); err != nil {
+		return "", "", "", err
+	}
+	return email, phone, ring.Index(pii.GuestEmail, guest.Email), nil
+}
+
+// openGuest decrypts a guest's email and phone in place after a read
+func openGuest(guest *models.Guest) error {
+	ring, err := pii.Default()
+	if err != nil {
+		return err
+	}
+	if guest.Email, err = ring.Decrypt(pii.GuestEmail, guest.Email); err != nil {
+		return err
+	}
+	guest.Phone, err = ring.Decrypt(pii.GuestPhone, guest.Phone)
+	return err
+}
+
+// guestEmailIndex is the blind index to look a guest up by email
+func guestEmailIndex(email string) (string, error) {
+	ring, err := pii.Default()
+	if err != nil {
+		return "", err
+	}
+	return ring.Index(pii.GuestEmail, email), nil
+}
+
+func sealField(field, value string) (string, error) {
+	ring, err := pii.Default()
+	if err != nil {
+		return "", err
+	}
+	return ring.Encrypt(field, value)
+}
+
+func openField(field, value string) (string, error) {
+	ring, err := pii.Default()
+	if err != nil {
+		return "", err
+	}
+	return ring.Decrypt(field, value)
+}
+
+// protectedColumn is a column holding encrypted personal data. index names the
+// column keeping its blind index, if it has one.
+type protectedColumn struct {
+	table, column, field, index string
+}
+
+var protectedColumns = []protectedColumn{
+	{"guests", "email", pii.GuestEmail, "email_bidx"},
+	{"guests", "phone", pii.GuestPhone, ""},
+	{"guest_documents", "doc_number", pii.DocumentNumber, ""},
+}
+
+// snapshotIndex names the key holding the column's blind index in audit snapshots
+func (c protectedColumn) snapshotIndex() string {
+	if c.index != "" {
+		return c.index
+	}
+	return c.column + "_bidx"
+}
+
+// redactSnapshot replaces the personal data in an audit snapshot of a table row
+// with its masked plaintext and blind index. Ciphertext differs on every write, so
+// it would make every update look like a change to these columns, while the index
+// only changes with the value; masking keeps the log free of readable PII. Values
+// that are neither encrypted nor missing their index have been redacted already.
+// It reports whether row changed.
+func redactSnapshot(table string, row json.RawMessage) (json.RawMessage, bool, error) {
+	if len(row) == 0 {
+		return row, false, nil
+	}
+	var cols []protectedColumn
+	for _, col := range protectedColumns {
+		if col.table == table {
+			cols = append(cols, col)
+		}
+	}
+	if len(cols) == 0 {
+		return row, false, nil
+	}
+
+	ring, err := pii.Default()
+	if err != nil {
+		return nil, false, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(row))
+	dec.UseNumber()
+	var fields map[string]any
+	if err := dec.Decode(&fields); err != nil {
+		return nil, false, err
+	}
+
+	changed := false
+	for _, col := range cols {
+		value, _ := fields[col.column].(string)
+		_, indexed := fields[col.snapshotIndex()].(string)
+		if value == "" || (indexed && !pii.IsEncrypted(value)) {
+			continue
+		}
+		plain, err := ring.Decrypt(col.field, value)
+		if err != nil {
+			return nil, false, err
+		}
+		fields[col.column] = pii.Mask(col.field, plain)
+		fields[col.snapshotIndex()] = ring.Index(col.field, plain)
+		changed = true
+	}
+	if !changed {
+		return row, false, nil
+	}
+	redacted, err := json.Marshal(fields)
+	return redacted, true, err
+}
+
+// redactAuditLog redacts audit entries written before snapshots were masked, which
+// hold personal data as plaintext or ciphertext. It returns the entries changed.
+func redactAuditLog(ctx context.Context) (int, error) {
+	tables := map[string]bool{}
+	for _, col := range protectedColumns {
+		tables[col.table] = true
+	}
+	entities := make([]string, 0, len(tables))
+	for table := range tables {
+		entities = append(entities, table)
+	}
+
+	total, after := 0, 0
+	for {
+		n, last, err := redactAuditBatch(ctx, entities, after)
+		if err != nil {
+			return total, fmt.Errorf("audit_log: %w", err)
+		}
+		total += n
+		if last == 0 {
+			return total, nil
+		}
+		after = last
+	}
+}
+
+// redactAuditBatch redacts the next batch of entries after id after, returning the
+// number changed and the last id seen, or 0 when there were none left
+func redactAuditBatch(ctx context.Context, entities []string, after int) (int, int, error) {
+	n, last := 0, 0
+	err := WithTx(ctx, func(tx *sql.Tx) error {
+		n, last = 0, 0
+		rows, err := tx.QueryContext(ctx, `
+			SELECT id, entity, before, after FROM audit_log
+			WHERE entity = ANY($1) AND id > $2 ORDER BY id LIMIT $3 FOR UPDATE`,
+			pq.Array(entities), after, protectBatchSize)
+		if err != nil {
+			return err
+		}
+		type entry struct {
+			id            int
+			entity        string
+			before, after []byte
+		}
+		var batch []entry
+		for rows.Next() {
+			var e entry
+			if err := rows.Scan(&e.id, &e.entity, &e.before, &e.after); err != nil {
+				rows.Close()
+				return err
+			}
+			batch = append(batch, e)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, e := range batch {
+			last = e.id
+			redactedBefore, beforeChanged, err := redactSnapshot(e.entity, e.before)
+			if err != nil {
+				return fmt.Errorf("id %d: %w", e.id, err)
+			}
+			redactedAfter, afterChanged, err := redactSnapshot(e.entity, e.after)
+			if err != nil {
+				return fmt.Errorf("id %d: %w", e.id, err)
+			}
+			if !beforeChanged && !afterChanged {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, `UPDATE audit_log SET before = $2, after = $3 WHERE id = $1`,
+				e.id, nullJSON(redactedBefore), nullJSON(redactedAfter)); err != nil {
+				return fmt.Errorf("id %d: %w", e.id, err)
+			}
+			n++
+		}
+		return nil
+	})
+	return n, last, err
+}
+
+const protectBatchSize = 500
+
+// ProtectPII encrypts personal data still stored as plaintext, fills missing
+// blind indexes and masks personal data left in older audit entries. With rewrap
+// it also moves values wrapped with an older master key to the active one, which
+// is how a key is retired. Rows are updated in batches without touching their
+// version or the audit log, since the data itself does not change. It returns the
+// number of values and audit entries updated.
+func ProtectPII(ctx context.Context, rewrap bool) (int, error) {
+	ring, err := pii.Default()
+	if err != nil {
+		return 0, err
+	}
+	pattern := "enc:v1:%"
+	if rewrap {
+		pattern = "enc:v1:" + ring.ActiveKey() + ":%"
+	}
+
+	total := 0
+	for _, col := range protectedColumns {
+		for {
+			n, err := protectBatch(ctx, ring, col, pattern)
+			if err != nil {
+				return total, fmt.Errorf("%s.%s: %w", col.table, col.column, err)
+			}
+			total += n
+			if n < protectBatchSize {
+				break
+			}
+		}
+	}
+	n, err := redactAuditLog(ctx)
+	return total + n, err
+}
+
+func protectBatch(ctx context.Context, ring *pii.Keyring, col protectedColumn, pattern string) (int, error) {
+	pending := `(COALESCE(` + col.column + `, '') <> '' AND ` + col.column + ` NOT LIKE $1)`
+	set := col.column + ` = $2`
+	if col.index != "" {
+		pending += ` OR ` + col.index + ` IS NULL`
+		set += `, ` + col.index + ` = $3`
+	}
+
+	n := 0
+	err := WithTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx,
+			`SELECT id, COALESCE(`+col.column+`, '') FROM `+col.table+` WHERE `+pending+` ORDER BY id LIMIT $2 FOR UPDATE`,
+			pattern, protectBatchSize)
+		if err != nil {
+			return err
+		}
+		type value struct {
+			id     int
+			stored string
+		}
+		var batch []value
+		for rows.Next() {
+			var v value
+			if err := rows.Scan(&v.id, &v.stored); err != nil {
+				rows.Close()
+				return err
+			}
+			batch = append(batch, v)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		update := `UPDATE ` + col.table + ` SET ` + set + ` WHERE id = $1`
+		for _, v := range batch {
+			sealed, _, err := ring.Rewrap(col.field, v.stored)
+			if err != nil {
+				return fmt.Errorf("id %d: %w", v.id, err)
+			}
+			args := []any{v.id, sealed}
+			if col.index != "" {
+				plain, err := ring.Decrypt(col.field, v.stored)
+				if err != nil {
+					return fmt.Errorf("id %d: %w", v.id, err)
+				}
+				args = append(args, ring.Index(col.field, plain))
+			}
+			if _, err := tx.ExecContext(ctx, update, args...); err != nil {
+				return fmt.Errorf("id %d: %w", v.id, err)
+			}
+		}
+		n = len(batch)
+		return nil
+	})
+	return n, err
+}
+
+// PIIKeyUsage counts the values of a protected column by how they are stored: the
+// id of the master key they are wrapped with, "plaintext" or "empty"
+type PIIKeyUsage struct {
+	Column string
+	Key    string
+	Values int
+}
+
+// GetPIIKeyUsage reports which master keys are still in use, so a retired key is
+// only removed from PII_KEYS once nothing is wrapped with it
+func GetPIIKeyUsage(ctx context.Context) ([]PIIKeyUsage, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var usage []PIIKeyUsage
+	for _, col := range protectedColumns {
+		query := `
+			SELECT CASE
+				WHEN COALESCE(` + col.column + `, '') = '' THEN 'empty'
+				WHEN ` + col.column + ` LIKE 'enc:v1:%' THEN split_part(` + col.column + `, ':', 3)
+				ELSE 'plaintext' END AS key,
+				COUNT(*)
+			FROM ` + col.table + ` GROUP BY 1 ORDER BY 1`
+		rows, err := DB.QueryContext(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			u := PIIKeyUsage{Column: col.table + "." + col.column}
+			if err := rows.Scan(&u.Key, &u.Values); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			usage = append(usage, u)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return usage, nil
+}
@@ -0,0 +1,130 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"pg-management-system/internal/models"
+	"pg-management-system/internal/pii"
+)
+
+// guestSnapshot is a guests row as row_to_json returns it
+func guestSnapshot(t *testing.T, name, email, phone string) json.RawMessage {
+	t.Helper()
+	sealedEmail, sealedPhone, emailIndex, err := sealGuest(&models.Guest{Email: email, Phone: phone})
+	if err != nil {
+		t.Fatal(err)
+	}
+	row, _ := json.Marshal(map[string]any{
+		"id": 7, "name": name, "email": sealedEmail, "phone": sealedPhone, "email_bidx": emailIndex, "version": 2,
+	})
+	return row
+}
+
+func decodeSnapshot(t *testing.T, row json.RawMessage) map[string]any {
+	t.Helper()
+	var fields map[string]any
+	if err := json.Unmarshal(row, &fields); err != nil {
+		t.Fatal(err)
+	}
+	return fields
+}
+
+func TestAuditSnapshotsMaskPersonalData(t *testing.T) {
+	usePIIKeys()
+
+	first, changed, err := redactSnapshot("guests", guestSnapshot(t, "Asha", "asha@example.com", "9876543210"))
+	if err != nil || !changed {
+		t.Fatalf("redactSnapshot = %v, %v", changed, err)
+	}
+	fields := decodeSnapshot(t, first)
+	if fields["email"] != "a***@example.com" || fields["phone"] != "******3210" {
+		t.Errorf("snapshot keeps %v, %v", fields["email"], fields["phone"])
+	}
+	if fields["phone_bidx"] == nil || fields["phone_bidx"] == fields["email_bidx"] {
+		t.Errorf("snapshot indexes are %v, %v", fields["email_bidx"], fields["phone_bidx"])
+	}
+
+	// The same values sealed again must give the same snapshot, so an update that
+	// leaves them alone does not show them as changed
+	second, _, err := redactSnapshot("guests", guestSnapshot(t, "Asha", "asha@example.com", "9876543210"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(first) != string(second) {
+		t.Errorf("snapshots of unchanged values differ:\n%s\n%s", first, second)
+	}
+
+	// A changed phone with the same mask still shows up through its index
+	other, _, err := redactSnapshot("guests", guestSnapshot(t, "Asha", "asha@example.com", "9000003210"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decodeSnapshot(t, other)["phone_bidx"] == fields["phone_bidx"] {
+		t.Error("a changed phone keeps its index")
+	}
+
+	if again, changed, err := redactSnapshot("guests", first); err != nil || changed || string(again) != string(first) {
+		t.Errorf("redacting twice changed the snapshot: %v, %v", changed, err)
+	}
+}
+
+func TestAuditSnapshotsRedactLegacyPlaintext(t *testing.T) {
+	usePIIKeys()
+
+	// Entries written before encryption hold plaintext and no index
+	legacy := json.RawMessage(`{"id": 3, "email": "old@example.com", "phone": "9123456789", "price": 5000.50}`)
+	row, changed, err := redactSnapshot("guests", legacy)
+	if err != nil || !changed {
+		t.Fatalf("redactSnapshot = %v, %v", changed, err)
+	}
+	fields := decodeSnapshot(t, row)
+	if fields["email"] != "o***@example.com" || fields["phone"] != "******6789" {
+		t.Errorf("legacy snapshot keeps %v, %v", fields["email"], fields["phone"])
+	}
+	if fields["price"] != 5000.5 {
+		t.Errorf("price = %v", fields["price"])
+	}
+
+	rooms := json.RawMessage(`{"id": 1, "room_number": "101"}`)
+	if row, changed, err := redactSnapshot("rooms", rooms); err != nil || changed || string(row) != string(rooms) {
+		t.Errorf("rooms snapshot changed: %s, %v", row, err)
+	}
+}
+
+func TestGuestUpdateAuditShowsOnlyChangedFields(t *testing.T) {
+	useTestDB(t)
+	ctx := context.Background()
+
+	room := models.Room{RoomNumber: uniqueName("A"), Capacity: 2, Price: 5000}
+	if err := CreateRoom(ctx, &room); err != nil {
+		t.Fatal(err)
+	}
+	guest := models.Guest{Name: "Before", Email: fmt.Sprintf("%s@example.com", uniqueName("audit")), Phone: "9876543210", RoomID: room.ID}
+	if err := CreateGuest(ctx, &guest); err != nil {
+		t.Fatal(err)
+	}
+	guest.Name = "After"
+	if err := UpdateGuest(ctx, guest.ID, &guest); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := GetAuditLog(WithPrimary(ctx), AuditFilter{Entity: "guests", EntityID: guest.ID, Limit: 1})
+	if err != nil || len(entries) != 1 || entries[0].Action != ActionUpdate {
+		t.Fatalf("GetAuditLog = %+v, %v", entries, err)
+	}
+	before, after := decodeSnapshot(t, entries[0].Before), decodeSnapshot(t, entries[0].After)
+	for _, key := range []string{"email", "email_bidx", "phone", "phone_bidx"} {
+		if before[key] != after[key] {
+			t.Errorf("%s changed from %v to %v", key, before[key], after[key])
+		}
+	}
+	if before["name"] == after["name"] {
+		t.Error("name change is missing")
+	}
+	if email, _ := after["email"].(string); pii.IsEncrypted(email) || email == guest.Email {
+		t.Errorf("audit entry stores email as %q", email)
+	}
+}
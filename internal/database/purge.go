@@ -0,0 +1,63 @@
+package database
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// PurgeDeleted permanently removes rows soft-deleted before the cutoff. Children are
+// purged first; a parent that is still referenced by a live row is kept. Guests with
+// ID documents on file are kept too, since those must be retained until removed, and
+// so are past residents, who checked out rather than being deleted.
+func PurgeDeleted(ctx context.Context, cutoff time.Time) (int64, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	statements := []string{
+		`DELETE FROM payments WHERE deleted_at < $1`,
+		`DELETE FROM guests WHERE deleted_at < $1 AND left_at IS NULL
+		 AND NOT EXISTS (SELECT 1 FROM payments WHERE payments.guest_id = guests.id)
+		 AND NOT EXISTS (SELECT 1 FROM guest_documents WHERE guest_documents.guest_id = guests.id)`,
+		`DELETE FROM rooms WHERE deleted_at < $1
+		 AND NOT EXISTS (SELECT 1 FROM guests WHERE guests.room_id = rooms.id)`,
+	}
+
+	var total int64
+	for _, stmt := range statements {
+		res, err := DB.ExecContext(ctx, stmt, cutoff)
+		if err != nil {
+			return total, err
+		}
+		count, err := res.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += count
+	}
+	return total, nil
+}
+
+// StartPurgeJob runs PurgeDeleted every interval for records deleted longer than retention ago,
+// until ctx is cancelled
+func StartPurgeJob(ctx context.Context, retention, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			count, err := PurgeDeleted(WithQueryTimeout(ctx, 0), time.Now().Add(-retention))
+			if err != nil {
+				log.Printf("Warning: purge of deleted records failed: %v", err)
+			} else if count > 0 {
+				log.Printf("Purged %d records deleted more than %v ago", count, retention)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"os"
+)
+
+// Replica is an optional read-only pool. Read repository calls prefer it when set;
+// writes always go to DB.
+var Replica *sql.DB
+
+type primaryKey struct{}
+
+// connectReplica opens DATABASE_REPLICA_URL (or DB_REPLICA_URL) if configured.
+// An unreachable replica is logged and skipped so the service still starts on the primary.
+func connectReplica() {
+	rawURL := os.Getenv("DATABASE_REPLICA_URL")
+	if rawURL == "" {
+		rawURL = os.Getenv("DB_REPLICA_URL")
+	}
+	if rawURL == "" {
+		return
+	}
+
+	cfg := LoadConfig()
+	dsn, err := withTLSParams(rawURL)
+	if err != nil {
+		log.Printf("Warning: invalid replica URL, reads will use the primary: %v", err)
+		return
+	}
+	cfg.DSN = dsn
+	cfg.ConnectRetries = 0
+
+	db, err := Open(cfg)
+	if err != nil {
+		log.Printf("Warning: read replica unavailable, reads will use the primary: %v", err)
+		return
+	}
+	Replica = db
+	log.Println("Connected to read replica successfully!")
+}
+
+// WithPrimary marks ctx so read repository calls made with it go to the primary,
+// giving read-your-writes consistency for the rest of the request.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+func useReplica(ctx context.Context) bool {
+	if Replica == nil {
+		return false
+	}
+	forced, _ := ctx.Value(primaryKey{}).(bool)
+	return !forced
+}
+
+// readQuery runs a multi-row read on the replica, falling back to the primary if the replica fails
+func readQuery(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if useReplica(ctx) {
+		rows, err := Replica.QueryContext(ctx, query, args...)
+		if err == nil || !shouldFallback(ctx, err) {
+			return rows, err
+		}
+		log.Printf("Warning: replica query failed, retrying on primary: %v", err)
+	}
+	return DB.QueryContext(ctx, query, args...)
+}
+
+// readRow runs a single-row read and scans it into dest, with the same fallback as readQuery
+func readRow(ctx context.Context, query string, args []any, dest ...any) error {
+	if useReplica(ctx) {
+		err := Replica.QueryRowContext(ctx, query, args...).Scan(dest...)
+		if err == nil || !shouldFallback(ctx, err) {
+			return err
+		}
+		log.Printf("Warning: replica query failed, retrying on primary: %v", err)
+	}
+	return DB.QueryRowContext(ctx, query, args...).Scan(dest...)
+}
+
+// shouldFallback reports whether a replica error is worth retrying on the primary.
+// Missing rows and expired contexts would fail the same way there.
+func shouldFallback(ctx context.Context, err error) bool {
+	return err != sql.ErrNoRows && ctx.Err() == nil
+}
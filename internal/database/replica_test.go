@@ -0,0 +1,177 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+)
+
+// routingDriver answers every query with the name of the pool it was sent to, the
+// DSN it was opened with. A pool can be made to fail or to find nothing.
+type routingDriver struct {
+	mu      sync.Mutex
+	queries map[string]int
+	failing map[string]bool
+	empty   map[string]bool
+}
+
+var routing = &routingDriver{}
+
+func init() {
+	sql.Register("routing", routing)
+}
+
+func (d *routingDriver) Open(name string) (driver.Conn, error) { return routingConn{d, name}, nil }
+
+type routingConn struct {
+	d    *routingDriver
+	name string
+}
+
+func (c routingConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c routingConn) Close() error                        { return nil }
+func (c routingConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (c routingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.queries[c.name]++
+	if c.d.failing[c.name] {
+		return nil, errors.New("connection refused")
+	}
+	rows := &sourceRows{}
+	if !c.d.empty[c.name] {
+		rows.source = []string{c.name}
+	}
+	return rows, nil
+}
+
+type sourceRows struct{ source []string }
+
+func (r *sourceRows) Columns() []string { return []string{"source"} }
+func (r *sourceRows) Close() error      { return nil }
+
+func (r *sourceRows) Next(dest []driver.Value) error {
+	if len(r.source) == 0 {
+		return io.EOF
+	}
+	dest[0], r.source = r.source[0], r.source[1:]
+	return nil
+}
+
+// useRouting points DB and Replica at the routing driver; withReplica false leaves
+// Replica unset as when DATABASE_REPLICA_URL is not configured
+func useRouting(t *testing.T, withReplica bool) {
+	t.Helper()
+	routing.mu.Lock()
+	routing.queries, routing.failing, routing.empty = map[string]int{}, map[string]bool{}, map[string]bool{}
+	routing.mu.Unlock()
+
+	prevDB, prevReplica := DB, Replica
+	DB, _ = sql.Open("routing", "primary")
+	Replica = nil
+	if withReplica {
+		Replica, _ = sql.Open("routing", "replica")
+	}
+	t.Cleanup(func() {
+		DB.Close()
+		if Replica != nil {
+			Replica.Close()
+		}
+		DB, Replica = prevDB, prevReplica
+	})
+}
+
+func TestUseReplica(t *testing.T) {
+	ctx := context.Background()
+
+	useRouting(t, false)
+	if useReplica(ctx) {
+		t.Error("reads go to a replica that is not configured")
+	}
+
+	useRouting(t, true)
+	if !useReplica(ctx) {
+		t.Error("reads do not go to the replica")
+	}
+	if useReplica(WithPrimary(ctx)) {
+		t.Error("WithPrimary reads go to the replica")
+	}
+	if useReplica(context.WithValue(WithPrimary(ctx), timeoutKey{}, 0)) {
+		t.Error("WithPrimary is lost by a derived context")
+	}
+}
+
+func TestReadRouting(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name        string
+		withReplica bool
+		ctx         context.Context
+		failing     string
+		empty       string
+		// want is the pool that answers, or "" when the read fails; queries counts
+		// what each pool was sent
+		want    string
+		queries map[string]int
+	}{
+		{"no replica", false, context.Background(), "", "", "primary", map[string]int{"primary": 1}},
+		{"replica", true, context.Background(), "", "", "replica", map[string]int{"replica": 1}},
+		{"WithPrimary", true, WithPrimary(context.Background()), "", "", "primary", map[string]int{"primary": 1}},
+		{"failing replica falls back", true, context.Background(), "replica", "", "primary", map[string]int{"replica": 1, "primary": 1}},
+		{"failing primary does not try the replica", true, WithPrimary(context.Background()), "primary", "", "", map[string]int{"primary": 1}},
+		{"missing row is not retried", true, context.Background(), "", "replica", "", map[string]int{"replica": 1}},
+		{"canceled request is not retried", true, canceled, "", "", "", map[string]int{}},
+	}
+	for _, tt := range tests {
+		for _, read := range []struct {
+			name string
+			fn   func(ctx context.Context) (string, error)
+		}{
+			{"readRow", func(ctx context.Context) (string, error) {
+				var source string
+				err := readRow(ctx, "SELECT source", nil, &source)
+				return source, err
+			}},
+			{"readQuery", func(ctx context.Context) (string, error) {
+				rows, err := readQuery(ctx, "SELECT source")
+				if err != nil {
+					return "", err
+				}
+				defer rows.Close()
+				if !rows.Next() {
+					return "", sql.ErrNoRows
+				}
+				var source string
+				return source, rows.Scan(&source)
+			}},
+		} {
+			t.Run(read.name+"/"+tt.name, func(t *testing.T) {
+				useRouting(t, tt.withReplica)
+				routing.failing[tt.failing] = tt.failing != ""
+				routing.empty[tt.empty] = tt.empty != ""
+
+				got, err := read.fn(tt.ctx)
+				if tt.want == "" && err == nil {
+					t.Errorf("read from %s, want an error", got)
+				}
+				if tt.want != "" && (err != nil || got != tt.want) {
+					t.Errorf("read from %q (%v), want %s", got, err, tt.want)
+				}
+				routing.mu.Lock()
+				defer routing.mu.Unlock()
+				for _, pool := range []string{"primary", "replica"} {
+					if routing.queries[pool] != tt.queries[pool] {
+						t.Errorf("%s got %d queries, want %d", pool, routing.queries[pool], tt.queries[pool])
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package database
+
+import (
+	"context"
+
+	"pg-management-system/internal/models"
+)
+
+// EachMonthlyPayments calls fn for each month and payment method in the period, oldest first
+func EachMonthlyPayments(ctx context.Context, filter ListFilter, period Period, fn func(*models.MonthlyPayments) error) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	where, args := period.where(filter, "payment_date")
+	query := `
+		SELECT to_char(date_trunc('month', payment_date), 'YYYY-MM') AS month,
+		       payment_method, COUNT(*), COALESCE(SUM(amount), 0)
+		FROM payments
+	` + where + `
+		GROUP BY 1, 2
+		ORDER BY 1, 2
+	`
+
+	rows, err := readQuery(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m models.MonthlyPayments
+		if err := rows.Scan(&m.Month, &m.PaymentMethod, &m.Payments, &m.Total); err != nil {
+			return err
+		}
+		if err := fn(&m); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
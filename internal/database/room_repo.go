@@ -1,78 +1,194 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"pg-management-system/internal/events"
 	"pg-management-system/internal/models"
 )
 
-func CreateRoom(room *models.Room) error {
+var (
+	// ErrRoomOccupied is returned when deleting a room that still has active guests
+	ErrRoomOccupied = errors.New("room still has active guests")
+	// ErrCapacityBelowGuests is returned when a room's capacity would not fit its active guests
+	ErrCapacityBelowGuests = errors.New("capacity is below the number of active guests")
+)
+
+const roomColumns = `id, room_number, capacity, occupancy, price, deleted_at, version`
+
+func scanRoom(row interface{ Scan(...any) error }, room *models.Room) error {
+	return row.Scan(&room.ID, &room.RoomNumber, &room.Capacity, &room.Occupancy, &room.Price, &room.DeletedAt, &room.Version)
+}
+
+func CreateRoom(ctx context.Context, room *models.Room) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		return createRoomTx(ctx, tx, room)
+	})
+}
+
+func createRoomTx(ctx context.Context, tx *sql.Tx, room *models.Room) error {
 	query := `INSERT INTO rooms (room_number, capacity, occupancy, price) 
-			  VALUES ($1, $2, $3, $4) RETURNING id`
-	
-	return DB.QueryRow(query, room.RoomNumber, room.Capacity, room.Occupancy, room.Price).Scan(&room.ID)
+			  VALUES ($1, $2, $3, $4) RETURNING id, version`
+
+	// A new room has no guests; occupancy only changes as they check in and out
+	room.Occupancy = 0
+
+	return audited(ctx, tx, ActionCreate, "rooms", &room.ID, func() error {
+		return tx.QueryRowContext(ctx, query, room.RoomNumber, room.Capacity, room.Occupancy, room.Price).Scan(&room.ID, &room.Version)
+	})
 }
 
-func GetRoomByID(id int) (*models.Room, error) {
+func GetRoomByID(ctx context.Context, id int) (*models.Room, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	room := &models.Room{}
-	query := `SELECT id, room_number, capacity, occupancy, price FROM rooms WHERE id = $1`
-	
-	err := DB.QueryRow(query, id).Scan(&room.ID, &room.RoomNumber, &room.Capacity, &room.Occupancy, &room.Price)
+	query := `SELECT ` + roomColumns + ` FROM rooms WHERE id = $1 AND deleted_at IS NULL`
+
+	err := readRow(ctx, query, []any{id}, &room.ID, &room.RoomNumber, &room.Capacity, &room.Occupancy, &room.Price, &room.DeletedAt, &room.Version)
 	if err != nil {
 		return nil, err
 	}
 	return room, nil
 }
 
-func GetAllRooms() ([]models.Room, error) {
-	rows, err := DB.Query(`SELECT id, room_number, capacity, occupancy, price FROM rooms`)
+func GetAllRooms(ctx context.Context, filter ListFilter) ([]models.Room, error) {
+	rooms := []models.Room{}
+	err := EachRoom(ctx, filter, func(room *models.Room) error {
+		rooms = append(rooms, *room)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	return rooms, nil
+}
+
+// EachRoom calls fn for every room as it is read, without buffering the result set
+func EachRoom(ctx context.Context, filter ListFilter, fn func(*models.Room) error) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := readQuery(ctx, `SELECT `+roomColumns+` FROM rooms`+filter.whereClause()+` ORDER BY id`)
+	if err != nil {
+		return err
+	}
 	defer rows.Close()
 
-	var rooms []models.Room
 	for rows.Next() {
 		var room models.Room
-		if err := rows.Scan(&room.ID, &room.RoomNumber, &room.Capacity, &room.Occupancy, &room.Price); err != nil {
-			return nil, err
+		if err := scanRoom(rows, &room); err != nil {
+			return err
+		}
+		if err := fn(&room); err != nil {
+			return err
 		}
-		rooms = append(rooms, room)
 	}
-	return rooms, nil
+	return rows.Err()
 }
 
-func UpdateRoom(id int, room *models.Room) error {
-	query := `UPDATE rooms SET room_number=$1, capacity=$2, occupancy=$3, price=$4 WHERE id=$5`
-	
-	res, err := DB.Exec(query, room.RoomNumber, room.Capacity, room.Occupancy, room.Price, id)
-	if err != nil {
-		return err
-	}
-	
-	count, err := res.RowsAffected()
-	if err != nil {
-		return err
-	}
-	if count == 0 {
-		return sql.ErrNoRows
-	}
-	return nil
+// UpdateRoom overwrites the room's number, capacity and price. A non-zero room.Version must
+// match the stored version, otherwise ErrVersionConflict is returned. room.Version is set
+// to the new version and room.Occupancy to the room's active guests.
+func UpdateRoom(ctx context.Context, id int, room *models.Room) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		return updateRoomTx(ctx, tx, id, room)
+	})
 }
 
-func DeleteRoom(id int) error {
-	query := `DELETE FROM rooms WHERE id=$1`
-	
-	res, err := DB.Exec(query, id)
-	if err != nil {
-		return err
-	}
-	
-	count, err := res.RowsAffected()
-	if err != nil {
-		return err
-	}
-	if count == 0 {
-		return sql.ErrNoRows
-	}
-	return nil
+func updateRoomTx(ctx context.Context, tx *sql.Tx, id int, room *models.Room) error {
+	query := `UPDATE rooms SET room_number=$1, capacity=$2, occupancy=$3, price=$4, version = version + 1
+			  WHERE id=$5 RETURNING version, deleted_at`
+
+	return audited(ctx, tx, ActionUpdate, "rooms", &id, func() error {
+		// The lock keeps check-ins and check-outs out until the new capacity is in place
+		var oldCapacity, oldOccupancy int
+		err := tx.QueryRowContext(ctx, `SELECT capacity, occupancy FROM rooms WHERE id = $1 FOR UPDATE`, id).
+			Scan(&oldCapacity, &oldOccupancy)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(ctx, tx, "rooms", id, room.Version); err != nil {
+			return err
+		}
+
+		// Occupancy belongs to the server: it is recounted rather than taken from the client
+		active, err := activeGuests(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if room.Capacity < active {
+			return ErrCapacityBelowGuests
+		}
+		room.Occupancy = active
+
+		err = tx.QueryRowContext(ctx, query, room.RoomNumber, room.Capacity, room.Occupancy, room.Price, id).
+			Scan(&room.Version, &room.DeletedAt)
+		if err != nil {
+			return err
+		}
+		if oldCapacity != room.Capacity || oldOccupancy != room.Occupancy {
+			changed := *room
+			changed.ID = id
+			afterCommit(tx, func() { events.Publish(events.RoomOccupancyChanged, changed) })
+		}
+		return nil
+	})
+}
+
+// activeGuests counts the guests living in the room
+func activeGuests(ctx context.Context, tx *sql.Tx, roomID int) (int, error) {
+	var n int
+	err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM guests WHERE room_id = $1 AND deleted_at IS NULL`, roomID).Scan(&n)
+	return n, err
+}
+
+// DeleteRoom soft-deletes the room. Rooms with active guests cannot be deleted.
+func DeleteRoom(ctx context.Context, id int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		return audited(ctx, tx, ActionDelete, "rooms", &id, func() error {
+			// Lock the room as reserveBed does, so no guest can check in while it is deleted
+			var locked int
+			err := tx.QueryRowContext(ctx, `SELECT id FROM rooms WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, id).Scan(&locked)
+			if err != nil {
+				return err
+			}
+			active, err := activeGuests(ctx, tx, id)
+			if err != nil {
+				return err
+			}
+			if active > 0 {
+				return ErrRoomOccupied
+			}
+
+			_, err = tx.ExecContext(ctx, `UPDATE rooms SET deleted_at = NOW(), version = version + 1 WHERE id=$1`, id)
+			return err
+		})
+	})
+}
+
+// RestoreRoom clears the room's deleted_at
+func RestoreRoom(ctx context.Context, id int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		return audited(ctx, tx, ActionRestore, "rooms", &id, func() error {
+			res, err := tx.ExecContext(ctx, `UPDATE rooms SET deleted_at = NULL, version = version + 1 WHERE id=$1 AND deleted_at IS NOT NULL`, id)
+			if err != nil {
+				return err
+			}
+			return expectRow(res)
+		})
+	})
 }
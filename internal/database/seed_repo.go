@@ -0,0 +1,64 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"pg-management-system/internal/models"
+)
+
+// SeedData is a complete generated dataset. Guest.RoomID and Payment.GuestID hold
+// indexes into Rooms and Guests; LoadSeed swaps them for the ids the rows receive.
+type SeedData struct {
+	Rooms    []models.Room
+	Guests   []models.Guest
+	Payments []models.Payment
+}
+
+// LoadSeed inserts data in a single transaction. Rows are written as given,
+// including occupancy, deleted_at and left_at, and are not audited since they describe
+// history rather than changes made by anyone.
+func LoadSeed(ctx context.Context, data SeedData) error {
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		roomIDs := make([]int, len(data.Rooms))
+		for i, room := range data.Rooms {
+			err := tx.QueryRowContext(ctx,
+				`INSERT INTO rooms (room_number, capacity, occupancy, price) VALUES ($1, $2, $3, $4) RETURNING id`,
+				room.RoomNumber, room.Capacity, room.Occupancy, room.Price,
+			).Scan(&roomIDs[i])
+			if err != nil {
+				return fmt.Errorf("room %s: %w", room.RoomNumber, err)
+			}
+		}
+
+		guestIDs := make([]int, len(data.Guests))
+		for i, guest := range data.Guests {
+			email, phone, emailIndex, err := sealGuest(&guest)
+			if err != nil {
+				return err
+			}
+			err = tx.QueryRowContext(ctx,
+				`INSERT INTO guests (name, email, phone, email_bidx, room_id, join_date, deleted_at, left_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`,
+				guest.Name, email, phone, emailIndex, roomIDs[guest.RoomID], guest.JoinDate, guest.DeletedAt, guest.LeftAt,
+			).Scan(&guestIDs[i])
+			if err != nil {
+				return fmt.Errorf("guest %s: %w", guest.Email, err)
+			}
+		}
+
+		stmt, err := tx.PrepareContext(ctx,
+			`INSERT INTO payments (guest_id, amount, payment_date, payment_method) VALUES ($1, $2, $3, $4)`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, p := range data.Payments {
+			if _, err := stmt.ExecContext(ctx, guestIDs[p.GuestID], p.Amount, p.PaymentDate, p.PaymentMethod); err != nil {
+				return fmt.Errorf("payment: %w", err)
+			}
+		}
+		return nil
+	})
+}
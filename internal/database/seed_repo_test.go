@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"pg-management-system/internal/models"
+)
+
+func TestPastResidentsAreNotRestoredOrPurged(t *testing.T) {
+	useTestDB(t)
+	ctx := context.Background()
+
+	left := time.Now().AddDate(-1, 0, 0)
+	data := SeedData{
+		Rooms: []models.Room{{RoomNumber: uniqueName("S"), Capacity: 2, Price: 5000}},
+		Guests: []models.Guest{{
+			Name: "Past Resident", Email: uniqueName("past") + "@example.com", Phone: "9876543210",
+			JoinDate: left.AddDate(0, -6, 0), DeletedAt: &left, LeftAt: &left,
+		}},
+	}
+	if err := LoadSeed(ctx, data); err != nil {
+		t.Fatal(err)
+	}
+	var id int
+	if err := DB.QueryRowContext(ctx, `SELECT id FROM guests WHERE left_at IS NOT NULL ORDER BY id DESC LIMIT 1`).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RestoreGuest(ctx, id); !errors.Is(err, ErrGuestLeft) {
+		t.Errorf("RestoreGuest = %v, want ErrGuestLeft", err)
+	}
+	if _, err := PurgeDeleted(ctx, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	var stillThere bool
+	if err := DB.QueryRowContext(ctx, `SELECT deleted_at IS NOT NULL FROM guests WHERE id = $1`, id).Scan(&stillThere); err == sql.ErrNoRows {
+		t.Error("purge removed a past resident")
+	} else if err != nil {
+		t.Fatal(err)
+	} else if !stillThere {
+		t.Error("past resident was restored")
+	}
+}
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+
+	"github.com/lib/pq"
+)
+
+// maxTxAttempts bounds how often a unit of work is retried after a serialization failure or deadlock
+const maxTxAttempts = 3
+
+// WithTx runs fn as a single unit of work. The transaction is committed when fn returns nil
+// and rolled back otherwise. Serialization failures and deadlocks are retried.
+// No query timeout is applied here; callers bound ctx themselves.
+func WithTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	var err error
+	for attempt := 0; attempt < maxTxAttempts; attempt++ {
+		err = runTx(ctx, fn)
+		if !isRetryable(err) {
+			return err
+		}
+	}
+	return err
+}
+
+func runTx(ctx context.Context, fn func(tx *sql.Tx) error) (err error) {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	defer dropCommitHooks(tx)
+	if err = fn(tx); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	runCommitHooks(tx)
+	return nil
+}
+
+var (
+	commitHooksMu sync.Mutex
+	commitHooks   = map[*sql.Tx][]func(){}
+)
+
+// afterCommit runs fn once tx has committed, e.g. to publish an event. It is
+// discarded if tx, or the savepoint it was registered in, rolls back.
+func afterCommit(tx *sql.Tx, fn func()) {
+	commitHooksMu.Lock()
+	defer commitHooksMu.Unlock()
+	commitHooks[tx] = append(commitHooks[tx], fn)
+}
+
+func runCommitHooks(tx *sql.Tx) {
+	commitHooksMu.Lock()
+	hooks := commitHooks[tx]
+	delete(commitHooks, tx)
+	commitHooksMu.Unlock()
+
+	for _, fn := range hooks {
+		fn()
+	}
+}
+
+func dropCommitHooks(tx *sql.Tx) {
+	commitHooksMu.Lock()
+	delete(commitHooks, tx)
+	commitHooksMu.Unlock()
+}
+
+// commitHookMark and dropCommitHooksAfter let a savepoint forget the hooks it registered
+func commitHookMark(tx *sql.Tx) int {
+	commitHooksMu.Lock()
+	defer commitHooksMu.Unlock()
+	return len(commitHooks[tx])
+}
+
+func dropCommitHooksAfter(tx *sql.Tx, mark int) {
+	commitHooksMu.Lock()
+	defer commitHooksMu.Unlock()
+	if hooks := commitHooks[tx]; len(hooks) > mark {
+		commitHooks[tx] = hooks[:mark]
+	}
+}
+
+func isRetryable(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	// serialization_failure, deadlock_detected
+	return pqErr.Code == "40001" || pqErr.Code == "40P01"
+}
+
+// expectRow turns an update that matched nothing into sql.ErrNoRows
+func expectRow(res sql.Result) error {
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Savepoint runs fn inside a savepoint of tx. If fn fails, only its own statements are
+// rolled back and the transaction stays usable.
+func Savepoint(ctx context.Context, tx *sql.Tx, name string, fn func() error) error {
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return err
+	}
+	mark := commitHookMark(tx)
+	if err := fn(); err != nil {
+		dropCommitHooksAfter(tx, mark)
+		if _, rbErr := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name); rbErr != nil {
+			return rbErr
+		}
+		return err
+	}
+	_, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name)
+	return err
+}
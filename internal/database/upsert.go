@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"pg-management-system/internal/models"
+)
+
+// ErrDeletedRecord is returned when an upsert matches a soft-deleted row
+var ErrDeletedRecord = errors.New("matching record is deleted; restore it first")
+
+// UpsertRoomTx creates the room or updates the one with the same room number
+func UpsertRoomTx(ctx context.Context, tx *sql.Tx, room *models.Room) (created bool, err error) {
+	var (
+		id        int
+		deletedAt sql.NullTime
+	)
+	err = tx.QueryRowContext(ctx,
+		`SELECT id, deleted_at FROM rooms WHERE room_number = $1 FOR UPDATE`, room.RoomNumber,
+	).Scan(&id, &deletedAt)
+	if err == sql.ErrNoRows {
+		return true, createRoomTx(ctx, tx, room)
+	}
+	if err != nil {
+		return false, err
+	}
+	if deletedAt.Valid {
+		return false, ErrDeletedRecord
+	}
+
+	room.ID = id
+	room.Version = 0
+	return false, updateRoomTx(ctx, tx, id, room)
+}
+
+// UpsertGuestTx creates the guest or updates the one with the same email,
+// moving their bed if the room changed
+func UpsertGuestTx(ctx context.Context, tx *sql.Tx, guest *models.Guest) (created bool, err error) {
+	var (
+		id        int
+		deletedAt sql.NullTime
+		leftAt    sql.NullTime
+	)
+	emailIndex, err := guestEmailIndex(guest.Email)
+	if err != nil {
+		return false, err
+	}
+	err = tx.QueryRowContext(ctx,
+		`SELECT id, deleted_at, left_at FROM guests WHERE email_bidx = $1 FOR UPDATE`, emailIndex,
+	).Scan(&id, &deletedAt, &leftAt)
+	if err == sql.ErrNoRows {
+		return true, createGuestTx(ctx, tx, guest)
+	}
+	if err != nil {
+		return false, err
+	}
+	if leftAt.Valid {
+		return false, ErrGuestLeft
+	}
+	if deletedAt.Valid {
+		return false, ErrDeletedRecord
+	}
+
+	guest.ID = id
+	guest.Version = 0
+	return false, updateGuestTx(ctx, tx, id, guest)
+}
+
+// RoomExistsTx reports whether a live room has id, as seen by tx
+func RoomExistsTx(ctx context.Context, tx *sql.Tx, id int) (bool, error) {
+	var exists bool
+	err := tx.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM rooms WHERE id = $1 AND deleted_at IS NULL)`, id,
+	).Scan(&exists)
+	return exists, err
+}
+
+// RoomIDByNumber resolves a live room's id from its room number
+func RoomIDByNumber(ctx context.Context, tx *sql.Tx, roomNumber string) (int, error) {
+	var id int
+	err := tx.QueryRowContext(ctx,
+		`SELECT id FROM rooms WHERE room_number = $1 AND deleted_at IS NULL`, roomNumber,
+	).Scan(&id)
+	return id, err
+}
@@ -1,13 +1,17 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"pg-management-system/internal/models"
 )
 
-func GetUserByEmail(email string) (*models.User, error) {
-	query := `SELECT id, email, name, google_id, role, created_at FROM users WHERE email = $1`
-	row := DB.QueryRow(query, email)
+func GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT id, email, COALESCE(name, ''), COALESCE(google_id, ''), role, created_at FROM users WHERE email = $1`
+	row := DB.QueryRowContext(ctx, query, email)
 
 	var user models.User
 	err := row.Scan(&user.ID, &user.Email, &user.Name, &user.GoogleID, &user.Role, &user.CreatedAt)
@@ -20,17 +24,37 @@ func GetUserByEmail(email string) (*models.User, error) {
 	return &user, nil
 }
 
-func CreateUser(user *models.User) error {
+func CreateUser(ctx context.Context, user *models.User) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	if user.Role == "" {
 		user.Role = "user"
 	}
-	query := `INSERT INTO users (email, name, google_id, role) VALUES ($1, $2, $3, $4) RETURNING id, created_at`
-	err := DB.QueryRow(query, user.Email, user.Name, user.GoogleID, user.Role).Scan(&user.ID, &user.CreatedAt)
+	// google_id is unique, so users without one store NULL rather than ''
+	query := `INSERT INTO users (email, name, google_id, role) VALUES ($1, $2, NULLIF($3, ''), $4) RETURNING id, created_at`
+	err := DB.QueryRowContext(ctx, query, user.Email, user.Name, user.GoogleID, user.Role).Scan(&user.ID, &user.CreatedAt)
 	return err
 }
 
-func UpdateUserByGoogleID(googleID string, name string) error {
+func UpdateUserByGoogleID(ctx context.Context, googleID string, name string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	query := `UPDATE users SET name = $1 WHERE google_id = $2`
-	_, err := DB.Exec(query, name, googleID)
+	_, err := DB.ExecContext(ctx, query, name, googleID)
 	return err
 }
+
+// SetUserRole changes the role of the user with the given email. It returns
+// sql.ErrNoRows when there is no such user.
+func SetUserRole(ctx context.Context, email string, role string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	res, err := DB.ExecContext(ctx, `UPDATE users SET role = $1 WHERE email = $2`, role, email)
+	if err != nil {
+		return err
+	}
+	return expectRow(res)
+}
@@ -0,0 +1,25 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrVersionConflict is returned when an update names a version that is no longer current
+var ErrVersionConflict = errors.New("record was modified by someone else")
+
+// checkVersion verifies a live row is still at the expected version. An expected
+// version of 0 skips the comparison. Soft-deleted rows report sql.ErrNoRows.
+func checkVersion(ctx context.Context, tx *sql.Tx, table string, id, expected int) error {
+	var current int
+	query := fmt.Sprintf(`SELECT version FROM %s WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, table)
+	if err := tx.QueryRowContext(ctx, query, id).Scan(&current); err != nil {
+		return err
+	}
+	if expected != 0 && current != expected {
+		return ErrVersionConflict
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+// Package documents keeps guests' ID proofs. Files go to the blob store and their
+// details to guest_documents; REST handlers and GraphQL resolvers share it so both
+// accept the same files.
+package documents
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"pg-management-system/internal/blob"
+	"pg-management-system/internal/database"
+	"pg-management-system/internal/models"
+	"pg-management-system/internal/validation"
+)
+
+// ContentTypes are the formats accepted, detected from a file's content rather than
+// taken from the client
+var ContentTypes = []string{"application/pdf", "image/jpeg", "image/png"}
+
+// MaxSize is the largest file accepted, in bytes. Init reads it from DOCUMENT_MAX_MB.
+var MaxSize int64 = 10 << 20
+
+var store blob.Store
+
+// ErrNotConfigured is returned when Init has not set up a blob store
+var ErrNotConfigured = errors.New("document storage is not configured")
+
+// Init opens the blob store described by the environment, see blob.FromEnv
+func Init() error {
+	s, err := blob.FromEnv()
+	if err != nil {
+		return err
+	}
+	if raw := os.Getenv("DOCUMENT_MAX_MB"); raw != "" {
+		mb, err := strconv.Atoi(raw)
+		if err != nil || mb <= 0 {
+			return fmt.Errorf("invalid DOCUMENT_MAX_MB %q", raw)
+		}
+		MaxSize = int64(mb) << 20
+	}
+	store = s
+	return nil
+}
+
+// Save checks doc's file and then doc, stores size bytes of content and records
+// the document. The file is removed again if the record cannot be written.
+func Save(ctx context.Context, doc *models.GuestDocument, content io.Reader, size int64) error {
+	if store == nil {
+		return ErrNotConfigured
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(content, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	head = head[:n]
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if err := validation.DocumentFile(size, MaxSize, contentType, ContentTypes); err != nil {
+		return err
+	}
+	if err := validation.Document(ctx, doc); err != nil {
+		return err
+	}
+
+	doc.ContentType = contentType
+	doc.Size = size
+	doc.Filename = cleanFilename(doc.Filename)
+	doc.StorageKey = fmt.Sprintf("guests/%d/%s", doc.GuestID, randomName())
+
+	if err := store.Put(ctx, doc.StorageKey, io.MultiReader(bytes.NewReader(head), content), size, contentType); err != nil {
+		return fmt.Errorf("failed to store document: %w", err)
+	}
+	if err := database.CreateGuestDocument(ctx, doc); err != nil {
+		if delErr := store.Delete(context.WithoutCancel(ctx), doc.StorageKey); delErr != nil {
+			log.Printf("Warning: failed to remove unrecorded document %s: %v", doc.StorageKey, delErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// Open returns the content of doc's file
+func Open(ctx context.Context, doc *models.GuestDocument) (io.ReadCloser, error) {
+	if store == nil {
+		return nil, ErrNotConfigured
+	}
+	return store.Get(ctx, doc.StorageKey)
+}
+
+// Delete removes a document's record and then its file. A file that cannot be
+// removed is logged and left behind, since the record is already gone.
+func Delete(ctx context.Context, id int) error {
+	if store == nil {
+		return ErrNotConfigured
+	}
+	key, err := database.DeleteGuestDocument(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := store.Delete(context.WithoutCancel(ctx), key); err != nil {
+		log.Printf("Warning: failed to remove file %s of deleted document %d: %v", key, id, err)
+	}
+	return nil
+}
+
+// randomName keeps storage keys unguessable and free of anything the client sent
+func randomName() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// cleanFilename keeps the base name of a client's filename, without control
+// characters or quotes, for use in Content-Disposition
+func cleanFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "." || name == ".." || name == "/" {
+		name = ""
+	}
+	if len(name) > 255 {
+		name = strings.ToValidUTF8(name[len(name)-255:], "")
+	}
+	return name
+}
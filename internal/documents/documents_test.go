@@ -0,0 +1,106 @@
+package documents
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"pg-management-system/internal/models"
+	"pg-management-system/internal/validation"
+)
+
+func TestCleanFilename(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"passport.pdf", "passport.pdf"},
+		{"../../etc/passwd", "passwd"},
+		{`C:\Users\asha\Desktop\aadhaar.png`, "aadhaar.png"},
+		{`..\..\boot.ini`, "boot.ini"},
+		{"/abs/path/scan.jpg", "scan.jpg"},
+		{"dir/", "dir"},
+		{"", ""},
+		{".", ""},
+		{"/", ""},
+		{"..", ""},
+		{"a\"b.pdf", "ab.pdf"},
+		{"line\r\nbreak.pdf", "linebreak.pdf"},
+		{"tab\x00null\x7f.pdf", "tabnull.pdf"},
+		{"पासपोर्ट.pdf", "पासपोर्ट.pdf"},
+	}
+	for _, tt := range tests {
+		if got := cleanFilename(tt.in); got != tt.want {
+			t.Errorf("cleanFilename(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	// Long names keep their end, extension included, as valid UTF-8
+	long := strings.Repeat("é", 200) + ".pdf"
+	got := cleanFilename(long)
+	if len(got) > 255 || !strings.HasSuffix(got, ".pdf") || !strings.HasPrefix(got, "é") {
+		t.Errorf("cleanFilename of %d bytes = %d bytes %q", len(long), len(got), got)
+	}
+}
+
+// memStore records what reaches the blob store
+type memStore struct {
+	puts int
+}
+
+func (m *memStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	m.puts++
+	return nil
+}
+
+func (m *memStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (m *memStore) Delete(ctx context.Context, key string) error { return nil }
+
+func TestSaveChecksFileBeforeStoring(t *testing.T) {
+	mem := &memStore{}
+	prevStore, prevMax := store, MaxSize
+	store, MaxSize = mem, 1<<20
+	t.Cleanup(func() { store, MaxSize = prevStore, prevMax })
+
+	pdf := []byte("%PDF-1.7\n1 0 obj\n<<>>\nendobj\n")
+	tests := []struct {
+		name    string
+		content []byte
+		size    int64
+		want    string
+	}{
+		{"empty", nil, 0, "is empty"},
+		{"too large", pdf, 2 << 20, "at most 1 MB"},
+		{"plain text", []byte("just some text"), 14, "not text/plain"},
+		{"html named .pdf", []byte("<html><script>alert(1)</script></html>"), 38, "not text/html"},
+		{"executable", []byte("MZ\x90\x00\x03\x00\x00\x00\x04\x00\x00\x00\xff\xff"), 14, "must be a PDF, JPEG or PNG"},
+		{"gif", []byte("GIF89a\x01\x00\x01\x00"), 10, "not image/gif"},
+	}
+	for _, tt := range tests {
+		doc := &models.GuestDocument{GuestID: 1, Type: models.DocumentTypes[0], Filename: "id.pdf"}
+		err := Save(context.Background(), doc, bytes.NewReader(tt.content), tt.size)
+		var v *validation.Error
+		if !errors.As(err, &v) || len(v.Fields) != 1 || v.Fields[0].Field != "file" || !strings.Contains(v.Fields[0].Message, tt.want) {
+			t.Errorf("%s: Save = %v, want a file error containing %q", tt.name, err, tt.want)
+		}
+	}
+	if mem.puts != 0 {
+		t.Errorf("%d rejected files reached the store", mem.puts)
+	}
+}
+
+func TestSaveWithoutStore(t *testing.T) {
+	prev := store
+	store = nil
+	t.Cleanup(func() { store = prev })
+
+	err := Save(context.Background(), &models.GuestDocument{}, strings.NewReader("%PDF-1.7"), 8)
+	if !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("Save = %v, want ErrNotConfigured", err)
+	}
+}
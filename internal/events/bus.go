@@ -0,0 +1,81 @@
+// Package events is an in-process publish/subscribe bus. Repositories publish
+// after a change commits; GraphQL subscriptions listen.
+package events
+
+import "sync"
+
+// Topic names an event stream. Payloads are model values.
+type Topic string
+
+const (
+	// RoomOccupancyChanged carries the models.Room after its occupancy or capacity changed
+	RoomOccupancyChanged Topic = "roomOccupancyChanged"
+	// PaymentReceived carries a newly recorded models.Payment
+	PaymentReceived Topic = "paymentReceived"
+	// GuestCheckedIn carries a newly created models.Guest
+	GuestCheckedIn Topic = "guestCheckedIn"
+)
+
+// subscriberBuffer is how many events a slow subscriber may fall behind before
+// further events are dropped for it
+const subscriberBuffer = 64
+
+// Bus fans events out to subscribers without ever blocking the publisher
+type Bus struct {
+	mu   sync.RWMutex
+	subs map[Topic]map[chan interface{}]struct{}
+}
+
+// NewBus returns an empty bus
+func NewBus() *Bus {
+	return &Bus{subs: map[Topic]map[chan interface{}]struct{}{}}
+}
+
+// Default is the bus the repositories publish to
+var Default = NewBus()
+
+// Publish sends payload to every subscriber of topic. Subscribers whose buffer
+// is full miss the event.
+func (b *Bus) Publish(topic Topic, payload interface{}) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for ch := range b.subs[topic] {
+		select {
+		case ch <- payload:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel of topic's payloads and a function that ends the
+// subscription and closes the channel
+func (b *Bus) Subscribe(topic Topic) (<-chan interface{}, func()) {
+	ch := make(chan interface{}, subscriberBuffer)
+
+	b.mu.Lock()
+	if b.subs[topic] == nil {
+		b.subs[topic] = map[chan interface{}]struct{}{}
+	}
+	b.subs[topic][ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs[topic], ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Publish sends payload on the Default bus
+func Publish(topic Topic, payload interface{}) {
+	Default.Publish(topic, payload)
+}
+
+// Subscribe listens on the Default bus
+func Subscribe(topic Topic) (<-chan interface{}, func()) {
+	return Default.Subscribe(topic)
+}
@@ -0,0 +1,260 @@
+// Package export streams rooms, guests, payments and reports as CSV, XLSX or NDJSON.
+// Rows are written as they are read from the database, so memory use does not grow
+// with the size of the table.
+package export
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"pg-management-system/internal/database"
+	"pg-management-system/internal/models"
+	"pg-management-system/internal/xlsx"
+)
+
+// Exportable kinds
+const (
+	KindRooms           = "rooms"
+	KindGuests          = "guests"
+	KindPayments        = "payments"
+	KindMonthlyPayments = "monthly-payments"
+)
+
+// Supported output formats
+const (
+	FormatCSV    = "csv"
+	FormatXLSX   = "xlsx"
+	FormatNDJSON = "ndjson"
+)
+
+// QueryTimeout replaces the usual per-query deadline, which is too short for a full table
+const QueryTimeout = 10 * time.Minute
+
+var (
+	ErrUnknownKind   = errors.New("unknown export kind")
+	ErrUnknownFormat = errors.New("unknown export format, expected csv, xlsx or ndjson")
+)
+
+// Options select what is exported
+type Options struct {
+	Kind   string
+	Format string
+	Filter database.ListFilter
+	// Period limits payments and reports by payment date
+	Period database.Period
+}
+
+// Validate checks the kind and format before any output is produced
+func (o Options) Validate() error {
+	switch o.Kind {
+	case KindRooms, KindGuests, KindPayments, KindMonthlyPayments:
+	default:
+		return ErrUnknownKind
+	}
+	if ContentType(o.Format) == "" {
+		return ErrUnknownFormat
+	}
+	return nil
+}
+
+// ContentType returns the MIME type for format, or "" if it is not supported
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatXLSX:
+		return xlsx.MimeType
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	}
+	return ""
+}
+
+// Filename suggests a download name such as payments-2024-05-01.xlsx
+func Filename(opts Options, now time.Time) string {
+	return fmt.Sprintf("%s-%s.%s", opts.Kind, now.Format("2006-01-02"), opts.Format)
+}
+
+// Write streams the selected rows to w
+func Write(ctx context.Context, w io.Writer, opts Options) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	ctx = database.WithQueryTimeout(ctx, QueryTimeout)
+
+	tw, err := newTableWriter(w, opts.Format, opts.Kind)
+	if err != nil {
+		return err
+	}
+
+	switch opts.Kind {
+	case KindRooms:
+		err = tw.header("id", "room_number", "capacity", "occupancy", "price", "deleted_at", "version")
+		if err == nil {
+			err = database.EachRoom(ctx, opts.Filter, func(r *models.Room) error {
+				return tw.row(r.ID, r.RoomNumber, r.Capacity, r.Occupancy, r.Price, r.DeletedAt, r.Version)
+			})
+		}
+	case KindGuests:
+		err = tw.header("id", "name", "email", "phone", "room_id", "join_date", "deleted_at", "version")
+		if err == nil {
+			err = database.EachGuest(ctx, opts.Filter, func(g *models.Guest) error {
+				return tw.row(g.ID, g.Name, g.Email, g.Phone, g.RoomID, g.JoinDate, g.DeletedAt, g.Version)
+			})
+		}
+	case KindPayments:
+		err = tw.header("id", "guest_id", "amount", "payment_date", "payment_method", "deleted_at", "version")
+		if err == nil {
+			err = database.EachPayment(ctx, opts.Filter, opts.Period, func(p *models.Payment) error {
+				return tw.row(p.ID, p.GuestID, p.Amount, p.PaymentDate, p.PaymentMethod, p.DeletedAt, p.Version)
+			})
+		}
+	case KindMonthlyPayments:
+		err = tw.header("month", "payment_method", "payments", "total")
+		if err == nil {
+			err = database.EachMonthlyPayments(ctx, opts.Filter, opts.Period, func(m *models.MonthlyPayments) error {
+				return tw.row(m.Month, m.PaymentMethod, m.Payments, m.Total)
+			})
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return tw.close()
+}
+
+// tableWriter is implemented once per output format
+type tableWriter interface {
+	header(columns ...string) error
+	row(values ...any) error
+	close() error
+}
+
+func newTableWriter(w io.Writer, format, sheet string) (tableWriter, error) {
+	switch format {
+	case FormatCSV:
+		return &csvWriter{w: csv.NewWriter(w)}, nil
+	case FormatXLSX:
+		xw, err := xlsx.NewWriter(w, sheet)
+		if err != nil {
+			return nil, err
+		}
+		return &xlsxWriter{w: xw}, nil
+	case FormatNDJSON:
+		return &ndjsonWriter{w: w}, nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+type csvWriter struct {
+	w      *csv.Writer
+	record []string
+}
+
+func (c *csvWriter) header(columns ...string) error {
+	return c.w.Write(columns)
+}
+
+func (c *csvWriter) row(values ...any) error {
+	c.record = c.record[:0]
+	for _, v := range values {
+		c.record = append(c.record, text(v))
+	}
+	return c.w.Write(c.record)
+}
+
+func (c *csvWriter) close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type xlsxWriter struct {
+	w *xlsx.Writer
+}
+
+func (x *xlsxWriter) header(columns ...string) error {
+	values := make([]any, len(columns))
+	for i, c := range columns {
+		values[i] = c
+	}
+	return x.w.WriteRow(values)
+}
+
+func (x *xlsxWriter) row(values ...any) error {
+	for i, v := range values {
+		if t, ok := v.(*time.Time); ok && t == nil {
+			values[i] = nil
+		}
+	}
+	return x.w.WriteRow(values)
+}
+
+func (x *xlsxWriter) close() error {
+	return x.w.Close()
+}
+
+// ndjsonWriter writes one JSON object per line with keys in column order
+type ndjsonWriter struct {
+	w       io.Writer
+	columns []string
+	buf     strings.Builder
+}
+
+func (n *ndjsonWriter) header(columns ...string) error {
+	n.columns = columns
+	return nil
+}
+
+func (n *ndjsonWriter) row(values ...any) error {
+	n.buf.Reset()
+	n.buf.WriteByte('{')
+	for i, v := range values {
+		if i > 0 {
+			n.buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(n.columns[i])
+		val, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		n.buf.Write(key)
+		n.buf.WriteByte(':')
+		n.buf.Write(val)
+	}
+	n.buf.WriteString("}\n")
+	_, err := io.WriteString(n.w, n.buf.String())
+	return err
+}
+
+func (n *ndjsonWriter) close() error {
+	return nil
+}
+
+// text formats a value for CSV: RFC 3339 times, plain decimals and "" for null
+func text(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case int:
+		return strconv.Itoa(t)
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case time.Time:
+		return t.Format(time.RFC3339)
+	case *time.Time:
+		if t == nil {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	}
+	return fmt.Sprint(v)
+}
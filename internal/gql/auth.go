@@ -0,0 +1,124 @@
+package gql
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"pg-management-system/internal/handlers"
+	"pg-management-system/internal/middleware"
+
+	"github.com/graphql-go/graphql"
+)
+
+// Authorization is declared in the SDL with @auth: a bare @auth admits any signed-in
+// user and @auth(roles: ["admin"]) only those roles, like middleware.RBAC does for
+// REST routes. Every Query, Mutation and Subscription field must carry one; other
+// fields may add a stricter check on top of the root field that reached them.
+
+// authError is returned to clients with an extensions.code, like the guard's errors
+type authError struct {
+	code, message string
+}
+
+func (e *authError) Error() string { return e.message }
+
+func (e *authError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": e.code}
+}
+
+var errUnauthenticated = &authError{"UNAUTHENTICATED", "unauthorized: no valid session"}
+
+// authorize checks the caller against the roles of an @auth directive; no roles
+// means any authenticated user
+func authorize(p graphql.ResolveParams, roles []string) error {
+	claims, ok := p.Context.Value(middleware.UserClaimsKey).(*handlers.Claims)
+	if !ok || claims == nil {
+		return errUnauthenticated
+	}
+	if len(roles) == 0 {
+		return nil
+	}
+	for _, role := range roles {
+		if claims.Role == role {
+			return nil
+		}
+	}
+	return &authError{"FORBIDDEN", "forbidden: " + strings.Join(roles, " or ") + " access required"}
+}
+
+// applyAuth wraps every field that carries @auth with its check, and fails when
+// a root field has none
+func applyAuth(schema *graphql.Schema, directives fieldDirectives) error {
+	var missing []string
+	for _, root := range []*graphql.Object{schema.QueryType(), schema.MutationType(), schema.SubscriptionType()} {
+		if root == nil {
+			continue
+		}
+		for name := range root.Fields() {
+			key := root.Name() + "." + name
+			if !directives.has(key, "auth") {
+				missing = append(missing, key)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("fields without @auth: %s", strings.Join(missing, ", "))
+	}
+
+	for _, t := range schema.TypeMap() {
+		obj, ok := t.(*graphql.Object)
+		if !ok || strings.HasPrefix(obj.Name(), "__") {
+			continue
+		}
+		for name, field := range obj.Fields() {
+			key := obj.Name() + "." + name
+			if !directives.has(key, "auth") {
+				continue
+			}
+			roles, err := authRoles(directives.argument(key, "auth", "roles"))
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			if field.Subscribe != nil {
+				field.Subscribe = guarded(field.Subscribe, roles)
+				continue
+			}
+			resolve := field.Resolve
+			if resolve == nil {
+				resolve = graphql.DefaultResolveFn
+			}
+			field.Resolve = guarded(resolve, roles)
+		}
+	}
+	return nil
+}
+
+func guarded(next graphql.FieldResolveFn, roles []string) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		if err := authorize(p, roles); err != nil {
+			return nil, err
+		}
+		return next(p)
+	}
+}
+
+func authRoles(v interface{}) ([]string, error) {
+	if v == nil {
+		return nil, nil
+	}
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("@auth roles must be a list of strings")
+	}
+	roles := make([]string, 0, len(list))
+	for _, item := range list {
+		role, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("@auth roles must be a list of strings")
+		}
+		roles = append(roles, role)
+	}
+	return roles, nil
+}
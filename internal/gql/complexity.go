@@ -0,0 +1,187 @@
+package gql
+
+import (
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// Scoring: every field costs 1 unless the SDL says otherwise with @cost(value: N).
+// The selections under a list field count once per expected item: the field's
+// limit argument when given, else @cost(multiplier: N), else Limits.ListSize.
+
+// analysis describes an operation before it runs
+type analysis struct {
+	Depth         int
+	Complexity    int
+	Introspection bool
+}
+
+type analyzer struct {
+	schema    *graphql.Schema
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+	listSize  int
+	result    analysis
+}
+
+// analyze scores the operations in doc that would run for operationName
+func analyze(schema *graphql.Schema, doc *ast.Document, operationName string, variables map[string]interface{}, listSize int) analysis {
+	a := &analyzer{
+		schema:    schema,
+		fragments: map[string]*ast.FragmentDefinition{},
+		variables: variables,
+		listSize:  listSize,
+	}
+	for _, def := range doc.Definitions {
+		if frag, ok := def.(*ast.FragmentDefinition); ok {
+			a.fragments[frag.Name.Value] = frag
+		}
+	}
+
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if operationName != "" && (op.Name == nil || op.Name.Value != operationName) {
+			continue
+		}
+		var root *graphql.Object
+		switch op.Operation {
+		case ast.OperationTypeQuery:
+			root = schema.QueryType()
+		case ast.OperationTypeMutation:
+			root = schema.MutationType()
+		case ast.OperationTypeSubscription:
+			root = schema.SubscriptionType()
+		}
+		if root == nil {
+			continue
+		}
+		if c := a.selections(root, op.SelectionSet, 1, map[string]bool{}); c > a.result.Complexity {
+			a.result.Complexity = c
+		}
+	}
+	return a.result
+}
+
+func (a *analyzer) selections(parent *graphql.Object, set *ast.SelectionSet, depth int, seen map[string]bool) int {
+	if set == nil {
+		return 0
+	}
+	if depth > a.result.Depth {
+		a.result.Depth = depth
+	}
+
+	total := 0
+	for _, sel := range set.Selections {
+		switch sel := sel.(type) {
+		case *ast.Field:
+			total += a.field(parent, sel, depth, seen)
+		case *ast.InlineFragment:
+			total += a.selections(a.narrow(parent, sel.TypeCondition), sel.SelectionSet, depth, seen)
+		case *ast.FragmentSpread:
+			name := sel.Name.Value
+			frag := a.fragments[name]
+			if frag == nil || seen[name] {
+				continue
+			}
+			seen[name] = true
+			total += a.selections(a.narrow(parent, frag.TypeCondition), frag.SelectionSet, depth, seen)
+			delete(seen, name)
+		}
+	}
+	return total
+}
+
+func (a *analyzer) field(parent *graphql.Object, f *ast.Field, depth int, seen map[string]bool) int {
+	name := f.Name.Value
+	if name == "__typename" {
+		return 0
+	}
+	if strings.HasPrefix(name, "__") {
+		// __schema and __type; their own selections are not scored
+		a.result.Introspection = true
+		return 1
+	}
+
+	def, ok := parent.Fields()[name]
+	if !ok {
+		return 0
+	}
+	key := parent.Name() + "." + name
+
+	cost := 1
+	if v, ok := directives.argument(key, "cost", "value").(int); ok {
+		cost = v
+	}
+
+	child, isList := unwrap(def.Type)
+	obj, ok := child.(*graphql.Object)
+	if !ok {
+		return cost
+	}
+	inner := a.selections(obj, f.SelectionSet, depth+1, seen)
+	if !isList {
+		return cost + inner
+	}
+	return cost + a.multiplier(key, f)*inner
+}
+
+// multiplier estimates how many items a list field returns
+func (a *analyzer) multiplier(key string, f *ast.Field) int {
+	for _, arg := range f.Arguments {
+		if arg.Name.Value != "limit" {
+			continue
+		}
+		var v interface{}
+		if variable, ok := arg.Value.(*ast.Variable); ok {
+			v = a.variables[variable.Name.Value]
+		} else {
+			v = astValue(arg.Value)
+		}
+		switch n := v.(type) {
+		case int:
+			if n > 0 {
+				return n
+			}
+		case float64: // JSON variables decode as float64
+			if n > 0 {
+				return int(n)
+			}
+		}
+	}
+	if m, ok := directives.argument(key, "cost", "multiplier").(int); ok && m > 0 {
+		return m
+	}
+	return a.listSize
+}
+
+// narrow returns the object named by a fragment's type condition, or parent
+func (a *analyzer) narrow(parent *graphql.Object, cond *ast.Named) *graphql.Object {
+	if cond == nil {
+		return parent
+	}
+	if obj, ok := a.schema.Type(cond.Name.Value).(*graphql.Object); ok {
+		return obj
+	}
+	return parent
+}
+
+// unwrap strips NonNull and List wrappers, reporting whether a list was seen
+func unwrap(t graphql.Type) (graphql.Type, bool) {
+	isList := false
+	for {
+		switch w := t.(type) {
+		case *graphql.NonNull:
+			t = w.OfType
+		case *graphql.List:
+			isList = true
+			t = w.OfType
+		default:
+			return t, isList
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package gql
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"pg-management-system/internal/handlers"
+	"pg-management-system/internal/response"
+
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/graphql-go/handler"
+)
+
+// Defaults for Limits, each overridable from the environment
+const (
+	DefaultMaxDepth      = 8
+	DefaultMaxComplexity = 2000
+	DefaultListSize      = 10
+	DefaultCostBudget    = 20000
+	DefaultMaxBatch      = 10
+	DefaultMaxUploadMB   = 20
+	DefaultMaxUploads    = 5
+)
+
+// maxRequestBody bounds how much of a GraphQL request is read
+const maxRequestBody = 1 << 20
+
+// Limits protect the GraphQL endpoint from expensive queries
+type Limits struct {
+	// MaxDepth is the deepest selection nesting allowed; 0 disables the check
+	MaxDepth int
+	// MaxComplexity is the highest score a single operation may have; 0 disables the check
+	MaxComplexity int
+	// ListSize is the assumed length of list fields without a limit or @cost multiplier
+	ListSize int
+	// CostBudget is how much complexity each user may spend per minute; 0 disables budgets
+	CostBudget int
+	// Production turns off introspection for everyone but admins
+	Production bool
+	// MaxBatch is how many operations one batched request may hold; 0 disables batching
+	MaxBatch int
+	// MaxUploadSize bounds the total bytes of files in one multipart request
+	MaxUploadSize int64
+	// MaxUploads is how many files one multipart request may carry; 0 disables uploads
+	MaxUploads int
+}
+
+// LimitsFromEnv reads GRAPHQL_MAX_DEPTH, GRAPHQL_MAX_COMPLEXITY, GRAPHQL_LIST_SIZE,
+// GRAPHQL_COST_BUDGET, GRAPHQL_MAX_BATCH, GRAPHQL_MAX_UPLOAD_MB, GRAPHQL_MAX_UPLOADS
+// and APP_ENV (production mode when "production")
+func LimitsFromEnv() Limits {
+	return Limits{
+		MaxDepth:      envInt("GRAPHQL_MAX_DEPTH", DefaultMaxDepth),
+		MaxComplexity: envInt("GRAPHQL_MAX_COMPLEXITY", DefaultMaxComplexity),
+		ListSize:      envInt("GRAPHQL_LIST_SIZE", DefaultListSize),
+		CostBudget:    envInt("GRAPHQL_COST_BUDGET", DefaultCostBudget),
+		Production:    os.Getenv("APP_ENV") == "production",
+		MaxBatch:      envInt("GRAPHQL_MAX_BATCH", DefaultMaxBatch),
+		MaxUploadSize: int64(envInt("GRAPHQL_MAX_UPLOAD_MB", DefaultMaxUploadMB)) << 20,
+		MaxUploads:    envInt("GRAPHQL_MAX_UPLOADS", DefaultMaxUploads),
+	}
+}
+
+func envInt(key string, fallback int) int {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		log.Printf("Warning: invalid %s %q, using %d", key, raw, fallback)
+		return fallback
+	}
+	return n
+}
+
+// Guard scores each operation before next executes it and rejects those over the
+// limits or the caller's remaining budget. Requests it cannot parse are passed
+// through so the handler reports the syntax error.
+func Guard(limits Limits, next http.Handler) http.Handler {
+	if limits.ListSize <= 0 {
+		limits.ListSize = DefaultListSize
+	}
+	budgets := budgetsFor(limits.CostBudget)
+	if budgets != nil && limits.CostBudget < limits.MaxComplexity {
+		log.Printf("Warning: GRAPHQL_COST_BUDGET %d is below GRAPHQL_MAX_COMPLEXITY %d; the costliest allowed queries can never run",
+			limits.CostBudget, limits.MaxComplexity)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBody))
+		if err != nil {
+			graphqlError(w, http.StatusRequestEntityTooLarge, "REQUEST_TOO_LARGE", "request body is too large")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		opts := handler.NewRequestOptions(r)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		if opts.Query == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(opts.Query)})})
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		a := analyze(&Schema, doc, opts.OperationName, opts.Variables, limits.ListSize)
+		claims, _ := handlers.ClaimsFromContext(r.Context())
+		isAdmin := claims != nil && claims.Role == "admin"
+
+		if rej := limits.violation(a, isAdmin); rej != nil {
+			graphqlError(w, rej.status, rej.code, rej.message)
+			return
+		}
+
+		if wait, rej := budgets.charge(budgetKey(r, claims), a.Complexity); rej != nil {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			graphqlError(w, rej.status, rej.code, rej.message)
+			return
+		}
+
+		w.Header().Set("X-GraphQL-Complexity", strconv.Itoa(a.Complexity))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rejection says why an operation may not run, as an HTTP status and GraphQL error code
+type rejection struct {
+	status        int
+	code, message string
+}
+
+// violation checks an analysed operation against everything but the cost budget
+func (limits Limits) violation(a analysis, isAdmin bool) *rejection {
+	switch {
+	case a.Introspection && limits.Production && !isAdmin:
+		return &rejection{http.StatusForbidden, "INTROSPECTION_DISABLED", "introspection is disabled"}
+	case limits.MaxDepth > 0 && a.Depth > limits.MaxDepth:
+		return &rejection{http.StatusBadRequest, "QUERY_TOO_DEEP",
+			fmt.Sprintf("query depth %d exceeds the maximum of %d", a.Depth, limits.MaxDepth)}
+	case limits.MaxComplexity > 0 && a.Complexity > limits.MaxComplexity:
+		return &rejection{http.StatusBadRequest, "QUERY_TOO_COMPLEX",
+			fmt.Sprintf("query complexity %d exceeds the maximum of %d", a.Complexity, limits.MaxComplexity)}
+	}
+	return nil
+}
+
+func budgetKey(r *http.Request, claims *handlers.Claims) string {
+	if claims != nil {
+		return "user:" + strconv.Itoa(claims.UserID)
+	}
+	return "ip:" + r.RemoteAddr
+}
+
+// graphqlError writes a GraphQL-shaped error response
+func graphqlError(w http.ResponseWriter, status int, code, message string) {
+	response.JSON(w, status, map[string]interface{}{
+		"errors": []map[string]interface{}{{
+			"message":    message,
+			"extensions": map[string]string{"code": code},
+		}},
+	})
+}
+
+// costBudgets is a token bucket per user: each holds up to one minute's budget
+// and refills continuously
+type costBudgets struct {
+	perMinute float64
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// maxBuckets triggers a sweep of idle, fully refilled buckets
+const maxBuckets = 10000
+
+func newCostBudgets(perMinute int) *costBudgets {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &costBudgets{perMinute: float64(perMinute), buckets: map[string]*bucket{}}
+}
+
+var (
+	sharedBudgetsMu sync.Mutex
+	sharedBudgets   = map[int]*costBudgets{}
+)
+
+// budgetsFor returns the buckets for a per-minute budget, shared by every endpoint
+// configured with it so HTTP and WebSocket operations draw on the same budget
+func budgetsFor(perMinute int) *costBudgets {
+	if perMinute <= 0 {
+		return nil
+	}
+	sharedBudgetsMu.Lock()
+	defer sharedBudgetsMu.Unlock()
+	c, ok := sharedBudgets[perMinute]
+	if !ok {
+		c = newCostBudgets(perMinute)
+		sharedBudgets[perMinute] = c
+	}
+	return c
+}
+
+// charge spends cost from key's budget, or explains why it cannot and how long
+// until it can. A nil budget charges nothing.
+func (c *costBudgets) charge(key string, cost int) (time.Duration, *rejection) {
+	if c == nil {
+		return 0, nil
+	}
+	wait, ok := c.spend(key, cost)
+	if ok {
+		return 0, nil
+	}
+	return wait, &rejection{http.StatusTooManyRequests, "COST_BUDGET_EXCEEDED",
+		fmt.Sprintf("query cost %d exceeds your remaining budget; retry in %v", cost, wait.Round(time.Second))}
+}
+
+// spend takes cost from key's bucket. When there is not enough left it takes
+// nothing and reports how long until there will be.
+func (c *costBudgets) spend(key string, cost int) (time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	b, ok := c.buckets[key]
+	if !ok {
+		if len(c.buckets) >= maxBuckets {
+			c.sweep(now)
+		}
+		b = &bucket{tokens: c.perMinute, last: now}
+		c.buckets[key] = b
+	}
+	c.refill(b, now)
+
+	need := float64(cost)
+	if need > b.tokens {
+		return time.Duration((need - b.tokens) / c.perMinute * float64(time.Minute)), false
+	}
+	b.tokens -= need
+	return 0, true
+}
+
+func (c *costBudgets) refill(b *bucket, now time.Time) {
+	b.tokens = math.Min(c.perMinute, b.tokens+now.Sub(b.last).Minutes()*c.perMinute)
+	b.last = now
+}
+
+func (c *costBudgets) sweep(now time.Time) {
+	for key, b := range c.buckets {
+		c.refill(b, now)
+		if b.tokens >= c.perMinute {
+			delete(c.buckets, key)
+		}
+	}
+}
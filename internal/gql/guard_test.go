@@ -0,0 +1,183 @@
+package gql
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+func TestAnalyzeScoresDepthAndComplexity(t *testing.T) {
+	tests := []struct {
+		name          string
+		query         string
+		variables     map[string]interface{}
+		depth, cost   int
+		introspection bool
+	}{
+		{name: "list at the default size", query: `{ rooms { id } }`, depth: 2, cost: 1 + 10*1},
+		{name: "nested list with @cost multiplier", query: `{ rooms { id guests { id } } }`, depth: 3, cost: 1 + 10*(1+1+4*1)},
+		{name: "three levels of lists", query: `{ rooms { guests { payments { id } } } }`, depth: 4, cost: 1 + 10*(1+4*(1+12*1))},
+		{name: "large multiplier", query: `{ auditLog { id } }`, depth: 2, cost: 1 + 100*1},
+		{name: "limit overrides the multiplier", query: `{ auditLog(limit: 5) { id } }`, depth: 2, cost: 1 + 5*1},
+		{name: "limit from a variable", query: `query ($n: Int) { auditLog(limit: $n) { id } }`, variables: map[string]interface{}{"n": 3.0}, depth: 2, cost: 1 + 3*1},
+		{name: "@cost value", query: `mutation { deleteRoom(id: 1) { deleted } }`, depth: 2, cost: 10 + 1},
+		{name: "fragment", query: `{ ...F } fragment F on Query { rooms { id } }`, depth: 2, cost: 11},
+		{name: "__typename is free", query: `{ rooms { __typename id } }`, depth: 2, cost: 11},
+		{name: "introspection", query: `{ __schema { types { name } } }`, depth: 1, cost: 1, introspection: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parser.Parse(parser.ParseParams{Source: tt.query})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := analyze(&Schema, doc, "", tt.variables, DefaultListSize)
+			if got.Depth != tt.depth || got.Complexity != tt.cost || got.Introspection != tt.introspection {
+				t.Errorf("analysis = %+v, want depth %d, complexity %d, introspection %v", got, tt.depth, tt.cost, tt.introspection)
+			}
+		})
+	}
+}
+
+// guardedServer counts the requests Guard lets through
+func guardedServer(limits Limits) (http.Handler, *int) {
+	passed := 0
+	return Guard(limits, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		passed++
+		w.Write([]byte(`{"data":{}}`))
+	})), &passed
+}
+
+func postQuery(h http.Handler, query string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(map[string]string{"query": query})
+	req := httptest.NewRequest(http.MethodPost, "/api/graphql", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func rejectionCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var resp struct {
+		Errors []struct {
+			Extensions map[string]string `json:"extensions"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || len(resp.Errors) == 0 {
+		t.Fatalf("not a GraphQL error: %s", w.Body)
+	}
+	return resp.Errors[0].Extensions["code"]
+}
+
+func TestGuardEnforcesLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits Limits
+		query  string
+		status int
+		code   string
+	}{
+		{"depth at the limit", Limits{MaxDepth: 3}, `{ rooms { id guests { id } } }`, http.StatusOK, ""},
+		{"one level over the depth limit", Limits{MaxDepth: 3}, `{ rooms { guests { payments { id } } } }`, http.StatusBadRequest, "QUERY_TOO_DEEP"},
+		{"complexity under the limit", Limits{MaxComplexity: 100}, `{ auditLog(limit: 50) { id } }`, http.StatusOK, ""},
+		{"list multiplier over the limit", Limits{MaxComplexity: 100}, `{ auditLog { id } }`, http.StatusBadRequest, "QUERY_TOO_COMPLEX"},
+		{"limits off", Limits{}, `{ rooms { guests { payments { id } } } }`, http.StatusOK, ""},
+		{"introspection in production", Limits{Production: true}, `{ __schema { types { name } } }`, http.StatusForbidden, "INTROSPECTION_DISABLED"},
+		{"introspection in development", Limits{}, `{ __schema { types { name } } }`, http.StatusOK, ""},
+		{"syntax errors are left to the handler", Limits{MaxDepth: 1}, `{ rooms {`, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, passed := guardedServer(tt.limits)
+			w := postQuery(h, tt.query)
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.code == "" {
+				if *passed != 1 {
+					t.Error("request was not passed on")
+				}
+				return
+			}
+			if *passed != 0 {
+				t.Error("rejected request was passed on")
+			}
+			if code := rejectionCode(t, w); code != tt.code {
+				t.Errorf("code %s, want %s", code, tt.code)
+			}
+		})
+	}
+}
+
+func TestGuardChargesCostBudget(t *testing.T) {
+	// Budgets are shared by every Guard with the same size; this size is used only here
+	h, passed := guardedServer(Limits{CostBudget: 151})
+
+	if w := postQuery(h, `{ auditLog { id } }`); w.Code != http.StatusOK || w.Header().Get("X-GraphQL-Complexity") != "101" {
+		t.Fatalf("first query: status %d, complexity %q", w.Code, w.Header().Get("X-GraphQL-Complexity"))
+	}
+	w := postQuery(h, `{ auditLog { id } }`)
+	if w.Code != http.StatusTooManyRequests || rejectionCode(t, w) != "COST_BUDGET_EXCEEDED" {
+		t.Fatalf("second query: status %d: %s", w.Code, w.Body)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("no Retry-After on a spent budget")
+	}
+	// What is left still pays for a cheaper query
+	if w := postQuery(h, `{ auditLog(limit: 10) { id } }`); w.Code != http.StatusOK {
+		t.Errorf("cheap query: status %d: %s", w.Code, w.Body)
+	}
+	if *passed != 2 {
+		t.Errorf("%d requests passed, want 2", *passed)
+	}
+}
+
+func TestCostBudgetRefills(t *testing.T) {
+	c := newCostBudgets(600)
+	rewind := func(d time.Duration) {
+		c.mu.Lock()
+		c.buckets["u"].last = c.buckets["u"].last.Add(-d)
+		c.mu.Unlock()
+	}
+
+	if _, ok := c.spend("u", 600); !ok {
+		t.Fatal("a full bucket refused its whole budget")
+	}
+	wait, ok := c.spend("u", 60)
+	if ok {
+		t.Fatal("an empty bucket paid for a query")
+	}
+	if wait < 5*time.Second || wait > 6*time.Second {
+		t.Errorf("wait %v, want about 6s for a tenth of the per-minute budget", wait)
+	}
+
+	// A tenth of the interval refills a tenth of the budget
+	rewind(6 * time.Second)
+	if _, ok := c.spend("u", 60); !ok {
+		t.Error("bucket did not refill after 6s")
+	}
+	if _, ok := c.spend("u", 60); ok {
+		t.Error("bucket refilled more than it should have")
+	}
+
+	// After the whole interval it is full again, but never fuller
+	rewind(10 * time.Minute)
+	if _, ok := c.spend("u", 600); !ok {
+		t.Error("bucket did not refill after a minute")
+	}
+	rewind(10 * time.Minute)
+	if _, ok := c.spend("u", 601); ok {
+		t.Error("bucket holds more than one minute's budget")
+	}
+
+	// Buckets are per key
+	if _, ok := c.spend("v", 600); !ok {
+		t.Error("one user's spending drained another's bucket")
+	}
+}
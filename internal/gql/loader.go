@@ -0,0 +1,186 @@
+package gql
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"pg-management-system/internal/database"
+	"pg-management-system/internal/models"
+)
+
+// loader batches lookups by id made while resolving one level of a query. load
+// queues the id and returns a thunk; graphql-go runs query thunks breadth-first,
+// so by the time the first one runs every sibling has queued its id and a single
+// fetch serves them all. Results are cached for the rest of the request.
+type loader[V any] struct {
+	fetch func(ctx context.Context, ids []int) (map[int]V, error)
+	// missing is returned for ids the fetch did not find
+	missing func() V
+
+	mu      sync.Mutex
+	pending []int
+	queued  map[int]bool
+	results map[int]V
+	errs    map[int]error
+}
+
+func newLoader[V any](fetch func(ctx context.Context, ids []int) (map[int]V, error), missing func() V) *loader[V] {
+	return &loader[V]{
+		fetch:   fetch,
+		missing: missing,
+		queued:  map[int]bool{},
+		results: map[int]V{},
+		errs:    map[int]error{},
+	}
+}
+
+func (l *loader[V]) load(ctx context.Context, id int) func() (interface{}, error) {
+	l.mu.Lock()
+	if !l.queued[id] {
+		l.queued[id] = true
+		l.pending = append(l.pending, id)
+	}
+	l.mu.Unlock()
+
+	return func() (interface{}, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if len(l.pending) > 0 {
+			ids := l.pending
+			l.pending = nil
+			found, err := l.fetch(ctx, ids)
+			for _, pendingID := range ids {
+				if err != nil {
+					l.errs[pendingID] = err
+				} else if v, ok := found[pendingID]; ok {
+					l.results[pendingID] = v
+				} else {
+					l.results[pendingID] = l.missing()
+				}
+			}
+		}
+
+		if err := l.errs[id]; err != nil {
+			return nil, err
+		}
+		return l.results[id], nil
+	}
+}
+
+// loaders holds one request's loaders. List loaders are kept per filter, since
+// include_deleted changes what they return.
+type loaders struct {
+	mu           sync.Mutex
+	rooms        *loader[*models.Room]
+	guests       *loader[*models.Guest]
+	guestsByRoom map[database.ListFilter]*loader[[]models.Guest]
+	paymentsBy   map[database.ListFilter]*loader[[]models.Payment]
+	documents    *loader[[]models.GuestDocument]
+}
+
+type loadersKey struct{}
+
+// WithLoaders gives each GraphQL request its own loaders, so batching and caching
+// never leak between requests or users
+func WithLoaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), loadersKey{}, newLoaders())
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// loadersFrom returns the request's loaders, or fresh ones when the schema is
+// executed outside WithLoaders
+func loadersFrom(ctx context.Context) *loaders {
+	if l, ok := ctx.Value(loadersKey{}).(*loaders); ok {
+		return l
+	}
+	return newLoaders()
+}
+
+func newLoaders() *loaders {
+	return &loaders{
+		rooms: newLoader(func(ctx context.Context, ids []int) (map[int]*models.Room, error) {
+			rooms, err := database.GetRoomsByIDs(ctx, ids)
+			if err != nil {
+				return nil, err
+			}
+			byID := make(map[int]*models.Room, len(rooms))
+			for i := range rooms {
+				byID[rooms[i].ID] = &rooms[i]
+			}
+			return byID, nil
+		}, func() *models.Room { return nil }),
+
+		guests: newLoader(func(ctx context.Context, ids []int) (map[int]*models.Guest, error) {
+			guests, err := database.GetGuestsByIDs(ctx, ids)
+			if err != nil {
+				return nil, err
+			}
+			byID := make(map[int]*models.Guest, len(guests))
+			for i := range guests {
+				byID[guests[i].ID] = &guests[i]
+			}
+			return byID, nil
+		}, func() *models.Guest { return nil }),
+
+		documents: newLoader(func(ctx context.Context, guestIDs []int) (map[int][]models.GuestDocument, error) {
+			docs, err := database.GetDocumentsByGuestIDs(ctx, guestIDs)
+			if err != nil {
+				return nil, err
+			}
+			byGuest := map[int][]models.GuestDocument{}
+			for _, d := range docs {
+				byGuest[d.GuestID] = append(byGuest[d.GuestID], d)
+			}
+			return byGuest, nil
+		}, func() []models.GuestDocument { return []models.GuestDocument{} }),
+
+		guestsByRoom: map[database.ListFilter]*loader[[]models.Guest]{},
+		paymentsBy:   map[database.ListFilter]*loader[[]models.Payment]{},
+	}
+}
+
+func (l *loaders) guestsInRoom(filter database.ListFilter) *loader[[]models.Guest] {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if ld, ok := l.guestsByRoom[filter]; ok {
+		return ld
+	}
+	ld := newLoader(func(ctx context.Context, roomIDs []int) (map[int][]models.Guest, error) {
+		guests, err := database.GetGuestsByRoomIDs(ctx, roomIDs, filter)
+		if err != nil {
+			return nil, err
+		}
+		byRoom := map[int][]models.Guest{}
+		for _, g := range guests {
+			byRoom[g.RoomID] = append(byRoom[g.RoomID], g)
+		}
+		return byRoom, nil
+	}, func() []models.Guest { return []models.Guest{} })
+	l.guestsByRoom[filter] = ld
+	return ld
+}
+
+func (l *loaders) paymentsOfGuest(filter database.ListFilter) *loader[[]models.Payment] {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if ld, ok := l.paymentsBy[filter]; ok {
+		return ld
+	}
+	ld := newLoader(func(ctx context.Context, guestIDs []int) (map[int][]models.Payment, error) {
+		payments, err := database.GetPaymentsByGuestIDs(ctx, guestIDs, filter)
+		if err != nil {
+			return nil, err
+		}
+		byGuest := map[int][]models.Payment{}
+		for _, p := range payments {
+			byGuest[p.GuestID] = append(byGuest[p.GuestID], p)
+		}
+		return byGuest, nil
+	}, func() []models.Payment { return []models.Payment{} })
+	l.paymentsBy[filter] = ld
+	return ld
+}
@@ -0,0 +1,181 @@
+package gql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"pg-management-system/internal/database"
+	"pg-management-system/internal/handlers"
+	"pg-management-system/internal/middleware"
+
+	"github.com/graphql-go/graphql"
+)
+
+// countingDriver serves canned rooms, guests and payments and counts the queries
+// it is sent. Every room has two guests and every guest three payments.
+type countingDriver struct {
+	mu      sync.Mutex
+	rooms   int
+	queries []string
+}
+
+var fakeDB = &countingDriver{}
+
+func init() {
+	sql.Register("gql-counting", fakeDB)
+}
+
+func (d *countingDriver) Open(string) (driver.Conn, error) { return fakeConn{d}, nil }
+
+func (d *countingDriver) reset(rooms int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.rooms, d.queries = rooms, nil
+}
+
+func (d *countingDriver) count() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.queries)
+}
+
+type fakeConn struct{ d *countingDriver }
+
+func (c fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c fakeConn) Close() error                        { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (c fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.d.mu.Lock()
+	c.d.queries = append(c.d.queries, query)
+	rooms := c.d.rooms
+	c.d.mu.Unlock()
+
+	joined := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	rows := &fakeRows{}
+	switch {
+	case strings.Contains(query, "FROM rooms"):
+		rows.cols = []string{"id", "room_number", "capacity", "occupancy", "price", "deleted_at", "version"}
+		for id := 1; id <= rooms; id++ {
+			rows.values = append(rows.values, []driver.Value{int64(id), "R" + strconv.Itoa(id), int64(2), int64(2), 5000.0, nil, int64(1)})
+		}
+	case strings.Contains(query, "FROM guests WHERE room_id = ANY"):
+		rows.cols = []string{"id", "name", "email", "phone", "room_id", "join_date", "deleted_at", "left_at", "version"}
+		for _, roomID := range arrayArg(args) {
+			for k := 0; k < 2; k++ {
+				id := roomID*10 + k
+				rows.values = append(rows.values, []driver.Value{int64(id), "Guest", fmt.Sprintf("g%d@example.com", id), "", int64(roomID), joined, nil, nil, int64(1)})
+			}
+		}
+	case strings.Contains(query, "FROM payments"):
+		rows.cols = []string{"id", "guest_id", "amount", "payment_date", "payment_method", "deleted_at", "version"}
+		for _, guestID := range arrayArg(args) {
+			for k := 0; k < 3; k++ {
+				rows.values = append(rows.values, []driver.Value{int64(guestID*10 + k), int64(guestID), 5000.0, joined, "UPI", nil, int64(1)})
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unexpected query %s", query)
+	}
+	return rows, nil
+}
+
+// arrayArg reads the id list of an "= ANY($1)" query, which pq sends as "{1,2,3}"
+func arrayArg(args []driver.NamedValue) []int {
+	s, _ := args[0].Value.(string)
+	var ids []int
+	for _, part := range strings.Split(strings.Trim(s, "{}"), ",") {
+		if id, err := strconv.Atoi(part); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+type fakeRows struct {
+	cols   []string
+	values [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.cols }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func useCountingDB(t *testing.T) {
+	t.Helper()
+	// Guests are read through the PII keyring, even though these are plaintext
+	t.Setenv("PII_KEYS", "test:"+base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32))))
+	t.Setenv("PII_INDEX_KEY", base64.StdEncoding.EncodeToString([]byte(strings.Repeat("i", 32))))
+
+	db, err := sql.Open("gql-counting", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prevDB, prevReplica := database.DB, database.Replica
+	database.DB, database.Replica = db, nil
+	t.Cleanup(func() {
+		database.DB, database.Replica = prevDB, prevReplica
+		db.Close()
+	})
+}
+
+// TestNestedRelationsUseOneQueryPerLevel checks that rooms -> guests -> payments
+// costs one query per level however many rows each level returns
+func TestNestedRelationsUseOneQueryPerLevel(t *testing.T) {
+	useCountingDB(t)
+	claims := &handlers.Claims{UserID: 1, Email: "admin@example.com", Role: "admin"}
+
+	for _, rooms := range []int{1, 5, 50} {
+		fakeDB.reset(rooms)
+		ctx := context.WithValue(context.Background(), middleware.UserClaimsKey, claims)
+		ctx = context.WithValue(ctx, loadersKey{}, newLoaders())
+		result := graphql.Do(graphql.Params{
+			Schema:        Schema,
+			Context:       ctx,
+			RequestString: `{ rooms { id guests { id payments { id } } } }`,
+		})
+		if len(result.Errors) > 0 {
+			t.Fatalf("%d rooms: %v", rooms, result.Errors)
+		}
+
+		var got struct {
+			Rooms []struct {
+				Guests []struct {
+					Payments []struct{ ID int }
+				}
+			}
+		}
+		decodeResult(t, result.Data, &got)
+		payments := 0
+		for _, room := range got.Rooms {
+			for _, guest := range room.Guests {
+				payments += len(guest.Payments)
+			}
+		}
+		if len(got.Rooms) != rooms || payments != rooms*2*3 {
+			t.Fatalf("%d rooms: got %d rooms and %d payments", rooms, len(got.Rooms), payments)
+		}
+
+		if n := fakeDB.count(); n != 3 {
+			t.Errorf("%d rooms took %d queries, want 3:\n%s", rooms, n, strings.Join(fakeDB.queries, "\n"))
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package gql
+
+import (
+	"time"
+
+	"pg-management-system/internal/response"
+)
+
+// UserError is an entry of a mutation payload's errors list
+type UserError struct {
+	Field   *string `json:"field"`
+	Message string  `json:"message"`
+	Code    string  `json:"code"`
+}
+
+// payload builds a mutation result holding value under key. Errors the user can
+// fix, classified as the REST API does, go in the payload's errors list; anything
+// else fails the field as usual.
+func payload(key string, value interface{}, err error) (interface{}, error) {
+	if err == nil {
+		return map[string]interface{}{key: value, "errors": []UserError{}}, nil
+	}
+	problem, ok := response.Classify(err)
+	if !ok {
+		return nil, err
+	}
+	return map[string]interface{}{key: nil, "errors": userErrors(problem)}, nil
+}
+
+// deletePayload reports the outcome of a delete mutation
+func deletePayload(err error) (interface{}, error) {
+	result, err := payload("deleted", true, err)
+	if m, ok := result.(map[string]interface{}); ok && m["deleted"] == nil {
+		m["deleted"] = false
+	}
+	return result, err
+}
+
+func userErrors(p response.Problem) []UserError {
+	if len(p.Fields) == 0 {
+		return []UserError{{Message: p.Message, Code: p.Code}}
+	}
+	errs := make([]UserError, len(p.Fields))
+	for i, f := range p.Fields {
+		field := f.Field
+		errs[i] = UserError{Field: &field, Message: f.Message, Code: p.Code}
+	}
+	return errs
+}
+
+// input reads fields of an input object argument. Absent optional fields read as
+// their zero value.
+type input map[string]interface{}
+
+func inputArg(args map[string]interface{}) input {
+	in, _ := args["input"].(map[string]interface{})
+	return in
+}
+
+func (in input) string(name string) string {
+	s, _ := in[name].(string)
+	return s
+}
+
+func (in input) int(name string) int {
+	n, _ := in[name].(int)
+	return n
+}
+
+func (in input) money(name string) float64 {
+	f, _ := in[name].(float64)
+	return f
+}
+
+func (in input) time(name string) time.Time {
+	t, _ := in[name].(time.Time)
+	return t
+}
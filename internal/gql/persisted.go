@@ -0,0 +1,306 @@
+package gql
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pg-management-system/internal/database"
+	"pg-management-system/internal/handlers"
+	"pg-management-system/internal/models"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/graphql-go/handler"
+)
+
+// maxCachedQueries bounds the in-memory copy of the persisted_queries table
+const maxCachedQueries = 5000
+
+// cacheTTL is how long a cached query is trusted, so queries removed or changed
+// with pgctl stop applying on running servers within that time
+const cacheTTL = time.Minute
+
+// Defaults for the number of queries clients may register themselves
+const (
+	DefaultMaxRegistered        = 5000
+	DefaultMaxRegisteredPerUser = 100
+)
+
+// QueryStore resolves persisted query hashes, caching the database table in memory.
+// It implements Apollo's automatic persisted queries: a client sends only the
+// SHA-256 hash of its query and, when the server does not know it yet, retries
+// once with the full text, which is then registered.
+type QueryStore struct {
+	// Allowlist only runs queries registered ahead of time with pgctl. Admins are
+	// exempt, like they are from the introspection block in production.
+	Allowlist bool
+	// MaxRegistered bounds the queries clients may register in total, and
+	// MaxRegisteredPerUser those one user may register; admins only count towards
+	// the total. Queries beyond them still run but are not stored.
+	MaxRegistered        int
+	MaxRegisteredPerUser int
+
+	mu    sync.RWMutex
+	cache map[string]cachedQuery
+}
+
+type cachedQuery struct {
+	query   *models.PersistedQuery
+	expires time.Time
+}
+
+// NewQueryStore returns an empty store with the default registration limits
+func NewQueryStore(allowlist bool) *QueryStore {
+	return &QueryStore{
+		Allowlist:            allowlist,
+		MaxRegistered:        DefaultMaxRegistered,
+		MaxRegisteredPerUser: DefaultMaxRegisteredPerUser,
+		cache:                map[string]cachedQuery{},
+	}
+}
+
+// QueryStoreFromEnv enables allowlist mode from GRAPHQL_ALLOWLIST, which defaults
+// to on when APP_ENV is production, and reads the registration limits from
+// GRAPHQL_APQ_MAX and GRAPHQL_APQ_MAX_PER_USER
+func QueryStoreFromEnv() *QueryStore {
+	allowlist := os.Getenv("APP_ENV") == "production"
+	if raw := os.Getenv("GRAPHQL_ALLOWLIST"); raw != "" {
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			log.Printf("Warning: invalid GRAPHQL_ALLOWLIST %q, using %v", raw, allowlist)
+		} else {
+			allowlist = v
+		}
+	}
+	s := NewQueryStore(allowlist)
+	s.MaxRegistered = envInt("GRAPHQL_APQ_MAX", s.MaxRegistered)
+	s.MaxRegisteredPerUser = envInt("GRAPHQL_APQ_MAX_PER_USER", s.MaxRegisteredPerUser)
+	return s
+}
+
+// QueryHash is the persisted query id of a document: the hex SHA-256 of its exact text
+func QueryHash(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
+
+// persistedQueryExtension is extensions.persistedQuery of an Apollo request
+type persistedQueryExtension struct {
+	Version    int    `json:"version"`
+	SHA256Hash string `json:"sha256Hash"`
+}
+
+type requestExtensions struct {
+	PersistedQuery *persistedQueryExtension `json:"persistedQuery"`
+}
+
+// resolve returns the query text to execute for a request carrying query and/or
+// a persisted query hash, or why it may not run
+func (s *QueryStore) resolve(ctx context.Context, query string, ext *persistedQueryExtension, isAdmin bool) (string, *rejection) {
+	if ext != nil {
+		if ext.Version != 1 {
+			return "", &rejection{http.StatusBadRequest, "PERSISTED_QUERY_VERSION_NOT_SUPPORTED", "persisted query version must be 1"}
+		}
+		hash := strings.ToLower(ext.SHA256Hash)
+		if query == "" {
+			stored, err := s.lookup(ctx, hash)
+			if err != nil {
+				log.Printf("Persisted query lookup failed: %v", err)
+				return "", &rejection{http.StatusInternalServerError, "INTERNAL_SERVER_ERROR", "could not look up persisted query"}
+			}
+			if stored == nil || (s.Allowlist && !stored.Allowlisted && !isAdmin) {
+				// Apollo clients retry with the full query on this exact message, and
+				// turn persisted queries off on 4xx statuses, hence 200
+				return "", &rejection{http.StatusOK, "PERSISTED_QUERY_NOT_FOUND", "PersistedQueryNotFound"}
+			}
+			return stored.Query, nil
+		}
+		if QueryHash(query) != hash {
+			return "", &rejection{http.StatusBadRequest, "PERSISTED_QUERY_HASH_MISMATCH", "provided sha256Hash does not match query"}
+		}
+	}
+	if query == "" {
+		return "", nil
+	}
+
+	if s.Allowlist && !isAdmin {
+		stored, err := s.lookup(ctx, QueryHash(query))
+		if err != nil {
+			log.Printf("Persisted query lookup failed: %v", err)
+			return "", &rejection{http.StatusInternalServerError, "INTERNAL_SERVER_ERROR", "could not look up persisted query"}
+		}
+		if stored == nil || !stored.Allowlisted {
+			return "", &rejection{http.StatusForbidden, "OPERATION_NOT_ALLOWLISTED", "only pre-registered operations may run"}
+		}
+		return query, nil
+	}
+
+	if ext != nil && !s.Allowlist {
+		s.register(ctx, query)
+	}
+	return query, nil
+}
+
+// cached returns a query cached less than cacheTTL ago
+func (s *QueryStore) cached(hash string) (*models.PersistedQuery, bool) {
+	s.mu.RLock()
+	c, ok := s.cache[hash]
+	s.mu.RUnlock()
+	if !ok || time.Now().After(c.expires) {
+		return nil, false
+	}
+	return c.query, true
+}
+
+// lookup finds a stored query, returning nil when the hash is unknown
+func (s *QueryStore) lookup(ctx context.Context, hash string) (*models.PersistedQuery, error) {
+	if q, ok := s.cached(hash); ok {
+		return q, nil
+	}
+
+	q, err := database.GetPersistedQuery(ctx, hash)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// In allowlist mode, an automatically registered query may be allowlisted later,
+	// so only cache the answer that cannot change
+	if !s.Allowlist || q.Allowlisted {
+		s.remember(q)
+	}
+	return q, nil
+}
+
+// register stores a query sent with its hash, as long as it is valid against the
+// schema and the caller has not used up the registration limits; invalid queries
+// are left for the handler to report
+func (s *QueryStore) register(ctx context.Context, query string) {
+	hash := QueryHash(query)
+	if _, known := s.cached(hash); known {
+		return
+	}
+
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(query)})})
+	if err != nil {
+		return
+	}
+	if !graphql.ValidateDocument(&Schema, doc, nil).IsValid {
+		return
+	}
+
+	userID, perUser := 0, s.MaxRegisteredPerUser
+	if claims, ok := handlers.ClaimsFromContext(ctx); ok && claims != nil {
+		userID = claims.UserID
+		if claims.Role == "admin" {
+			perUser = s.MaxRegistered
+		}
+	}
+
+	q := &models.PersistedQuery{Hash: hash, Query: query}
+	stored, err := database.RegisterPersistedQuery(ctx, q, userID, perUser, s.MaxRegistered)
+	if err != nil {
+		log.Printf("Failed to register persisted query %s: %v", hash, err)
+		return
+	}
+	if stored {
+		s.remember(q)
+	}
+}
+
+func (s *QueryStore) remember(q *models.PersistedQuery) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.cache) >= maxCachedQueries {
+		s.cache = map[string]cachedQuery{}
+	}
+	s.cache[q.Hash] = cachedQuery{query: q, expires: time.Now().Add(cacheTTL)}
+}
+
+// PersistedQueries resolves persisted query hashes and enforces allowlist mode
+// before next runs. Requests are rewritten to carry the full query text, so next
+// can be the stock graphql-go handler. It must run after AuthMiddleware.
+func PersistedQueries(store *QueryStore, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := handlers.ClaimsFromContext(r.Context())
+		isAdmin := claims != nil && claims.Role == "admin"
+
+		if r.Method == http.MethodGet {
+			params := r.URL.Query()
+			var ext requestExtensions
+			if raw := params.Get("extensions"); raw != "" {
+				if err := json.Unmarshal([]byte(raw), &ext); err != nil {
+					graphqlError(w, http.StatusBadRequest, "BAD_REQUEST", "extensions must be a JSON object")
+					return
+				}
+			}
+			query, rej := store.resolve(r.Context(), params.Get("query"), ext.PersistedQuery, isAdmin)
+			if rej != nil {
+				graphqlError(w, rej.status, rej.code, rej.message)
+				return
+			}
+			if query != "" {
+				params.Set("query", query)
+				r.URL.RawQuery = params.Encode()
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBody))
+		if err != nil {
+			graphqlError(w, http.StatusRequestEntityTooLarge, "REQUEST_TOO_LARGE", "request body is too large")
+			return
+		}
+
+		// JSON bodies may carry extensions; other encodings only go through the allowlist
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(body, &fields) != nil || fields == nil {
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			opts := handler.NewRequestOptions(r)
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			if _, rej := store.resolve(r.Context(), opts.Query, nil, isAdmin); rej != nil {
+				graphqlError(w, rej.status, rej.code, rej.message)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var query string
+		var ext requestExtensions
+		json.Unmarshal(fields["query"], &query)
+		if raw, ok := fields["extensions"]; ok {
+			if err := json.Unmarshal(raw, &ext); err != nil {
+				graphqlError(w, http.StatusBadRequest, "BAD_REQUEST", "extensions must be a JSON object")
+				return
+			}
+		}
+		resolved, rej := store.resolve(r.Context(), query, ext.PersistedQuery, isAdmin)
+		if rej != nil {
+			graphqlError(w, rej.status, rej.code, rej.message)
+			return
+		}
+		if resolved != query {
+			fields["query"], _ = json.Marshal(resolved)
+			body, _ = json.Marshal(fields)
+			r.ContentLength = int64(len(body))
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,41 @@
+package gql
+
+import (
+	"testing"
+	"time"
+
+	"pg-management-system/internal/models"
+)
+
+func TestQueryStoreCacheExpires(t *testing.T) {
+	s := NewQueryStore(false)
+	q := &models.PersistedQuery{Hash: QueryHash("{ rooms { id } }"), Query: "{ rooms { id } }"}
+	s.remember(q)
+	if got, ok := s.cached(q.Hash); !ok || got != q {
+		t.Fatalf("cached = %v, %v right after remember", got, ok)
+	}
+
+	// A query removed with pgctl stops resolving once its entry expires
+	s.mu.Lock()
+	s.cache[q.Hash] = cachedQuery{query: q, expires: time.Now().Add(-time.Second)}
+	s.mu.Unlock()
+	if _, ok := s.cached(q.Hash); ok {
+		t.Error("expired entry still served from the cache")
+	}
+}
+
+func TestQueryStoreFromEnvReadsLimits(t *testing.T) {
+	t.Setenv("GRAPHQL_APQ_MAX", "50")
+	t.Setenv("GRAPHQL_APQ_MAX_PER_USER", "3")
+	s := QueryStoreFromEnv()
+	if s.MaxRegistered != 50 || s.MaxRegisteredPerUser != 3 {
+		t.Errorf("limits = %d, %d, want 50, 3", s.MaxRegistered, s.MaxRegisteredPerUser)
+	}
+
+	t.Setenv("GRAPHQL_APQ_MAX", "")
+	t.Setenv("GRAPHQL_APQ_MAX_PER_USER", "")
+	s = QueryStoreFromEnv()
+	if s.MaxRegistered != DefaultMaxRegistered || s.MaxRegisteredPerUser != DefaultMaxRegisteredPerUser {
+		t.Errorf("default limits = %d, %d", s.MaxRegistered, s.MaxRegisteredPerUser)
+	}
+}
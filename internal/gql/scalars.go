@@ -0,0 +1,116 @@
+package gql
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// scalars implements the custom scalars declared in schema.graphql
+var scalars = map[string]*graphql.Scalar{
+	"DateTime": dateTime,
+	"Money":    money,
+	"Upload":   upload,
+}
+
+// dateTime is an RFC 3339 timestamp. Output keeps sub-second precision and the
+// stored offset; input must include an offset, e.g. 2026-01-31T18:30:00+05:30.
+var dateTime = graphql.NewScalar(graphql.ScalarConfig{
+	Name: "DateTime",
+	Serialize: func(value interface{}) interface{} {
+		switch v := value.(type) {
+		case time.Time:
+			return v.Format(time.RFC3339Nano)
+		case *time.Time:
+			if v == nil {
+				return nil
+			}
+			return v.Format(time.RFC3339Nano)
+		}
+		return nil
+	},
+	ParseValue: func(value interface{}) interface{} {
+		if s, ok := value.(string); ok {
+			return parseDateTime(s)
+		}
+		return nil
+	},
+	ParseLiteral: func(value ast.Value) interface{} {
+		if s, ok := value.(*ast.StringValue); ok {
+			return parseDateTime(s.Value)
+		}
+		return nil
+	},
+})
+
+func parseDateTime(s string) interface{} {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return nil
+	}
+	return t
+}
+
+// money is an amount with at most two decimal places. It is written as a string
+// such as "8500.00" so clients never see float rounding, and read from a string
+// or a number.
+var money = graphql.NewScalar(graphql.ScalarConfig{
+	Name: "Money",
+	Serialize: func(value interface{}) interface{} {
+		switch v := value.(type) {
+		case float64:
+			return strconv.FormatFloat(v, 'f', 2, 64)
+		case *float64:
+			if v == nil {
+				return nil
+			}
+			return strconv.FormatFloat(*v, 'f', 2, 64)
+		}
+		return nil
+	},
+	ParseValue: func(value interface{}) interface{} {
+		switch v := value.(type) {
+		case string:
+			return parseMoney(v)
+		case float64:
+			return checkCents(v)
+		case int:
+			return float64(v)
+		}
+		return nil
+	},
+	ParseLiteral: func(value ast.Value) interface{} {
+		switch v := value.(type) {
+		case *ast.StringValue:
+			return parseMoney(v.Value)
+		case *ast.IntValue:
+			return parseMoney(v.Value)
+		case *ast.FloatValue:
+			return parseMoney(v.Value)
+		}
+		return nil
+	},
+})
+
+func parseMoney(s string) interface{} {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil
+	}
+	return checkCents(f)
+}
+
+// checkCents rejects amounts with fractions of a paisa, which the database would round
+func checkCents(f float64) interface{} {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil
+	}
+	cents := f * 100
+	if math.Abs(cents-math.Round(cents)) > 1e-6 {
+		return nil
+	}
+	return f
+}
@@ -1,352 +1,482 @@
 package gql
 
 import (
-	"errors"
+	_ "embed"
+	"fmt"
 	"log"
 	"time"
 
 	"pg-management-system/internal/database"
+	"pg-management-system/internal/documents"
+	"pg-management-system/internal/events"
 	"pg-management-system/internal/handlers"
 	"pg-management-system/internal/middleware"
 	"pg-management-system/internal/models"
+	"pg-management-system/internal/pii"
+	"pg-management-system/internal/validation"
 
 	"github.com/graphql-go/graphql"
 )
 
-// requireAdmin checks if the request context has an admin role
-func requireAdmin(p graphql.ResolveParams) error {
-	claims, ok := p.Context.Value(middleware.UserClaimsKey).(*handlers.Claims)
-	if !ok || claims == nil {
-		return errors.New("unauthorized: no valid session")
+// listFilter builds the list filter from the include_deleted argument, which only admins may use
+func listFilter(p graphql.ResolveParams) database.ListFilter {
+	includeDeleted, _ := p.Args["include_deleted"].(bool)
+	return database.ListFilter{IncludeDeleted: includeDeleted && authorize(p, []string{"admin"}) == nil}
+}
+
+// rawJSON exposes a JSON column of an audit entry as a string
+func rawJSON(field string) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		entry, ok := p.Source.(models.AuditEntry)
+		if !ok {
+			return nil, nil
+		}
+		if field == "before" {
+			return string(entry.Before), nil
+		}
+		return string(entry.After), nil
 	}
-	if claims.Role != "admin" {
-		return errors.New("forbidden: admin access required")
+}
+
+// maskedGuest resolves a guest's email or phone in full, or masked for roles that
+// may not see it, like the REST handlers do
+func maskedGuest(field string) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		guest, ok := sourceGuest(p.Source)
+		if !ok {
+			return nil, nil
+		}
+		value := guest.Email
+		if field == pii.GuestPhone {
+			value = guest.Phone
+		}
+		return pii.Visible(callerRole(p), field, value), nil
 	}
-	return nil
 }
 
-// Define Types
-// Define Types
-var roomType = graphql.NewObject(graphql.ObjectConfig{
-	Name: "Room",
-	Fields: graphql.Fields{
-		"id":          &graphql.Field{Type: graphql.Int},
-		"room_number": &graphql.Field{Type: graphql.String},
-		"capacity":    &graphql.Field{Type: graphql.Int},
-		"occupancy":   &graphql.Field{Type: graphql.Int},
-		"price":       &graphql.Field{Type: graphql.Float},
-	},
-})
+func callerRole(p graphql.ResolveParams) string {
+	if claims, ok := p.Context.Value(middleware.UserClaimsKey).(*handlers.Claims); ok && claims != nil {
+		return claims.Role
+	}
+	return ""
+}
 
-var guestType = graphql.NewObject(graphql.ObjectConfig{
-	Name: "Guest",
-	Fields: graphql.Fields{
-		"id":        &graphql.Field{Type: graphql.Int},
-		"name":      &graphql.Field{Type: graphql.String},
-		"email":     &graphql.Field{Type: graphql.String},
-		"phone":     &graphql.Field{Type: graphql.String},
-		"room_id":   &graphql.Field{Type: graphql.Int},
-		"join_date": &graphql.Field{Type: graphql.String}, // Simplified as string for simplicity
-	},
-})
+// sourceRoom, sourceGuest and sourcePayment unwrap the parent object of a field,
+// which is a value when it came from a list and a pointer when it came from a lookup
 
-var paymentType = graphql.NewObject(graphql.ObjectConfig{
-	Name: "Payment",
-	Fields: graphql.Fields{
-		"id":             &graphql.Field{Type: graphql.Int},
-		"guest_id":       &graphql.Field{Type: graphql.Int},
-		"amount":         &graphql.Field{Type: graphql.Float},
-		"payment_date":   &graphql.Field{Type: graphql.String},
-		"payment_method": &graphql.Field{Type: graphql.String},
-	},
-})
+func sourceRoom(src interface{}) (*models.Room, bool) {
+	switch v := src.(type) {
+	case models.Room:
+		return &v, true
+	case *models.Room:
+		return v, v != nil
+	}
+	return nil, false
+}
 
-// Define Root Query
-var rootQuery = graphql.NewObject(graphql.ObjectConfig{
-	Name: "Query",
-	Fields: graphql.Fields{
-		"rooms": &graphql.Field{
-			Type: graphql.NewList(roomType),
-			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				return database.GetAllRooms()
-			},
-		},
-		"room": &graphql.Field{
-			Type: roomType,
-			Args: graphql.FieldConfigArgument{
-				"id": &graphql.ArgumentConfig{Type: graphql.Int},
-			},
-			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				id, _ := p.Args["id"].(int)
-				return database.GetRoomByID(id)
-			},
-		},
-		"guests": &graphql.Field{
-			Type: graphql.NewList(guestType),
-			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				return database.GetAllGuests()
-			},
-		},
-		"guest": &graphql.Field{
-			Type: guestType,
-			Args: graphql.FieldConfigArgument{
-				"id": &graphql.ArgumentConfig{Type: graphql.Int},
-			},
-			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				id, _ := p.Args["id"].(int)
-				return database.GetGuestByID(id)
-			},
-		},
-		"allPayments": &graphql.Field{
-			Type: graphql.NewList(paymentType),
-			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				return database.GetAllPayments()
-			},
-		},
-		"payment": &graphql.Field{
-			Type: paymentType,
-			Args: graphql.FieldConfigArgument{
-				"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
-			},
-			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				id, _ := p.Args["id"].(int)
-				return database.GetPaymentByID(id)
-			},
-		},
-		"payments": &graphql.Field{
-			Type: graphql.NewList(paymentType),
-			Args: graphql.FieldConfigArgument{
-				"guest_id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
-			},
-			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				guestID, _ := p.Args["guest_id"].(int)
-				return database.GetPaymentsByGuestID(guestID)
-			},
-		},
-	},
-})
+func sourceGuest(src interface{}) (*models.Guest, bool) {
+	switch v := src.(type) {
+	case models.Guest:
+		return &v, true
+	case *models.Guest:
+		return v, v != nil
+	}
+	return nil, false
+}
 
-// Define Mutation
-var rootMutation = graphql.NewObject(graphql.ObjectConfig{
-	Name: "Mutation",
-	Fields: graphql.Fields{
-		// Room Mutations
-		"createRoom": &graphql.Field{
-			Type: roomType,
-			Args: graphql.FieldConfigArgument{
-				"room_number": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
-				"capacity":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
-				"price":       &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Float)},
-			},
-			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				room := models.Room{
-					RoomNumber: p.Args["room_number"].(string),
-					Capacity:   p.Args["capacity"].(int),
-					Price:      p.Args["price"].(float64),
-				}
-				err := database.CreateRoom(&room)
-				if err != nil {
-					return nil, err
-				}
-				return room, nil
-			},
-		},
-		"updateRoom": &graphql.Field{
-			Type: roomType,
-			Args: graphql.FieldConfigArgument{
-				"id":          &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
-				"room_number": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
-				"capacity":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
-				"occupancy":   &graphql.ArgumentConfig{Type: graphql.Int}, // Optional
-				"price":       &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Float)},
-			},
-			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				if err := requireAdmin(p); err != nil {
-					return nil, err
-				}
-				id := p.Args["id"].(int)
-				room := models.Room{
-					RoomNumber: p.Args["room_number"].(string),
-					Capacity:   p.Args["capacity"].(int),
-					Price:      p.Args["price"].(float64),
-				}
-				if val, ok := p.Args["occupancy"].(int); ok {
-					room.Occupancy = val
-				}
-				err := database.UpdateRoom(id, &room)
-				if err != nil {
-					return nil, err
-				}
-				room.ID = id
-				return room, nil
-			},
-		},
-		"deleteRoom": &graphql.Field{
-			Type: graphql.Boolean,
-			Args: graphql.FieldConfigArgument{
-				"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
-			},
-			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				if err := requireAdmin(p); err != nil {
-					return nil, err
-				}
-				id := p.Args["id"].(int)
-				err := database.DeleteRoom(id)
-				if err != nil {
-					return false, err
-				}
-				return true, nil
-			},
-		},
+func sourcePayment(src interface{}) (*models.Payment, bool) {
+	switch v := src.(type) {
+	case models.Payment:
+		return &v, true
+	case *models.Payment:
+		return v, v != nil
+	}
+	return nil, false
+}
 
-		// Guest Mutations
-		"createGuest": &graphql.Field{
-			Type: guestType,
-			Args: graphql.FieldConfigArgument{
-				"name":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
-				"email":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
-				"phone":   &graphql.ArgumentConfig{Type: graphql.String},
-				"room_id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
-			},
-			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				guest := models.Guest{
-					Name:     p.Args["name"].(string),
-					Email:    p.Args["email"].(string),
-					Phone:    p.Args["phone"].(string),
-					RoomID:   p.Args["room_id"].(int),
-					JoinDate: time.Now(),
-				}
-				err := database.CreateGuest(&guest)
-				if err != nil {
-					return nil, err
-				}
-				return guest, nil
-			},
-		},
-		"updateGuest": &graphql.Field{
-			Type: guestType,
-			Args: graphql.FieldConfigArgument{
-				"id":      &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
-				"name":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
-				"email":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
-				"phone":   &graphql.ArgumentConfig{Type: graphql.String},
-				"room_id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
-			},
-			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				if err := requireAdmin(p); err != nil {
-					return nil, err
-				}
-				id := p.Args["id"].(int)
-				guest := models.Guest{
-					Name:   p.Args["name"].(string),
-					Email:  p.Args["email"].(string),
-					Phone:  p.Args["phone"].(string),
-					RoomID: p.Args["room_id"].(int),
-				}
-				err := database.UpdateGuest(id, &guest)
-				if err != nil {
-					return nil, err
-				}
-				guest.ID = id
-				return guest, nil
-			},
-		},
-		"deleteGuest": &graphql.Field{
-			Type: graphql.Boolean,
-			Args: graphql.FieldConfigArgument{
-				"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
-			},
-			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				if err := requireAdmin(p); err != nil {
-					return nil, err
-				}
-				id := p.Args["id"].(int)
-				err := database.DeleteGuest(id)
-				if err != nil {
-					return false, err
-				}
-				return true, nil
-			},
-		},
+func sourceDocument(src interface{}) (*models.GuestDocument, bool) {
+	switch v := src.(type) {
+	case models.GuestDocument:
+		return &v, true
+	case *models.GuestDocument:
+		return v, v != nil
+	}
+	return nil, false
+}
 
-		// Payment Mutation
-		"createPayment": &graphql.Field{
-			Type: paymentType,
-			Args: graphql.FieldConfigArgument{
-				"guest_id":       &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
-				"amount":         &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Float)},
-				"payment_method": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
-			},
-			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				payment := models.Payment{
-					GuestID:       p.Args["guest_id"].(int),
-					Amount:        p.Args["amount"].(float64),
-					PaymentMethod: p.Args["payment_method"].(string),
-					PaymentDate:   time.Now(),
-				}
-				err := database.CreatePayment(&payment)
-				if err != nil {
-					return nil, err
-				}
-				return payment, nil
-			},
-		},
-		"updatePayment": &graphql.Field{
-			Type: paymentType,
-			Args: graphql.FieldConfigArgument{
-				"id":             &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
-				"guest_id":       &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
-				"amount":         &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Float)},
-				"payment_method": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
-			},
-			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				if err := requireAdmin(p); err != nil {
-					return nil, err
-				}
-				id := p.Args["id"].(int)
-				payment := models.Payment{
-					ID:            id,
-					GuestID:       p.Args["guest_id"].(int),
-					Amount:        p.Args["amount"].(float64),
-					PaymentMethod: p.Args["payment_method"].(string),
-					PaymentDate:   time.Now(), // Or fetch current and keep it, but Repository uses this.
-				}
-				err := database.UpdatePayment(&payment)
-				if err != nil {
-					return nil, err
+// subscribe streams topic's events that match the field's arguments. The stream
+// ends when the subscription's context is cancelled.
+func subscribe(topic events.Topic, match func(args map[string]interface{}, payload interface{}) bool) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		in, cancel := events.Subscribe(topic)
+		out := make(chan interface{})
+		go func() {
+			defer close(out)
+			defer cancel()
+			for {
+				select {
+				case <-p.Context.Done():
+					return
+				case payload := <-in:
+					if !match(p.Args, payload) {
+						continue
+					}
+					select {
+					case out <- payload:
+					case <-p.Context.Done():
+						return
+					}
 				}
-				return payment, nil
-			},
-		},
-		"deletePayment": &graphql.Field{
-			Type: graphql.Boolean,
-			Args: graphql.FieldConfigArgument{
-				"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
-			},
-			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				if err := requireAdmin(p); err != nil {
-					return nil, err
-				}
-				id := p.Args["id"].(int)
-				err := database.DeletePayment(id)
-				if err != nil {
-					return false, err
-				}
-				return true, nil
-			},
-		},
+			}
+		}()
+		return out, nil
+	}
+}
+
+// argMatches reports whether the optional Int argument name is absent or equal to id
+func argMatches(args map[string]interface{}, name string, id int) bool {
+	want, ok := args[name].(int)
+	return !ok || want == id
+}
+
+// resolvers binds the fields of schema.graphql to the repositories. Who may call
+// them is declared with @auth in the SDL, see auth.go.
+var resolvers = Resolvers{
+	"AuditEntry.before": rawJSON("before"),
+	"AuditEntry.after":  rawJSON("after"),
+
+	"Guest.email": maskedGuest(pii.GuestEmail),
+	"Guest.phone": maskedGuest(pii.GuestPhone),
+	"GuestDocument.number": func(p graphql.ResolveParams) (interface{}, error) {
+		doc, ok := sourceDocument(p.Source)
+		if !ok {
+			return nil, nil
+		}
+		return pii.Visible(callerRole(p), pii.DocumentNumber, doc.Number), nil
 	},
-})
+
+	// Relations are batched per request, see loader.go
+	"Room.guests": func(p graphql.ResolveParams) (interface{}, error) {
+		room, ok := sourceRoom(p.Source)
+		if !ok {
+			return nil, nil
+		}
+		return loadersFrom(p.Context).guestsInRoom(listFilter(p)).load(p.Context, room.ID), nil
+	},
+	"Guest.room": func(p graphql.ResolveParams) (interface{}, error) {
+		guest, ok := sourceGuest(p.Source)
+		if !ok {
+			return nil, nil
+		}
+		return loadersFrom(p.Context).rooms.load(p.Context, guest.RoomID), nil
+	},
+	"Guest.payments": func(p graphql.ResolveParams) (interface{}, error) {
+		guest, ok := sourceGuest(p.Source)
+		if !ok {
+			return nil, nil
+		}
+		return loadersFrom(p.Context).paymentsOfGuest(listFilter(p)).load(p.Context, guest.ID), nil
+	},
+	"Guest.documents": func(p graphql.ResolveParams) (interface{}, error) {
+		guest, ok := sourceGuest(p.Source)
+		if !ok {
+			return nil, nil
+		}
+		return loadersFrom(p.Context).documents.load(p.Context, guest.ID), nil
+	},
+	"GuestDocument.guest": func(p graphql.ResolveParams) (interface{}, error) {
+		doc, ok := sourceDocument(p.Source)
+		if !ok {
+			return nil, nil
+		}
+		return loadersFrom(p.Context).guests.load(p.Context, doc.GuestID), nil
+	},
+	"GuestDocument.download_url": func(p graphql.ResolveParams) (interface{}, error) {
+		doc, ok := sourceDocument(p.Source)
+		if !ok {
+			return nil, nil
+		}
+		return fmt.Sprintf("/api/documents/%d/file", doc.ID), nil
+	},
+	"Payment.guest": func(p graphql.ResolveParams) (interface{}, error) {
+		payment, ok := sourcePayment(p.Source)
+		if !ok {
+			return nil, nil
+		}
+		return loadersFrom(p.Context).guests.load(p.Context, payment.GuestID), nil
+	},
+
+	"Query.rooms": func(p graphql.ResolveParams) (interface{}, error) {
+		return database.GetAllRooms(p.Context, listFilter(p))
+	},
+	"Query.room": func(p graphql.ResolveParams) (interface{}, error) {
+		id, _ := p.Args["id"].(int)
+		return database.GetRoomByID(p.Context, id)
+	},
+	"Query.guests": func(p graphql.ResolveParams) (interface{}, error) {
+		return database.GetAllGuests(p.Context, listFilter(p))
+	},
+	"Query.guest": func(p graphql.ResolveParams) (interface{}, error) {
+		id, _ := p.Args["id"].(int)
+		return database.GetGuestByID(p.Context, id)
+	},
+	"Query.allPayments": func(p graphql.ResolveParams) (interface{}, error) {
+		return database.GetAllPayments(p.Context, listFilter(p))
+	},
+	"Query.payment": func(p graphql.ResolveParams) (interface{}, error) {
+		id, _ := p.Args["id"].(int)
+		return database.GetPaymentByID(p.Context, id)
+	},
+	"Query.document": func(p graphql.ResolveParams) (interface{}, error) {
+		id, _ := p.Args["id"].(int)
+		return database.GetGuestDocumentByID(p.Context, id)
+	},
+	"Query.documents": func(p graphql.ResolveParams) (interface{}, error) {
+		filter := database.DocumentFilter{}
+		filter.GuestID, _ = p.Args["guest_id"].(int)
+		filter.Type, _ = p.Args["type"].(string)
+		filter.Status, _ = p.Args["status"].(string)
+		filter.ExpiringBefore, _ = p.Args["expiring_before"].(time.Time)
+		filter.Limit, _ = p.Args["limit"].(int)
+		return database.GetGuestDocuments(p.Context, filter)
+	},
+	"Query.auditLog": func(p graphql.ResolveParams) (interface{}, error) {
+		filter := database.AuditFilter{}
+		filter.Entity, _ = p.Args["entity"].(string)
+		filter.EntityID, _ = p.Args["entity_id"].(int)
+		filter.Actor, _ = p.Args["actor"].(string)
+		filter.Limit, _ = p.Args["limit"].(int)
+		filter.From, _ = p.Args["from"].(time.Time)
+		filter.To, _ = p.Args["to"].(time.Time)
+		return database.GetAuditLog(p.Context, filter)
+	},
+	"Query.payments": func(p graphql.ResolveParams) (interface{}, error) {
+		guestID, _ := p.Args["guest_id"].(int)
+		return database.GetPaymentsByGuestID(p.Context, guestID)
+	},
+
+	// Room Mutations
+	"Mutation.createRoom": func(p graphql.ResolveParams) (interface{}, error) {
+		in := inputArg(p.Args)
+		room := models.Room{
+			RoomNumber: in.string("room_number"),
+			Capacity:   in.int("capacity"),
+			Price:      in.money("price"),
+		}
+		if err := validation.Room(&room); err != nil {
+			return payload("room", nil, err)
+		}
+		err := database.CreateRoom(p.Context, &room)
+		return payload("room", room, err)
+	},
+	"Mutation.updateRoom": func(p graphql.ResolveParams) (interface{}, error) {
+		in := inputArg(p.Args)
+		id := in.int("id")
+		room := models.Room{
+			RoomNumber: in.string("room_number"),
+			Capacity:   in.int("capacity"),
+			Price:      in.money("price"),
+			Version:    in.int("version"),
+		}
+		if err := validation.Room(&room); err != nil {
+			return payload("room", nil, err)
+		}
+		err := database.UpdateRoom(p.Context, id, &room)
+		room.ID = id
+		return payload("room", room, err)
+	},
+	"Mutation.deleteRoom": func(p graphql.ResolveParams) (interface{}, error) {
+		id := p.Args["id"].(int)
+		return deletePayload(database.DeleteRoom(p.Context, id))
+	},
+	"Mutation.restoreRoom": func(p graphql.ResolveParams) (interface{}, error) {
+		id := p.Args["id"].(int)
+		if err := database.RestoreRoom(p.Context, id); err != nil {
+			return payload("room", nil, err)
+		}
+		room, err := database.GetRoomByID(database.WithPrimary(p.Context), id)
+		return payload("room", room, err)
+	},
+
+	// Guest Mutations
+	"Mutation.createGuest": func(p graphql.ResolveParams) (interface{}, error) {
+		in := inputArg(p.Args)
+		guest := models.Guest{
+			Name:     in.string("name"),
+			Email:    in.string("email"),
+			Phone:    in.string("phone"),
+			RoomID:   in.int("room_id"),
+			JoinDate: in.time("join_date"),
+		}
+		if err := validation.Guest(p.Context, &guest); err != nil {
+			return payload("guest", nil, err)
+		}
+		err := database.CreateGuest(p.Context, &guest)
+		return payload("guest", guest, err)
+	},
+	"Mutation.updateGuest": func(p graphql.ResolveParams) (interface{}, error) {
+		in := inputArg(p.Args)
+		id := in.int("id")
+		guest := models.Guest{
+			Name:    in.string("name"),
+			Email:   in.string("email"),
+			Phone:   in.string("phone"),
+			RoomID:  in.int("room_id"),
+			Version: in.int("version"),
+		}
+		if err := validation.Guest(p.Context, &guest); err != nil {
+			return payload("guest", nil, err)
+		}
+		if err := database.UpdateGuest(p.Context, id, &guest); err != nil {
+			return payload("guest", nil, err)
+		}
+		// join_date is not part of the input, so read the stored guest back
+		updated, err := database.GetGuestByID(database.WithPrimary(p.Context), id)
+		return payload("guest", updated, err)
+	},
+	"Mutation.deleteGuest": func(p graphql.ResolveParams) (interface{}, error) {
+		id := p.Args["id"].(int)
+		return deletePayload(database.DeleteGuest(p.Context, id))
+	},
+	"Mutation.restoreGuest": func(p graphql.ResolveParams) (interface{}, error) {
+		id := p.Args["id"].(int)
+		if err := database.RestoreGuest(p.Context, id); err != nil {
+			return payload("guest", nil, err)
+		}
+		guest, err := database.GetGuestByID(database.WithPrimary(p.Context), id)
+		return payload("guest", guest, err)
+	},
+
+	// Payment Mutations
+	"Mutation.createPayment": func(p graphql.ResolveParams) (interface{}, error) {
+		in := inputArg(p.Args)
+		payment := models.Payment{
+			GuestID:       in.int("guest_id"),
+			Amount:        in.money("amount"),
+			PaymentMethod: in.string("payment_method"),
+			PaymentDate:   in.time("payment_date"),
+		}
+		if err := validation.Payment(p.Context, &payment); err != nil {
+			return payload("payment", nil, err)
+		}
+		err := database.CreatePayment(p.Context, &payment)
+		return payload("payment", payment, err)
+	},
+	"Mutation.updatePayment": func(p graphql.ResolveParams) (interface{}, error) {
+		in := inputArg(p.Args)
+		payment := models.Payment{
+			ID:            in.int("id"),
+			GuestID:       in.int("guest_id"),
+			Amount:        in.money("amount"),
+			PaymentMethod: in.string("payment_method"),
+			PaymentDate:   in.time("payment_date"),
+			Version:       in.int("version"),
+		}
+		if payment.PaymentDate.IsZero() {
+			current, err := database.GetPaymentByID(database.WithPrimary(p.Context), payment.ID)
+			if err != nil {
+				return payload("payment", nil, err)
+			}
+			payment.PaymentDate = current.PaymentDate
+		}
+		if err := validation.Payment(p.Context, &payment); err != nil {
+			return payload("payment", nil, err)
+		}
+		err := database.UpdatePayment(p.Context, &payment)
+		return payload("payment", payment, err)
+	},
+	"Mutation.deletePayment": func(p graphql.ResolveParams) (interface{}, error) {
+		id := p.Args["id"].(int)
+		return deletePayload(database.DeletePayment(p.Context, id))
+	},
+	"Mutation.restorePayment": func(p graphql.ResolveParams) (interface{}, error) {
+		id := p.Args["id"].(int)
+		if err := database.RestorePayment(p.Context, id); err != nil {
+			return payload("payment", nil, err)
+		}
+		payment, err := database.GetPaymentByID(database.WithPrimary(p.Context), id)
+		return payload("payment", payment, err)
+	},
+
+	// Document Mutations
+	"Mutation.uploadGuestDocument": func(p graphql.ResolveParams) (interface{}, error) {
+		in := inputArg(p.Args)
+		file, err := UploadFrom(p.Context, in["file"])
+		if err != nil {
+			return payload("document", nil, &validation.Error{Fields: []validation.FieldError{{Field: "file", Message: err.Error()}}})
+		}
+		content, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer content.Close()
+
+		doc := models.GuestDocument{
+			GuestID:  in.int("guest_id"),
+			Type:     in.string("type"),
+			Number:   in.string("number"),
+			Filename: file.Filename,
+		}
+		if expires := in.time("expires_at"); !expires.IsZero() {
+			doc.ExpiresAt = &expires
+		}
+		err = documents.Save(p.Context, &doc, content, file.Size)
+		return payload("document", doc, err)
+	},
+	"Mutation.reviewGuestDocument": func(p graphql.ResolveParams) (interface{}, error) {
+		in := inputArg(p.Args)
+		id := in.int("id")
+		review := models.DocumentReview{
+			Status:  in.string("status"),
+			Reason:  in.string("reason"),
+			Version: in.int("version"),
+		}
+		if err := validation.DocumentReview(&review); err != nil {
+			return payload("document", nil, err)
+		}
+		if err := database.ReviewGuestDocument(p.Context, id, &review); err != nil {
+			return payload("document", nil, err)
+		}
+		doc, err := database.GetGuestDocumentByID(database.WithPrimary(p.Context), id)
+		return payload("document", doc, err)
+	},
+	"Mutation.deleteGuestDocument": func(p graphql.ResolveParams) (interface{}, error) {
+		id := p.Args["id"].(int)
+		return deletePayload(documents.Delete(p.Context, id))
+	},
+
+	// Subscriptions, served by SubscriptionHandler
+	"Subscription.roomOccupancyChanged": subscribe(events.RoomOccupancyChanged, func(args map[string]interface{}, payload interface{}) bool {
+		room, ok := sourceRoom(payload)
+		return ok && argMatches(args, "room_id", room.ID)
+	}),
+	"Subscription.paymentReceived": subscribe(events.PaymentReceived, func(args map[string]interface{}, payload interface{}) bool {
+		payment, ok := sourcePayment(payload)
+		return ok && argMatches(args, "guest_id", payment.GuestID)
+	}),
+	"Subscription.guestCheckedIn": subscribe(events.GuestCheckedIn, func(args map[string]interface{}, payload interface{}) bool {
+		guest, ok := sourceGuest(payload)
+		return ok && argMatches(args, "room_id", guest.RoomID)
+	}),
+}
+
+// SDL is the schema source of truth; types and arguments come only from here
+//
+//go:embed schema.graphql
+var SDL string
 
 // Schema
 var Schema graphql.Schema
 
+// directives are the SDL field annotations, such as @cost
+var directives fieldDirectives
+
 func init() {
 	var err error
-	Schema, err = graphql.NewSchema(graphql.SchemaConfig{
-		Query:    rootQuery,
-		Mutation: rootMutation,
-	})
+	Schema, directives, err = buildSchema(SDL, resolvers, scalars)
+	if err == nil {
+		err = applyAuth(&Schema, directives)
+	}
 	if err != nil {
 		log.Fatalf("Failed to create GraphQL schema: %v", err)
 	}
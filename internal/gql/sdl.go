@@ -0,0 +1,371 @@
+package gql
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+// Resolvers binds resolve functions to SDL fields, keyed "Type.field"
+type Resolvers map[string]graphql.FieldResolveFn
+
+// fieldDirectives holds the directives on each SDL field, keyed "Type.field".
+// graphql-go does not execute them; the guard and authorization read them instead.
+type fieldDirectives map[string][]*ast.Directive
+
+// has reports whether the field carries the directive
+func (d fieldDirectives) has(field, directive string) bool {
+	for _, dir := range d[field] {
+		if dir.Name.Value == directive {
+			return true
+		}
+	}
+	return false
+}
+
+// argument returns the literal value of a directive argument, or nil
+func (d fieldDirectives) argument(field, directive, name string) interface{} {
+	for _, dir := range d[field] {
+		if dir.Name.Value != directive {
+			continue
+		}
+		for _, arg := range dir.Arguments {
+			if arg.Name.Value == name {
+				return astValue(arg.Value)
+			}
+		}
+	}
+	return nil
+}
+
+// buildSchema turns an SDL document into an executable schema. Resolvers must name
+// existing fields, and every Query, Mutation and Subscription field needs one;
+// other fields fall back to the default resolver, which reads struct json tags.
+// Custom scalars declared in the SDL are taken from scalars.
+func buildSchema(sdl string, resolvers Resolvers, scalars map[string]*graphql.Scalar) (graphql.Schema, fieldDirectives, error) {
+	doc, err := parser.Parse(parser.ParseParams{Source: sdl})
+	if err != nil {
+		return graphql.Schema{}, nil, err
+	}
+
+	b := &schemaBuilder{
+		defs:       map[string]ast.Node{},
+		types:      map[string]graphql.Type{},
+		resolvers:  resolvers,
+		bound:      map[string]bool{},
+		scalars:    scalars,
+		directives: fieldDirectives{},
+	}
+	roots := map[string]string{"query": "Query", "mutation": "Mutation", "subscription": "Subscription"}
+
+	for _, def := range doc.Definitions {
+		switch d := def.(type) {
+		case *ast.SchemaDefinition:
+			for _, op := range d.OperationTypes {
+				roots[op.Operation] = op.Type.Name.Value
+			}
+		case *ast.ObjectDefinition:
+			b.defs[d.Name.Value] = d
+		case *ast.InputObjectDefinition:
+			b.defs[d.Name.Value] = d
+		case *ast.EnumDefinition:
+			b.defs[d.Name.Value] = d
+		case *ast.ScalarDefinition:
+			b.defs[d.Name.Value] = d
+		case *ast.DirectiveDefinition:
+			// Directives annotate fields for our own use; graphql-go does not execute them
+		default:
+			return graphql.Schema{}, nil, fmt.Errorf("unsupported SDL definition %s", def.GetKind())
+		}
+	}
+
+	b.subscription = roots["subscription"]
+	config := graphql.SchemaConfig{}
+	for op, name := range roots {
+		if b.defs[name] == nil {
+			if op == "query" {
+				return graphql.Schema{}, nil, fmt.Errorf("schema has no %s type", name)
+			}
+			continue
+		}
+		t, err := b.typeNamed(name)
+		if err != nil {
+			return graphql.Schema{}, nil, err
+		}
+		obj, ok := t.(*graphql.Object)
+		if !ok {
+			return graphql.Schema{}, nil, fmt.Errorf("%s root %s must be an object type", op, name)
+		}
+		b.roots = append(b.roots, name)
+		switch op {
+		case "query":
+			config.Query = obj
+		case "mutation":
+			config.Mutation = obj
+		case "subscription":
+			config.Subscription = obj
+		}
+	}
+
+	// Build every remaining type so errors in unused types are not hidden
+	for name := range b.defs {
+		if _, err := b.typeNamed(name); err != nil {
+			return graphql.Schema{}, nil, err
+		}
+	}
+	for _, t := range b.types {
+		switch t := t.(type) {
+		case *graphql.Object:
+			t.Fields()
+			if err := t.Error(); err != nil {
+				return graphql.Schema{}, nil, err
+			}
+		case *graphql.InputObject:
+			t.Fields()
+			if err := t.Error(); err != nil {
+				return graphql.Schema{}, nil, err
+			}
+		}
+		config.Types = append(config.Types, t)
+	}
+	if b.err != nil {
+		return graphql.Schema{}, nil, b.err
+	}
+	if err := b.checkBindings(); err != nil {
+		return graphql.Schema{}, nil, err
+	}
+
+	schema, err := graphql.NewSchema(config)
+	return schema, b.directives, err
+}
+
+type schemaBuilder struct {
+	defs       map[string]ast.Node
+	types      map[string]graphql.Type
+	resolvers  Resolvers
+	bound      map[string]bool
+	scalars    map[string]*graphql.Scalar
+	roots      []string
+	directives fieldDirectives
+	// subscription names the subscription root, whose resolvers return event channels
+	subscription string
+	// err collects failures inside field thunks, which cannot return errors
+	err error
+}
+
+func (b *schemaBuilder) typeNamed(name string) (graphql.Type, error) {
+	switch name {
+	case "Int":
+		return graphql.Int, nil
+	case "Float":
+		return graphql.Float, nil
+	case "String":
+		return graphql.String, nil
+	case "Boolean":
+		return graphql.Boolean, nil
+	case "ID":
+		return graphql.ID, nil
+	}
+	if t, ok := b.types[name]; ok {
+		return t, nil
+	}
+
+	switch d := b.defs[name].(type) {
+	case *ast.ObjectDefinition:
+		obj := graphql.NewObject(graphql.ObjectConfig{
+			Name:        name,
+			Description: description(d.Description),
+			Fields:      graphql.FieldsThunk(func() graphql.Fields { return b.objectFields(d) }),
+		})
+		b.types[name] = obj
+		return obj, nil
+	case *ast.InputObjectDefinition:
+		input := graphql.NewInputObject(graphql.InputObjectConfig{
+			Name:        name,
+			Description: description(d.Description),
+			Fields:      graphql.InputObjectConfigFieldMapThunk(func() graphql.InputObjectConfigFieldMap { return b.inputFields(d) }),
+		})
+		b.types[name] = input
+		return input, nil
+	case *ast.EnumDefinition:
+		values := graphql.EnumValueConfigMap{}
+		for _, v := range d.Values {
+			values[v.Name.Value] = &graphql.EnumValueConfig{Value: v.Name.Value, Description: description(v.Description)}
+		}
+		enum := graphql.NewEnum(graphql.EnumConfig{Name: name, Description: description(d.Description), Values: values})
+		b.types[name] = enum
+		return enum, nil
+	case *ast.ScalarDefinition:
+		scalar, ok := b.scalars[name]
+		if !ok {
+			return nil, fmt.Errorf("scalar %s has no Go implementation", name)
+		}
+		b.types[name] = scalar
+		return scalar, nil
+	}
+	return nil, fmt.Errorf("unknown type %s", name)
+}
+
+func (b *schemaBuilder) typeRef(t ast.Type) (graphql.Type, error) {
+	switch t := t.(type) {
+	case *ast.NonNull:
+		inner, err := b.typeRef(t.Type)
+		if err != nil {
+			return nil, err
+		}
+		return graphql.NewNonNull(inner), nil
+	case *ast.List:
+		inner, err := b.typeRef(t.Type)
+		if err != nil {
+			return nil, err
+		}
+		return graphql.NewList(inner), nil
+	case *ast.Named:
+		return b.typeNamed(t.Name.Value)
+	}
+	return nil, fmt.Errorf("unsupported type reference %v", t)
+}
+
+func (b *schemaBuilder) fail(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+func (b *schemaBuilder) objectFields(d *ast.ObjectDefinition) graphql.Fields {
+	fields := graphql.Fields{}
+	for _, f := range d.Fields {
+		t, err := b.typeRef(f.Type)
+		if err != nil {
+			b.fail(fmt.Errorf("%s.%s: %w", d.Name.Value, f.Name.Value, err))
+			continue
+		}
+		args, err := b.arguments(f.Arguments)
+		if err != nil {
+			b.fail(fmt.Errorf("%s.%s: %w", d.Name.Value, f.Name.Value, err))
+			continue
+		}
+		key := d.Name.Value + "." + f.Name.Value
+		b.bound[key] = true
+		if len(f.Directives) > 0 {
+			b.directives[key] = f.Directives
+		}
+		field := &graphql.Field{
+			Type:        t,
+			Args:        args,
+			Description: description(f.Description),
+			Resolve:     b.resolvers[key],
+		}
+		if d.Name.Value == b.subscription {
+			// The resolver subscribes; each event it sends is then the field's value
+			field.Subscribe, field.Resolve = field.Resolve, eventPayload
+		}
+		fields[f.Name.Value] = field
+	}
+	return fields
+}
+
+func eventPayload(p graphql.ResolveParams) (interface{}, error) {
+	return p.Source, nil
+}
+
+func (b *schemaBuilder) arguments(defs []*ast.InputValueDefinition) (graphql.FieldConfigArgument, error) {
+	args := graphql.FieldConfigArgument{}
+	for _, a := range defs {
+		t, err := b.typeRef(a.Type)
+		if err != nil {
+			return nil, err
+		}
+		args[a.Name.Value] = &graphql.ArgumentConfig{
+			Type:         t,
+			Description:  description(a.Description),
+			DefaultValue: astValue(a.DefaultValue),
+		}
+	}
+	return args, nil
+}
+
+func (b *schemaBuilder) inputFields(d *ast.InputObjectDefinition) graphql.InputObjectConfigFieldMap {
+	fields := graphql.InputObjectConfigFieldMap{}
+	for _, f := range d.Fields {
+		t, err := b.typeRef(f.Type)
+		if err != nil {
+			b.fail(fmt.Errorf("%s.%s: %w", d.Name.Value, f.Name.Value, err))
+			continue
+		}
+		fields[f.Name.Value] = &graphql.InputObjectFieldConfig{
+			Type:         t,
+			Description:  description(f.Description),
+			DefaultValue: astValue(f.DefaultValue),
+		}
+	}
+	return fields
+}
+
+// checkBindings reports resolvers for fields missing from the SDL and root fields without resolvers
+func (b *schemaBuilder) checkBindings() error {
+	var problems []string
+	for key := range b.resolvers {
+		if !b.bound[key] {
+			problems = append(problems, "resolver "+key+" has no field in the SDL")
+		}
+	}
+	for _, root := range b.roots {
+		for _, f := range b.defs[root].(*ast.ObjectDefinition).Fields {
+			key := root + "." + f.Name.Value
+			if b.resolvers[key] == nil {
+				problems = append(problems, "field "+key+" has no resolver")
+			}
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return fmt.Errorf("schema and resolvers diverge:\n  %s", strings.Join(problems, "\n  "))
+}
+
+func description(s *ast.StringValue) string {
+	if s == nil {
+		return ""
+	}
+	return s.Value
+}
+
+// astValue converts a literal default value from the SDL
+func astValue(v ast.Value) interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case *ast.IntValue:
+		n, _ := strconv.Atoi(v.Value)
+		return n
+	case *ast.FloatValue:
+		f, _ := strconv.ParseFloat(v.Value, 64)
+		return f
+	case *ast.StringValue:
+		return v.Value
+	case *ast.BooleanValue:
+		return v.Value
+	case *ast.EnumValue:
+		return v.Value
+	case *ast.ListValue:
+		list := make([]interface{}, len(v.Values))
+		for i, item := range v.Values {
+			list[i] = astValue(item)
+		}
+		return list
+	case *ast.ObjectValue:
+		obj := map[string]interface{}{}
+		for _, f := range v.Fields {
+			obj[f.Name.Value] = astValue(f.Value)
+		}
+		return obj
+	}
+	return nil
+}
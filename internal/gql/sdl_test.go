@@ -0,0 +1,242 @@
+package gql
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+func TestSDLBindsEveryResolver(t *testing.T) {
+	if _, _, err := buildSchema(SDL, resolvers, scalars); err != nil {
+		t.Fatalf("embedded SDL: %v", err)
+	}
+
+	// Resolvers that drift from the SDL must fail the build, not be ignored
+	drifted := Resolvers{}
+	for key, fn := range resolvers {
+		drifted[key] = fn
+	}
+	delete(drifted, "Query.rooms")
+	drifted["Query.roomz"] = resolvers["Query.room"]
+	_, _, err := buildSchema(SDL, drifted, scalars)
+	if err == nil {
+		t.Fatal("want an error for drifted resolvers")
+	}
+	for _, want := range []string{"field Query.rooms has no resolver", "resolver Query.roomz has no field in the SDL"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
+
+const introspectionQuery = `{
+  __schema {
+    queryType { name }
+    mutationType { name }
+    subscriptionType { name }
+    types {
+      name kind description
+      fields { name description type { ...Ref } args { name description type { ...Ref } } }
+      inputFields { name description type { ...Ref } }
+      enumValues { name }
+    }
+  }
+}
+fragment Ref on __Type { kind name ofType { kind name ofType { kind name ofType { kind name } } } }`
+
+type introspectedRef struct {
+	Kind   string           `json:"kind"`
+	Name   string           `json:"name"`
+	OfType *introspectedRef `json:"ofType"`
+}
+
+func (r *introspectedRef) String() string {
+	switch r.Kind {
+	case "NON_NULL":
+		return r.OfType.String() + "!"
+	case "LIST":
+		return "[" + r.OfType.String() + "]"
+	}
+	return r.Name
+}
+
+type introspectedValue struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Type        *introspectedRef `json:"type"`
+}
+
+type introspectedField struct {
+	introspectedValue
+	Args []introspectedValue `json:"args"`
+}
+
+type introspectedType struct {
+	Name        string              `json:"name"`
+	Kind        string              `json:"kind"`
+	Description string              `json:"description"`
+	Fields      []introspectedField `json:"fields"`
+	InputFields []introspectedValue `json:"inputFields"`
+	EnumValues  []struct {
+		Name string `json:"name"`
+	} `json:"enumValues"`
+}
+
+func sdlTypeString(t ast.Type) string {
+	switch t := t.(type) {
+	case *ast.NonNull:
+		return sdlTypeString(t.Type) + "!"
+	case *ast.List:
+		return "[" + sdlTypeString(t.Type) + "]"
+	case *ast.Named:
+		return t.Name.Value
+	}
+	return ""
+}
+
+// TestIntrospectionMatchesSDL checks that clients see exactly the schema written
+// in schema.graphql: the same types, fields, arguments, types and descriptions
+func TestIntrospectionMatchesSDL(t *testing.T) {
+	result := graphql.Do(graphql.Params{Schema: Schema, RequestString: introspectionQuery})
+	if len(result.Errors) > 0 {
+		t.Fatal(result.Errors)
+	}
+	var got struct {
+		Schema struct {
+			QueryType, MutationType, SubscriptionType struct{ Name string }
+			Types                                     []introspectedType
+		} `json:"__schema"`
+	}
+	decodeResult(t, result.Data, &got)
+
+	if got.Schema.QueryType.Name != "Query" || got.Schema.MutationType.Name != "Mutation" || got.Schema.SubscriptionType.Name != "Subscription" {
+		t.Errorf("roots are %s, %s, %s", got.Schema.QueryType.Name, got.Schema.MutationType.Name, got.Schema.SubscriptionType.Name)
+	}
+	served := map[string]introspectedType{}
+	for _, typ := range got.Schema.Types {
+		if !strings.HasPrefix(typ.Name, "__") {
+			served[typ.Name] = typ
+		}
+	}
+
+	doc, err := parser.Parse(parser.ParseParams{Source: SDL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, def := range doc.Definitions {
+		switch d := def.(type) {
+		case *ast.ObjectDefinition:
+			typ := servedType(t, served, d.Name.Value, "OBJECT")
+			compareDescription(t, d.Name.Value, description(d.Description), typ.Description)
+			fields := map[string]introspectedField{}
+			for _, f := range typ.Fields {
+				fields[f.Name] = f
+			}
+			if len(fields) != len(d.Fields) {
+				t.Errorf("%s has %d fields, the SDL %d", d.Name.Value, len(fields), len(d.Fields))
+			}
+			for _, f := range d.Fields {
+				key := d.Name.Value + "." + f.Name.Value
+				field, ok := fields[f.Name.Value]
+				if !ok {
+					t.Errorf("%s is not served", key)
+					continue
+				}
+				compareValue(t, key, sdlTypeString(f.Type), description(f.Description), field.introspectedValue)
+				args := map[string]introspectedValue{}
+				for _, a := range field.Args {
+					args[a.Name] = a
+				}
+				if len(args) != len(f.Arguments) {
+					t.Errorf("%s has %d arguments, the SDL %d", key, len(args), len(f.Arguments))
+				}
+				for _, a := range f.Arguments {
+					arg, ok := args[a.Name.Value]
+					if !ok {
+						t.Errorf("%s(%s) is not served", key, a.Name.Value)
+						continue
+					}
+					compareValue(t, key+"("+a.Name.Value+")", sdlTypeString(a.Type), description(a.Description), arg)
+				}
+			}
+		case *ast.InputObjectDefinition:
+			typ := servedType(t, served, d.Name.Value, "INPUT_OBJECT")
+			fields := map[string]introspectedValue{}
+			for _, f := range typ.InputFields {
+				fields[f.Name] = f
+			}
+			if len(fields) != len(d.Fields) {
+				t.Errorf("%s has %d fields, the SDL %d", d.Name.Value, len(fields), len(d.Fields))
+			}
+			for _, f := range d.Fields {
+				key := d.Name.Value + "." + f.Name.Value
+				field, ok := fields[f.Name.Value]
+				if !ok {
+					t.Errorf("%s is not served", key)
+					continue
+				}
+				compareValue(t, key, sdlTypeString(f.Type), description(f.Description), field)
+			}
+		case *ast.EnumDefinition:
+			typ := servedType(t, served, d.Name.Value, "ENUM")
+			if len(typ.EnumValues) != len(d.Values) {
+				t.Errorf("%s has %d values, the SDL %d", d.Name.Value, len(typ.EnumValues), len(d.Values))
+			}
+		case *ast.ScalarDefinition:
+			servedType(t, served, d.Name.Value, "SCALAR")
+		}
+	}
+
+	for name := range served {
+		switch name {
+		case "String", "Int", "Float", "Boolean", "ID":
+			continue
+		}
+		t.Errorf("type %s is served but not in the SDL", name)
+	}
+}
+
+// servedType takes name out of served so leftovers can be reported
+func servedType(t *testing.T, served map[string]introspectedType, name, kind string) introspectedType {
+	t.Helper()
+	typ, ok := served[name]
+	if !ok {
+		t.Errorf("type %s is not served", name)
+		return typ
+	}
+	delete(served, name)
+	if typ.Kind != kind {
+		t.Errorf("type %s is served as %s, not %s", name, typ.Kind, kind)
+	}
+	return typ
+}
+
+func compareValue(t *testing.T, key, typ, desc string, got introspectedValue) {
+	t.Helper()
+	if got.Type.String() != typ {
+		t.Errorf("%s is served as %s, the SDL says %s", key, got.Type, typ)
+	}
+	compareDescription(t, key, desc, got.Description)
+}
+
+func compareDescription(t *testing.T, key, want, got string) {
+	t.Helper()
+	if got != want {
+		t.Errorf("%s description is %q, the SDL says %q", key, got, want)
+	}
+}
+
+func decodeResult(t *testing.T, data interface{}, v interface{}) {
+	t.Helper()
+	body, err := json.Marshal(data)
+	if err == nil {
+		err = json.Unmarshal(body, v)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
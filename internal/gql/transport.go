@@ -0,0 +1,253 @@
+package gql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// Batch runs a JSON array of operations one after another through next and
+// answers with the array of their results, in order. Each operation is checked
+// and charged on its own. Other requests are passed through unchanged.
+func Batch(limits Limits, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBody))
+		if err != nil {
+			graphqlError(w, http.StatusRequestEntityTooLarge, "REQUEST_TOO_LARGE", "request body is too large")
+			return
+		}
+		if trimmed := bytes.TrimSpace(body); len(trimmed) == 0 || trimmed[0] != '[' {
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var ops []json.RawMessage
+		if err := json.Unmarshal(body, &ops); err != nil || len(ops) == 0 {
+			graphqlError(w, http.StatusBadRequest, "BAD_REQUEST", "a batch must be a non-empty JSON array of operations")
+			return
+		}
+		if len(ops) > limits.MaxBatch {
+			graphqlError(w, http.StatusBadRequest, "BATCH_TOO_LARGE",
+				fmt.Sprintf("a batch may hold at most %d operations", limits.MaxBatch))
+			return
+		}
+
+		results := make([]json.RawMessage, len(ops))
+		for i, op := range ops {
+			sub := r.Clone(r.Context())
+			sub.Body = io.NopCloser(bytes.NewReader(op))
+			sub.ContentLength = int64(len(op))
+
+			rec := &bufferedResponse{header: http.Header{}}
+			next.ServeHTTP(rec, sub)
+			results[i] = bytes.TrimSpace(rec.body.Bytes())
+			if !json.Valid(results[i]) {
+				results[i] = json.RawMessage(`{"errors":[{"message":"operation failed"}]}`)
+			}
+			if retry := rec.header.Get("Retry-After"); retry != "" {
+				w.Header().Set("Retry-After", retry)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(results)
+	})
+}
+
+// bufferedResponse captures one operation's response inside a batch
+type bufferedResponse struct {
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header         { return b.header }
+func (b *bufferedResponse) Write(p []byte) (int, error) { return b.body.Write(p) }
+func (b *bufferedResponse) WriteHeader(int)             {}
+
+// Upload is a file sent with the GraphQL multipart request spec,
+// https://github.com/jaydenseric/graphql-multipart-request-spec
+type Upload struct {
+	Filename    string
+	ContentType string
+	Size        int64
+
+	header *multipart.FileHeader
+}
+
+// Open returns the file's content
+func (u *Upload) Open() (multipart.File, error) {
+	return u.header.Open()
+}
+
+type uploadsKey struct{}
+
+// uploadKey is how an Upload variable reaches a resolver: the name of its
+// multipart part, resolved against the request's files by UploadFrom
+type uploadKey string
+
+// UploadFrom returns the file given for an Upload argument
+func UploadFrom(ctx context.Context, arg interface{}) (*Upload, error) {
+	key, ok := arg.(uploadKey)
+	if !ok {
+		return nil, errors.New("no file was uploaded; send it as a multipart request")
+	}
+	uploads, _ := ctx.Value(uploadsKey{}).(map[string]*Upload)
+	upload, ok := uploads[string(key)]
+	if !ok {
+		return nil, fmt.Errorf("no file was uploaded as part %q", key)
+	}
+	return upload, nil
+}
+
+// upload is the Upload scalar. Files only arrive through variables, which the
+// multipart handler sets to the file's part name.
+var upload = graphql.NewScalar(graphql.ScalarConfig{
+	Name: "Upload",
+	Serialize: func(value interface{}) interface{} {
+		return nil
+	},
+	ParseValue: func(value interface{}) interface{} {
+		if s, ok := value.(string); ok {
+			return uploadKey(s)
+		}
+		return nil
+	},
+	ParseLiteral: func(value ast.Value) interface{} {
+		return nil
+	},
+})
+
+// Uploads turns multipart requests following the GraphQL multipart request spec
+// into ordinary JSON requests for next, keeping the files for UploadFrom. Other
+// requests are passed through unchanged.
+func Uploads(limits Limits, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if r.Method != http.MethodPost || mediaType != "multipart/form-data" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if limits.MaxUploads <= 0 {
+			graphqlError(w, http.StatusBadRequest, "UPLOADS_DISABLED", "file uploads are disabled")
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, limits.MaxUploadSize+maxRequestBody)
+		if err := r.ParseMultipartForm(8 << 20); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				graphqlError(w, http.StatusRequestEntityTooLarge, "REQUEST_TOO_LARGE",
+					fmt.Sprintf("uploads may total at most %d MB", limits.MaxUploadSize>>20))
+				return
+			}
+			graphqlError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid multipart request")
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+
+		body, uploads, err := readMultipartOperations(r.MultipartForm, limits.MaxUploads)
+		if err != nil {
+			graphqlError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), uploadsKey{}, uploads)
+		sub := r.Clone(ctx)
+		sub.Header.Set("Content-Type", "application/json")
+		sub.Body = io.NopCloser(bytes.NewReader(body))
+		sub.ContentLength = int64(len(body))
+		sub.MultipartForm = nil
+		next.ServeHTTP(w, sub)
+	})
+}
+
+// readMultipartOperations rewrites the operations field, placing each file's part
+// name at the variable paths listed for it in the map field
+func readMultipartOperations(form *multipart.Form, maxUploads int) ([]byte, map[string]*Upload, error) {
+	if len(form.Value["operations"]) != 1 || len(form.Value["map"]) != 1 {
+		return nil, nil, errors.New("a multipart request needs one operations and one map field")
+	}
+
+	dec := json.NewDecoder(strings.NewReader(form.Value["operations"][0]))
+	dec.UseNumber()
+	var operations interface{}
+	if err := dec.Decode(&operations); err != nil {
+		return nil, nil, errors.New("operations is not valid JSON")
+	}
+	var fileMap map[string][]string
+	if err := json.Unmarshal([]byte(form.Value["map"][0]), &fileMap); err != nil {
+		return nil, nil, errors.New("map must be a JSON object of file keys to variable paths")
+	}
+	if len(fileMap) > maxUploads {
+		return nil, nil, fmt.Errorf("at most %d files may be uploaded at once", maxUploads)
+	}
+
+	uploads := make(map[string]*Upload, len(fileMap))
+	for key, paths := range fileMap {
+		files := form.File[key]
+		if len(files) != 1 {
+			return nil, nil, fmt.Errorf("map names file %q, which was not sent", key)
+		}
+		fh := files[0]
+		uploads[key] = &Upload{
+			Filename:    fh.Filename,
+			ContentType: fh.Header.Get("Content-Type"),
+			Size:        fh.Size,
+			header:      fh,
+		}
+		for _, path := range paths {
+			if err := setPath(operations, strings.Split(path, "."), key); err != nil {
+				return nil, nil, fmt.Errorf("map path %q: %w", path, err)
+			}
+		}
+	}
+
+	body, err := json.Marshal(operations)
+	return body, uploads, err
+}
+
+// setPath replaces the value at an object path such as variables.files.0
+func setPath(node interface{}, path []string, value interface{}) error {
+	for i, segment := range path {
+		last := i == len(path)-1
+		switch n := node.(type) {
+		case map[string]interface{}:
+			if _, ok := n[segment]; !ok {
+				return fmt.Errorf("%s does not exist", segment)
+			}
+			if last {
+				n[segment] = value
+				return nil
+			}
+			node = n[segment]
+		case []interface{}:
+			idx, err := strconv.Atoi(segment)
+			if err != nil || idx < 0 || idx >= len(n) {
+				return fmt.Errorf("%s is not an index of the list", segment)
+			}
+			if last {
+				n[idx] = value
+				return nil
+			}
+			node = n[idx]
+		default:
+			return fmt.Errorf("%s is inside a value that is not an object or list", segment)
+		}
+	}
+	return errors.New("empty path")
+}
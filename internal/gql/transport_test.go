@@ -0,0 +1,202 @@
+package gql
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBatch(t *testing.T) {
+	// next answers each operation with its own query so the order can be checked
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var op struct{ Query string }
+		json.NewDecoder(r.Body).Decode(&op)
+		json.NewEncoder(w).Encode(map[string]string{"data": op.Query})
+	})
+	h := Batch(Limits{MaxBatch: 2}, echo)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		want   string
+	}{
+		{"single operation", `{"query":"a"}`, http.StatusOK, `{"data":"a"}`},
+		{"batch of two", `[{"query":"a"}, {"query":"b"}]`, http.StatusOK, `[{"data":"a"},{"data":"b"}]`},
+		{"batch over the limit", `[{"query":"a"}, {"query":"b"}, {"query":"c"}]`, http.StatusBadRequest, "BATCH_TOO_LARGE"},
+		{"empty batch", `[]`, http.StatusBadRequest, "BAD_REQUEST"},
+		{"malformed batch", `[{"query":"a"},`, http.StatusBadRequest, "BAD_REQUEST"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/graphql", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.status != http.StatusOK {
+				if code := rejectionCode(t, w); code != tt.want {
+					t.Errorf("code %s, want %s", code, tt.want)
+				}
+				return
+			}
+			if got := strings.TrimSpace(w.Body.String()); got != tt.want {
+				t.Errorf("body %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatchDisabled(t *testing.T) {
+	h := Batch(Limits{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("batch was passed on")
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/api/graphql", strings.NewReader(`[{"query":"a"}]`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest || rejectionCode(t, w) != "BATCH_TOO_LARGE" {
+		t.Errorf("status %d: %s", w.Code, w.Body)
+	}
+}
+
+// multipartRequest builds a request following the GraphQL multipart request spec;
+// files maps each part name to its content
+func multipartRequest(t *testing.T, operations, fileMap string, files map[string]string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("operations", operations)
+	mw.WriteField("map", fileMap)
+	for name, content := range files {
+		fw, err := mw.CreateFormFile(name, name+".pdf")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(content))
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/graphql", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestUploads(t *testing.T) {
+	limits := Limits{MaxUploads: 2, MaxUploadSize: 1 << 20}
+
+	t.Run("single file", func(t *testing.T) {
+		var got struct {
+			Variables struct{ File string }
+		}
+		var content string
+		h := Uploads(limits, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+				t.Errorf("next got Content-Type %q", ct)
+			}
+			json.NewDecoder(r.Body).Decode(&got)
+			u, err := UploadFrom(r.Context(), uploadKey(got.Variables.File))
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, _ := u.Open()
+			defer f.Close()
+			b, _ := io.ReadAll(f)
+			content = string(b)
+		}))
+		req := multipartRequest(t, `{"query":"mutation ($file: Upload!) { x }","variables":{"file":null}}`,
+			`{"0":["variables.file"]}`, map[string]string{"0": "%PDF"})
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+		if got.Variables.File != "0" || content != "%PDF" {
+			t.Errorf("variable %q held %q", got.Variables.File, content)
+		}
+	})
+
+	t.Run("files into a list variable", func(t *testing.T) {
+		var got struct {
+			Variables struct{ Files []string }
+		}
+		h := Uploads(limits, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&got)
+			for _, key := range got.Variables.Files {
+				if _, err := UploadFrom(r.Context(), uploadKey(key)); err != nil {
+					t.Error(err)
+				}
+			}
+		}))
+		req := multipartRequest(t, `{"query":"q","variables":{"files":[null,null]}}`,
+			`{"a":["variables.files.0"],"b":["variables.files.1"]}`, map[string]string{"a": "1", "b": "2"})
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+		if len(got.Variables.Files) != 2 || got.Variables.Files[0] != "a" || got.Variables.Files[1] != "b" {
+			t.Errorf("files = %q, want [a b]", got.Variables.Files)
+		}
+	})
+
+	rejected := []struct {
+		name       string
+		operations string
+		fileMap    string
+		files      map[string]string
+		status     int
+		message    string
+	}{
+		{"malformed map", `{"query":"q","variables":{"file":null}}`, `["variables.file"]`,
+			map[string]string{"0": "x"}, http.StatusBadRequest, "map must be a JSON object"},
+		{"map names a missing file", `{"query":"q","variables":{"file":null}}`, `{"1":["variables.file"]}`,
+			map[string]string{"0": "x"}, http.StatusBadRequest, "not sent"},
+		{"path outside the variables", `{"query":"q","variables":{"file":null}}`, `{"0":["variables.other"]}`,
+			map[string]string{"0": "x"}, http.StatusBadRequest, "does not exist"},
+		{"index past the list", `{"query":"q","variables":{"files":[null]}}`, `{"0":["variables.files.1"]}`,
+			map[string]string{"0": "x"}, http.StatusBadRequest, "not an index"},
+		{"malformed operations", `{"query":`, `{"0":["variables.file"]}`,
+			map[string]string{"0": "x"}, http.StatusBadRequest, "operations is not valid JSON"},
+		{"too many files", `{"query":"q","variables":{"f":[null,null,null]}}`,
+			`{"a":["variables.f.0"],"b":["variables.f.1"],"c":["variables.f.2"]}`,
+			map[string]string{"a": "1", "b": "2", "c": "3"}, http.StatusBadRequest, "at most 2 files"},
+		{"oversized part", `{"query":"q","variables":{"file":null}}`, `{"0":["variables.file"]}`,
+			map[string]string{"0": strings.Repeat("x", 3<<20)}, http.StatusRequestEntityTooLarge, "at most 1 MB"},
+	}
+	for _, tt := range rejected {
+		t.Run(tt.name, func(t *testing.T) {
+			h := Uploads(limits, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				t.Error("rejected request was passed on")
+			}))
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, multipartRequest(t, tt.operations, tt.fileMap, tt.files))
+
+			if w.Code != tt.status || !strings.Contains(w.Body.String(), tt.message) {
+				t.Errorf("status %d, want %d mentioning %q: %s", w.Code, tt.status, tt.message, w.Body)
+			}
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		h := Uploads(Limits{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("upload was passed on")
+		}))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, multipartRequest(t, `{"query":"q","variables":{"file":null}}`, `{"0":["variables.file"]}`, map[string]string{"0": "x"}))
+		if w.Code != http.StatusBadRequest || rejectionCode(t, w) != "UPLOADS_DISABLED" {
+			t.Errorf("status %d: %s", w.Code, w.Body)
+		}
+	})
+}
@@ -0,0 +1,392 @@
+package gql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"pg-management-system/internal/database"
+	"pg-management-system/internal/handlers"
+	"pg-management-system/internal/middleware"
+
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+// wsProtocol is the graphql-ws subprotocol, see
+// https://github.com/enisdenjo/graphql-ws/blob/master/PROTOCOL.md
+const wsProtocol = "graphql-transport-ws"
+
+// Message types of the graphql-ws protocol
+const (
+	msgConnectionInit = "connection_init"
+	msgConnectionAck  = "connection_ack"
+	msgPing           = "ping"
+	msgPong           = "pong"
+	msgSubscribe      = "subscribe"
+	msgNext           = "next"
+	msgError          = "error"
+	msgComplete       = "complete"
+)
+
+// Close codes of the graphql-ws protocol
+const (
+	closeBadRequest       = 4400
+	closeUnauthorized     = 4401
+	closeForbidden        = 4403
+	closeBadProtocol      = 4406
+	closeInitTimeout      = 4408
+	closeDuplicateID      = 4409
+	closeTooManyInits     = 4429
+	connectionInitTimeout = 10 * time.Second
+	wsWriteTimeout        = 10 * time.Second
+)
+
+// maxConnectionOps bounds the operations one connection may run at once
+const maxConnectionOps = 20
+
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+type wsSubscribePayload struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+	Extensions    requestExtensions      `json:"extensions"`
+}
+
+var upgrader = websocket.Upgrader{
+	Subprotocols: []string{wsProtocol},
+	// Browsers send cookies but not the Authorization header on the handshake, and
+	// this API only accepts the JWT from connection_init, so any origin is safe
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// SubscriptionHandler serves the schema over WebSocket with the graphql-ws
+// protocol. Clients authenticate with the same JWT as the HTTP API, sent as
+// {"Authorization": "Bearer <token>"} in the connection_init payload or, for
+// clients that can set it, in the handshake's Authorization header. Queries and
+// mutations are accepted too and complete after one result. Persisted queries and
+// the allowlist apply as they do over HTTP.
+func SubscriptionHandler(limits Limits, store *QueryStore) http.Handler {
+	if limits.ListSize <= 0 {
+		limits.ListSize = DefaultListSize
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// Upgrade has already replied with an HTTP error
+			return
+		}
+		conn.SetReadLimit(maxRequestBody)
+		c := &wsConn{conn: conn, r: r, limits: limits, budgets: budgetsFor(limits.CostBudget), store: store, ops: map[string]context.CancelFunc{}}
+		c.serve()
+	})
+}
+
+type wsConn struct {
+	conn    *websocket.Conn
+	r       *http.Request
+	limits  Limits
+	budgets *costBudgets
+	store   *QueryStore
+
+	writeMu sync.Mutex
+
+	// ctx carries the user's claims once connection_init has been accepted
+	ctx    context.Context
+	claims *handlers.Claims
+
+	opsMu sync.Mutex
+	ops   map[string]context.CancelFunc
+}
+
+func (c *wsConn) serve() {
+	defer c.conn.Close()
+
+	if c.conn.Subprotocol() != wsProtocol {
+		c.close(closeBadProtocol, "Subprotocol not acceptable")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(c.r.Context())
+	defer cancel()
+
+	initTimer := time.AfterFunc(connectionInitTimeout, func() {
+		c.close(closeInitTimeout, "Connection initialisation timeout")
+	})
+	defer initTimer.Stop()
+
+	for {
+		var msg wsMessage
+		if err := c.conn.ReadJSON(&msg); err != nil {
+			if _, ok := err.(*json.SyntaxError); ok {
+				c.close(closeBadRequest, "Invalid message received")
+			}
+			return
+		}
+
+		switch msg.Type {
+		case msgConnectionInit:
+			if c.ctx != nil {
+				c.close(closeTooManyInits, "Too many initialisation requests")
+				return
+			}
+			initTimer.Stop()
+			claims, err := c.authenticate(msg.Payload)
+			if err != nil {
+				c.close(closeForbidden, "Forbidden")
+				return
+			}
+			c.claims = claims
+			c.ctx = database.WithActor(middleware.WithClaims(ctx, claims), middleware.RequestActor(c.r, claims))
+			c.send(wsMessage{Type: msgConnectionAck})
+
+		case msgPing:
+			c.send(wsMessage{Type: msgPong})
+
+		case msgPong:
+
+		case msgSubscribe:
+			if c.ctx == nil {
+				c.close(closeUnauthorized, "Unauthorized")
+				return
+			}
+			var payload wsSubscribePayload
+			if msg.ID == "" || json.Unmarshal(msg.Payload, &payload) != nil {
+				c.close(closeBadRequest, "Invalid subscribe message")
+				return
+			}
+			switch c.start(msg.ID, payload) {
+			case startDuplicate:
+				c.close(closeDuplicateID, "Subscriber for "+msg.ID+" already exists")
+				return
+			case startTooMany:
+				c.send(tooManyOperations(msg.ID))
+			}
+
+		case msgComplete:
+			c.stop(msg.ID)
+
+		default:
+			c.close(closeBadRequest, "Invalid message type "+msg.Type)
+			return
+		}
+	}
+}
+
+// authenticate validates the JWT from the connection_init payload, falling back
+// to the handshake's Authorization header
+func (c *wsConn) authenticate(raw json.RawMessage) (*handlers.Claims, error) {
+	var payload struct {
+		Authorization string `json:"Authorization"`
+		Token         string `json:"token"`
+	}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &payload); err != nil {
+			return nil, err
+		}
+	}
+	token := payload.Token
+	if token == "" {
+		header := payload.Authorization
+		if header == "" {
+			header = c.r.Header.Get("Authorization")
+		}
+		token = strings.TrimPrefix(header, "Bearer ")
+	}
+	return handlers.ValidateToken(token)
+}
+
+// Outcomes of start
+const (
+	started = iota
+	startDuplicate
+	startTooMany
+)
+
+// start runs an operation in the background unless id is in use or the
+// connection already runs maxConnectionOps operations
+func (c *wsConn) start(id string, payload wsSubscribePayload) int {
+	c.opsMu.Lock()
+	if _, ok := c.ops[id]; ok {
+		c.opsMu.Unlock()
+		return startDuplicate
+	}
+	if len(c.ops) >= maxConnectionOps {
+		c.opsMu.Unlock()
+		return startTooMany
+	}
+	ctx, cancel := context.WithCancel(c.ctx)
+	c.ops[id] = cancel
+	c.opsMu.Unlock()
+
+	go func() {
+		defer c.finish(id)
+		c.run(ctx, id, payload)
+	}()
+	return started
+}
+
+// tooManyOperations refuses an operation the connection has no room for
+func tooManyOperations(id string) wsMessage {
+	body, _ := json.Marshal([]gqlerrors.FormattedError{{
+		Message:    fmt.Sprintf("at most %d operations may run on one connection", maxConnectionOps),
+		Extensions: map[string]interface{}{"code": "TOO_MANY_OPERATIONS"},
+	}})
+	return wsMessage{ID: id, Type: msgError, Payload: body}
+}
+
+// stop cancels the operation; its goroutine then drains and exits without sending complete
+func (c *wsConn) stop(id string) {
+	c.opsMu.Lock()
+	cancel, ok := c.ops[id]
+	delete(c.ops, id)
+	c.opsMu.Unlock()
+	if ok {
+		cancel()
+	}
+}
+
+// finish sends complete unless the client already completed the operation
+func (c *wsConn) finish(id string) {
+	c.opsMu.Lock()
+	cancel, ok := c.ops[id]
+	delete(c.ops, id)
+	c.opsMu.Unlock()
+	if ok {
+		cancel()
+		c.send(wsMessage{ID: id, Type: msgComplete})
+	}
+}
+
+func (c *wsConn) run(ctx context.Context, id string, payload wsSubscribePayload) {
+	isAdmin := c.claims != nil && c.claims.Role == "admin"
+	query, rej := c.store.resolve(ctx, payload.Query, payload.Extensions.PersistedQuery, isAdmin)
+	if rej != nil {
+		c.reject(id, rej)
+		return
+	}
+	payload.Query = query
+
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(payload.Query)})})
+	if err != nil {
+		c.sendErrors(id, gqlerrors.FormatErrors(err))
+		return
+	}
+
+	a := analyze(&Schema, doc, payload.OperationName, payload.Variables, c.limits.ListSize)
+	if rej := c.limits.violation(a, isAdmin); rej != nil {
+		c.reject(id, rej)
+		return
+	}
+	// Subscriptions are charged once, when they start
+	if _, rej := c.budgets.charge(budgetKey(c.r, c.claims), a.Complexity); rej != nil {
+		c.reject(id, rej)
+		return
+	}
+
+	params := graphql.Params{
+		Schema:         Schema,
+		RequestString:  payload.Query,
+		VariableValues: payload.Variables,
+		OperationName:  payload.OperationName,
+		Context:        ctx,
+	}
+
+	if !isSubscription(doc, payload.OperationName) {
+		result := graphql.Do(params)
+		c.sendResult(ctx, id, result)
+		return
+	}
+
+	// Subscription resolvers load relations without a shared loader, so every
+	// event sees fresh data rather than what the first event cached
+	results := graphql.Subscribe(params)
+	for result := range results {
+		// Keep draining after a send fails so the executor can exit
+		c.sendResult(ctx, id, result)
+	}
+}
+
+// sendResult delivers one execution result. Results that failed before execution
+// started (no data) are protocol errors; field errors travel inside next.
+func (c *wsConn) sendResult(ctx context.Context, id string, result *graphql.Result) {
+	if ctx.Err() != nil {
+		return
+	}
+	if result.Data == nil && len(result.Errors) > 0 {
+		c.sendErrors(id, result.Errors)
+		return
+	}
+	body, err := json.Marshal(result)
+	if err != nil {
+		return
+	}
+	c.send(wsMessage{ID: id, Type: msgNext, Payload: body})
+}
+
+// sendErrors reports a failed operation. The error message ends the operation,
+// so it must not be followed by complete.
+func (c *wsConn) sendErrors(id string, errs []gqlerrors.FormattedError) {
+	c.opsMu.Lock()
+	_, ok := c.ops[id]
+	delete(c.ops, id)
+	c.opsMu.Unlock()
+	if !ok {
+		return
+	}
+	body, err := json.Marshal(errs)
+	if err != nil {
+		return
+	}
+	c.send(wsMessage{ID: id, Type: msgError, Payload: body})
+}
+
+func (c *wsConn) reject(id string, rej *rejection) {
+	c.sendErrors(id, []gqlerrors.FormattedError{{
+		Message:    rej.message,
+		Extensions: map[string]interface{}{"code": rej.code},
+	}})
+}
+
+func (c *wsConn) send(msg wsMessage) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if err := c.conn.WriteJSON(msg); err != nil {
+		c.conn.Close()
+	}
+}
+
+func (c *wsConn) close(code int, reason string) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(wsWriteTimeout))
+	c.conn.Close()
+}
+
+// isSubscription reports whether the operation that would run is a subscription
+func isSubscription(doc *ast.Document, operationName string) bool {
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if operationName == "" || (op.Name != nil && op.Name.Value == operationName) {
+			return op.Operation == ast.OperationTypeSubscription
+		}
+	}
+	return false
+}
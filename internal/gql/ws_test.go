@@ -0,0 +1,126 @@
+package gql
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"pg-management-system/internal/handlers"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialWS opens an authenticated graphql-ws connection to a test server
+func dialWS(t *testing.T, limits Limits, userID int) *websocket.Conn {
+	t.Helper()
+	t.Setenv("JWT_SECRET", "test-secret")
+	srv := httptest.NewServer(SubscriptionHandler(limits, NewQueryStore(false)))
+	t.Cleanup(srv.Close)
+
+	dialer := websocket.Dialer{Subprotocols: []string{wsProtocol}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	token, err := handlers.GenerateTokenWithTTL(userID, "ws@example.com", "WS", "user", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	init, _ := json.Marshal(map[string]string{"Authorization": "Bearer " + token})
+	send(t, conn, wsMessage{Type: msgConnectionInit, Payload: init})
+	if msg := receive(t, conn); msg.Type != msgConnectionAck {
+		t.Fatalf("got %s, want %s", msg.Type, msgConnectionAck)
+	}
+	return conn
+}
+
+func send(t *testing.T, conn *websocket.Conn, msg wsMessage) {
+	t.Helper()
+	if err := conn.WriteJSON(msg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func subscribeMsg(id, query string) wsMessage {
+	payload, _ := json.Marshal(wsSubscribePayload{Query: query})
+	return wsMessage{ID: id, Type: msgSubscribe, Payload: payload}
+}
+
+func receive(t *testing.T, conn *websocket.Conn) wsMessage {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg wsMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+// errorCode returns the extensions.code of an error message
+func errorCode(t *testing.T, msg wsMessage) string {
+	t.Helper()
+	var errs []struct {
+		Extensions map[string]interface{} `json:"extensions"`
+	}
+	if err := json.Unmarshal(msg.Payload, &errs); err != nil || len(errs) == 0 {
+		t.Fatalf("error payload %s: %v", msg.Payload, err)
+	}
+	code, _ := errs[0].Extensions["code"].(string)
+	return code
+}
+
+func TestWebSocketOperationsSpendCostBudget(t *testing.T) {
+	// A budget no other test uses, since buckets are shared per budget
+	limits := Limits{CostBudget: 3, ListSize: DefaultListSize}
+	conn := dialWS(t, limits, 9001)
+
+	// Introspection scores 1 and needs no database
+	const query = `{ __schema { queryType { name } } }`
+	for i := 1; i <= 3; i++ {
+		send(t, conn, subscribeMsg(fmt.Sprint(i), query))
+		if msg := receive(t, conn); msg.Type != msgNext {
+			t.Fatalf("operation %d: got %s %s, want next", i, msg.Type, msg.Payload)
+		}
+		if msg := receive(t, conn); msg.Type != msgComplete {
+			t.Fatalf("operation %d: got %s, want complete", i, msg.Type)
+		}
+	}
+
+	send(t, conn, subscribeMsg("4", query))
+	msg := receive(t, conn)
+	if msg.Type != msgError || errorCode(t, msg) != "COST_BUDGET_EXCEEDED" {
+		t.Fatalf("got %s %s, want COST_BUDGET_EXCEEDED", msg.Type, msg.Payload)
+	}
+}
+
+func TestWebSocketLimitsConcurrentOperations(t *testing.T) {
+	conn := dialWS(t, Limits{ListSize: DefaultListSize}, 9002)
+
+	// Subscriptions stay open until completed
+	for i := 0; i < maxConnectionOps; i++ {
+		send(t, conn, subscribeMsg(fmt.Sprint(i), `subscription { roomOccupancyChanged { id } }`))
+	}
+	send(t, conn, subscribeMsg("one-too-many", `subscription { roomOccupancyChanged { id } }`))
+
+	msg := receive(t, conn)
+	if msg.ID != "one-too-many" || msg.Type != msgError || errorCode(t, msg) != "TOO_MANY_OPERATIONS" {
+		t.Fatalf("got %s %s %s, want TOO_MANY_OPERATIONS", msg.ID, msg.Type, msg.Payload)
+	}
+}
+
+func TestWebSocketReadLimit(t *testing.T) {
+	conn := dialWS(t, Limits{ListSize: DefaultListSize}, 9003)
+
+	send(t, conn, subscribeMsg("big", "{ "+strings.Repeat(" ", maxRequestBody)+"__typename }"))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg wsMessage
+	err := conn.ReadJSON(&msg)
+	if !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		t.Fatalf("got %v, want close %d", err, websocket.CloseMessageTooBig)
+	}
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"pg-management-system/internal/database"
+	"pg-management-system/internal/response"
+)
+
+// GetAuditLog lists audit entries filtered by entity, entity_id, actor (id or email),
+// from/to (RFC 3339 or YYYY-MM-DD) and limit
+func GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := database.AuditFilter{
+		Entity: q.Get("entity"),
+		Actor:  q.Get("actor"),
+	}
+
+	var err error
+	if v := q.Get("entity_id"); v != "" {
+		if filter.EntityID, err = strconv.Atoi(v); err != nil {
+			response.ErrorMessage(w, http.StatusBadRequest, "Invalid entity_id")
+			return
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil {
+			response.ErrorMessage(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+	}
+	if filter.From, err = parseDateParam(q.Get("from"), false); err != nil {
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid from date")
+		return
+	}
+	if filter.To, err = parseDateParam(q.Get("to"), true); err != nil {
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid to date")
+		return
+	}
+
+	entries, err := database.GetAuditLog(r.Context(), filter)
+	if err != nil {
+		response.Error(w, r, err)
+		return
+	}
+
+	response.OK(w, entries)
+}
+
+// parseDateParam accepts RFC 3339 timestamps or plain dates. A plain date used as an
+// upper bound covers the whole day.
+func parseDateParam(v string, endOfDay bool) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
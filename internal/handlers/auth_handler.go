@@ -7,6 +7,7 @@ import (
 	"os"
 	"pg-management-system/internal/database"
 	"pg-management-system/internal/models"
+	"pg-management-system/internal/response"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
@@ -32,20 +33,20 @@ func GoogleLogin(w http.ResponseWriter, r *http.Request) {
 func GoogleCallback(w http.ResponseWriter, r *http.Request) {
 	state := r.FormValue("state")
 	if state != oauthStateString {
-		http.Error(w, "Invalid state", http.StatusBadRequest)
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid state")
 		return
 	}
 
 	code := r.FormValue("code")
 	token, err := getGoogleOauthConfig().Exchange(context.Background(), code)
 	if err != nil {
-		http.Error(w, "Code exchange failed", http.StatusInternalServerError)
+		response.ErrorMessage(w, http.StatusInternalServerError, "Code exchange failed")
 		return
 	}
 
 	resp, err := http.Get("https://www.googleapis.com/oauth2/v2/userinfo?access_token=" + token.AccessToken)
 	if err != nil {
-		http.Error(w, "Failed to get user info", http.StatusInternalServerError)
+		response.ErrorMessage(w, http.StatusInternalServerError, "Failed to get user info")
 		return
 	}
 	defer resp.Body.Close()
@@ -57,13 +58,13 @@ func GoogleCallback(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&googleUser); err != nil {
-		http.Error(w, "Failed to decode user info", http.StatusInternalServerError)
+		response.ErrorMessage(w, http.StatusInternalServerError, "Failed to decode user info")
 		return
 	}
 
-	user, err := database.GetUserByEmail(googleUser.Email)
+	user, err := database.GetUserByEmail(r.Context(), googleUser.Email)
 	if err != nil {
-		http.Error(w, "Database search failed", http.StatusInternalServerError)
+		response.ErrorMessage(w, http.StatusInternalServerError, "Database search failed")
 		return
 	}
 
@@ -73,14 +74,14 @@ func GoogleCallback(w http.ResponseWriter, r *http.Request) {
 			Name:     googleUser.Name,
 			GoogleID: googleUser.ID,
 		}
-		if err := database.CreateUser(user); err != nil {
-			http.Error(w, "Failed to create user", http.StatusInternalServerError)
+		if err := database.CreateUser(r.Context(), user); err != nil {
+			response.ErrorMessage(w, http.StatusInternalServerError, "Failed to create user")
 			return
 		}
 	} else if user.GoogleID == "" {
 		// Update existing user with Google ID
-		if err := database.UpdateUserByGoogleID(googleUser.ID, googleUser.Name); err != nil {
-			http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		if err := database.UpdateUserByGoogleID(r.Context(), googleUser.ID, googleUser.Name); err != nil {
+			response.ErrorMessage(w, http.StatusInternalServerError, "Failed to update user")
 			return
 		}
 		user.GoogleID = googleUser.ID
@@ -88,12 +89,11 @@ func GoogleCallback(w http.ResponseWriter, r *http.Request) {
 
 	jwtToken, err := GenerateToken(user.ID, user.Email, user.Name, user.Role)
 	if err != nil {
-		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		response.ErrorMessage(w, http.StatusInternalServerError, "Failed to generate token")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
+	response.OK(w, map[string]string{
 		"token": jwtToken,
 		"email": user.Email,
 		"name":  user.Name,
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"pg-management-system/internal/database"
+)
+
+var (
+	testDBOnce sync.Once
+	testDBErr  error
+)
+
+// useTestDB points database.DB at TEST_DATABASE_URL, a disposable database the
+// tests may write to. Tests that need PostgreSQL are skipped when it is not set.
+func useTestDB(t *testing.T) {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	for key, value := range map[string]string{
+		"PII_KEYS":      "test:" + base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32))),
+		"PII_INDEX_KEY": base64.StdEncoding.EncodeToString([]byte(strings.Repeat("i", 32))),
+	} {
+		if os.Getenv(key) == "" {
+			os.Setenv(key, value)
+		}
+	}
+	testDBOnce.Do(func() {
+		database.DB, testDBErr = database.Open(database.Config{DSN: dsn, MaxOpenConns: 5, MaxIdleConns: 5, RetryBackoff: time.Second})
+		if testDBErr == nil {
+			database.InitSchema()
+		}
+	})
+	if testDBErr != nil {
+		t.Fatal(testDBErr)
+	}
+}
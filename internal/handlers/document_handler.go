@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"pg-management-system/internal/database"
+	"pg-management-system/internal/documents"
+	"pg-management-system/internal/models"
+	"pg-management-system/internal/response"
+	"pg-management-system/internal/validation"
+
+	"github.com/gorilla/mux"
+)
+
+// UploadGuestDocument stores an ID proof for the guest, sent as multipart fields
+// file, type, number (optional) and expires_at (optional, RFC 3339 or YYYY-MM-DD)
+func UploadGuestDocument(w http.ResponseWriter, r *http.Request) {
+	guestID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid Guest ID")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, documents.MaxSize+1<<20)
+	if err := r.ParseMultipartForm(8 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			response.ErrorMessage(w, http.StatusRequestEntityTooLarge, "File is too large")
+			return
+		}
+		response.ErrorMessage(w, http.StatusBadRequest, "Expected a multipart form with a file field")
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		response.Error(w, r, &validation.Error{Fields: []validation.FieldError{{Field: "file", Message: "is required"}}})
+		return
+	}
+	defer file.Close()
+
+	doc := models.GuestDocument{
+		GuestID:  guestID,
+		Type:     r.FormValue("type"),
+		Number:   r.FormValue("number"),
+		Filename: header.Filename,
+	}
+	if v := r.FormValue("expires_at"); v != "" {
+		expires, err := parseDateParam(v, false)
+		if err != nil {
+			response.ErrorMessage(w, http.StatusBadRequest, "Invalid expires_at date")
+			return
+		}
+		doc.ExpiresAt = &expires
+	}
+
+	if err := documents.Save(r.Context(), &doc, file, header.Size); err != nil {
+		response.Error(w, r, err)
+		return
+	}
+
+	maskDocument(r, &doc)
+	response.Created(w, doc)
+}
+
+// GetGuestDocuments lists one guest's documents
+func GetGuestDocuments(w http.ResponseWriter, r *http.Request) {
+	guestID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid Guest ID")
+		return
+	}
+
+	docs, err := database.GetGuestDocuments(r.Context(), database.DocumentFilter{GuestID: guestID, Limit: 1000})
+	if err != nil {
+		response.Error(w, r, err)
+		return
+	}
+
+	for i := range docs {
+		maskDocument(r, &docs[i])
+	}
+	response.OK(w, docs)
+}
+
+// GetDocuments lists documents filtered by guest_id, type, status, expiring_before
+// (RFC 3339 or YYYY-MM-DD, inclusive of that day) and limit, for compliance checks
+// such as finding unverified or soon-to-expire proofs
+func GetDocuments(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := database.DocumentFilter{
+		Type:   q.Get("type"),
+		Status: q.Get("status"),
+	}
+
+	var err error
+	if v := q.Get("guest_id"); v != "" {
+		if filter.GuestID, err = strconv.Atoi(v); err != nil {
+			response.ErrorMessage(w, http.StatusBadRequest, "Invalid guest_id")
+			return
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil {
+			response.ErrorMessage(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+	}
+	if filter.ExpiringBefore, err = parseDateParam(q.Get("expiring_before"), true); err != nil {
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid expiring_before date")
+		return
+	}
+
+	docs, err := database.GetGuestDocuments(r.Context(), filter)
+	if err != nil {
+		response.Error(w, r, err)
+		return
+	}
+
+	for i := range docs {
+		maskDocument(r, &docs[i])
+	}
+	response.OK(w, docs)
+}
+
+func GetDocumentByID(w http.ResponseWriter, r *http.Request) {
+	doc, ok := documentFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	setETag(w, doc.Version)
+	maskDocument(r, doc)
+	response.OK(w, doc)
+}
+
+// DownloadDocument sends a document's file as an attachment
+func DownloadDocument(w http.ResponseWriter, r *http.Request) {
+	doc, ok := documentFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	content, err := documents.Open(r.Context(), doc)
+	if err != nil {
+		response.Error(w, r, err)
+		return
+	}
+	defer content.Close()
+
+	filename := doc.Filename
+	if filename == "" {
+		filename = doc.Type
+	}
+	w.Header().Set("Content-Type", doc.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(doc.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, no-store")
+	if _, err := io.Copy(w, content); err != nil {
+		log.Printf("Failed to send document %d: %v", doc.ID, err)
+	}
+}
+
+// ReviewDocument records a verification decision: {"status": "verified"|"rejected"|"pending",
+// "reason": "..."}. If-Match guards against two reviewers deciding at once.
+func ReviewDocument(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid Document ID")
+		return
+	}
+
+	var review models.DocumentReview
+	if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if expected, err := ifMatchVersion(r); err != nil {
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid If-Match header")
+		return
+	} else if expected != 0 {
+		review.Version = expected
+	}
+
+	if err := validation.DocumentReview(&review); err != nil {
+		response.Error(w, r, err)
+		return
+	}
+
+	if err := database.ReviewGuestDocument(r.Context(), id, &review); err != nil {
+		response.Error(w, r, err)
+		return
+	}
+
+	doc, err := database.GetGuestDocumentByID(database.WithPrimary(r.Context()), id)
+	if err != nil {
+		response.Error(w, r, err)
+		return
+	}
+
+	setETag(w, doc.Version)
+	maskDocument(r, doc)
+	response.OK(w, doc)
+}
+
+// DeleteDocument removes a document and its file for good
+func DeleteDocument(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid Document ID")
+		return
+	}
+
+	if err := documents.Delete(r.Context(), id); err != nil {
+		if err == sql.ErrNoRows {
+			response.ErrorMessage(w, http.StatusNotFound, "Document not found")
+			return
+		}
+		response.Error(w, r, err)
+		return
+	}
+
+	response.NoContent(w)
+}
+
+func documentFromPath(w http.ResponseWriter, r *http.Request) (*models.GuestDocument, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid Document ID")
+		return nil, false
+	}
+
+	doc, err := database.GetGuestDocumentByID(r.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.ErrorMessage(w, http.StatusNotFound, "Document not found")
+			return nil, false
+		}
+		response.Error(w, r, err)
+		return nil, false
+	}
+	return doc, true
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"pg-management-system/internal/export"
+	"pg-management-system/internal/response"
+
+	"github.com/gorilla/mux"
+)
+
+// ExportData streams rooms, guests, payments or the monthly-payments report as a
+// download. Query options: format=csv|xlsx|ndjson (default csv), include_deleted=true
+// (admins) and, for payments and reports, from/to dates.
+func ExportData(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	opts := export.Options{
+		Kind:   mux.Vars(r)["kind"],
+		Format: q.Get("format"),
+		Filter: listFilter(r),
+	}
+	if opts.Format == "" {
+		opts.Format = export.FormatCSV
+	}
+
+	var err error
+	if opts.Period.From, err = parseDateParam(q.Get("from"), false); err != nil {
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid from date")
+		return
+	}
+	if opts.Period.To, err = parseDateParam(q.Get("to"), true); err != nil {
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid to date")
+		return
+	}
+
+	if err := opts.Validate(); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, export.ErrUnknownKind) {
+			status = http.StatusNotFound
+		}
+		response.ErrorMessage(w, status, err.Error())
+		return
+	}
+
+	filename := export.Filename(opts, time.Now())
+	out := &lazyWriter{w: w, start: func() {
+		w.Header().Set("Content-Type", export.ContentType(opts.Format))
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+		w.WriteHeader(http.StatusOK)
+	}}
+
+	if err := export.Write(r.Context(), out, opts); err != nil {
+		if !out.started {
+			response.Error(w, r, err)
+			return
+		}
+		// Headers are gone; abort the connection so the client cannot mistake
+		// a truncated file for a complete one
+		log.Printf("export %s failed after streaming began: %v", filename, err)
+		panic(http.ErrAbortHandler)
+	}
+	if !out.started {
+		out.start()
+	}
+}
+
+// lazyWriter delays the response headers until the first byte of output, so errors
+// raised before then can still be sent as a normal error response
+type lazyWriter struct {
+	w       http.ResponseWriter
+	start   func()
+	started bool
+}
+
+func (l *lazyWriter) Write(p []byte) (int, error) {
+	if !l.started {
+		l.started = true
+		l.start()
+	}
+	return l.w.Write(p)
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"pg-management-system/internal/database"
+	"pg-management-system/internal/xlsx"
+
+	"github.com/gorilla/mux"
+)
+
+// roomStream serves a rooms table of a set size and can fail part way through it
+type roomStream struct {
+	mu        sync.Mutex
+	rooms     int
+	failAfter int // rows sent before the stream breaks; -1 never breaks
+}
+
+var exportDB = &roomStream{}
+
+func init() {
+	sql.Register("export-stream", exportDB)
+}
+
+func (s *roomStream) Open(string) (driver.Conn, error) { return streamConn{s}, nil }
+
+type streamConn struct{ s *roomStream }
+
+func (c streamConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c streamConn) Close() error                        { return nil }
+func (c streamConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (c streamConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if !strings.Contains(query, "FROM rooms") {
+		return nil, fmt.Errorf("unexpected query %s", query)
+	}
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	return &roomRows{total: c.s.rooms, failAfter: c.s.failAfter}, nil
+}
+
+type roomRows struct {
+	sent, total, failAfter int
+}
+
+func (r *roomRows) Columns() []string {
+	return []string{"id", "room_number", "capacity", "occupancy", "price", "deleted_at", "version"}
+}
+func (r *roomRows) Close() error { return nil }
+
+func (r *roomRows) Next(dest []driver.Value) error {
+	if r.sent == r.failAfter {
+		return errors.New("connection reset by peer")
+	}
+	if r.sent == r.total {
+		return io.EOF
+	}
+	r.sent++
+	copy(dest, []driver.Value{int64(r.sent), fmt.Sprintf("R%03d", r.sent), int64(2), int64(1), 5000.5, nil, int64(1)})
+	return nil
+}
+
+func useRoomStream(t *testing.T, rooms, failAfter int) {
+	t.Helper()
+	exportDB.mu.Lock()
+	exportDB.rooms, exportDB.failAfter = rooms, failAfter
+	exportDB.mu.Unlock()
+
+	db, err := sql.Open("export-stream", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prevDB, prevReplica := database.DB, database.Replica
+	database.DB, database.Replica = db, nil
+	t.Cleanup(func() {
+		database.DB, database.Replica = prevDB, prevReplica
+		db.Close()
+	})
+}
+
+func exportRequest(query string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/api/export/rooms?"+query, nil)
+	return mux.SetURLVars(req, map[string]string{"kind": "rooms"})
+}
+
+func TestExportXLSXRoundTrip(t *testing.T) {
+	useRoomStream(t, 3, -1)
+	w := httptest.NewRecorder()
+	ExportData(w, exportRequest("format=xlsx"))
+
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != xlsx.MimeType {
+		t.Fatalf("status %d, Content-Type %q: %s", w.Code, w.Header().Get("Content-Type"), w.Body)
+	}
+	rows, err := xlsx.ReadRows(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"id", "room_number", "capacity", "occupancy", "price", "deleted_at", "version"},
+		{"1", "R001", "2", "1", "5000.5", "", "1"},
+		{"2", "R002", "2", "1", "5000.5", "", "1"},
+		{"3", "R003", "2", "1", "5000.5", "", "1"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %q\nwant %q", rows, want)
+	}
+}
+
+func TestExportFailureBeforeOutputIsAnError(t *testing.T) {
+	useRoomStream(t, 3, 1)
+	w := httptest.NewRecorder()
+	ExportData(w, exportRequest("format=csv"))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status %d, want 500", w.Code)
+	}
+	if cd := w.Header().Get("Content-Disposition"); cd != "" {
+		t.Errorf("error response offered a download: %s", cd)
+	}
+	if strings.Contains(w.Body.String(), "connection reset") {
+		t.Errorf("response leaks the database error: %s", w.Body)
+	}
+}
+
+func TestExportFailureMidStreamAbortsTheResponse(t *testing.T) {
+	// Enough rows to flush the CSV writer's buffer before the stream breaks
+	useRoomStream(t, 1000, 500)
+
+	w := httptest.NewRecorder()
+	func() {
+		defer func() {
+			if p := recover(); p != http.ErrAbortHandler {
+				t.Errorf("recovered %v, want http.ErrAbortHandler", p)
+			}
+		}()
+		ExportData(w, exportRequest("format=csv"))
+	}()
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv") {
+		t.Errorf("status %d, Content-Type %q; the headers should have gone out with the first rows", w.Code, w.Header().Get("Content-Type"))
+	}
+	if !strings.HasPrefix(w.Body.String(), "id,room_number,") || strings.Contains(w.Body.String(), "R500") {
+		t.Errorf("unexpected partial body of %d bytes", w.Body.Len())
+	}
+
+	// A real client sees a broken download, not a short file that looks complete
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ExportData(w, mux.SetURLVars(r, map[string]string{"kind": "rooms"}))
+	}))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/api/export/rooms?format=csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if _, err := io.ReadAll(resp.Body); err == nil {
+		t.Error("client read a truncated export without an error")
+	}
+}
@@ -1,96 +1,198 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
 	"net/http"
 	"strconv"
 
 	"pg-management-system/internal/database"
 	"pg-management-system/internal/models"
+	"pg-management-system/internal/response"
+	"pg-management-system/internal/validation"
+
 	"github.com/gorilla/mux"
 )
 
 func CreateGuest(w http.ResponseWriter, r *http.Request) {
 	var guest models.Guest
 	if err := json.NewDecoder(r.Body).Decode(&guest); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := validation.Guest(r.Context(), &guest); err != nil {
+		response.Error(w, r, err)
 		return
 	}
 
-	if err := database.CreateGuest(&guest); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := database.CreateGuest(r.Context(), &guest); err != nil {
+		response.Error(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(guest)
+	response.Created(w, guest)
 }
 
 func GetAllGuests(w http.ResponseWriter, r *http.Request) {
-	guests, err := database.GetAllGuests()
+	guests, err := database.GetAllGuests(r.Context(), listFilter(r))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		response.Error(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(guests)
+	for i := range guests {
+		maskGuest(r, &guests[i])
+	}
+	response.OK(w, guests)
 }
 
 func GetGuestByID(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid ID")
 		return
 	}
 
-	guest, err := database.GetGuestByID(id)
+	guest, err := database.GetGuestByID(r.Context(), id)
 	if err != nil {
-		http.Error(w, "Guest not found", http.StatusNotFound)
+		if err == sql.ErrNoRows {
+			response.ErrorMessage(w, http.StatusNotFound, "Guest not found")
+			return
+		}
+		response.Error(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(guest)
+	setETag(w, guest.Version)
+	maskGuest(r, guest)
+	response.OK(w, guest)
 }
 
 func UpdateGuest(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid ID")
 		return
 	}
 
 	var guest models.Guest
 	if err := json.NewDecoder(r.Body).Decode(&guest); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if guest.Version, err = ifMatchVersion(r); err != nil {
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid If-Match header")
+		return
+	}
+
+	if err := validation.Guest(r.Context(), &guest); err != nil {
+		response.Error(w, r, err)
 		return
 	}
 
-	if err := database.UpdateGuest(id, &guest); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := database.UpdateGuest(r.Context(), id, &guest); err != nil {
+		response.Error(w, r, err)
 		return
 	}
 
 	guest.ID = id
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(guest)
+	setETag(w, guest.Version)
+	response.OK(w, guest)
 }
 
 func DeleteGuest(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	if err := database.DeleteGuest(r.Context(), id); err != nil {
+		response.Error(w, r, err)
+		return
+	}
+
+	response.NoContent(w)
+}
+
+// RestoreGuest undeletes a soft-deleted guest and returns it
+func RestoreGuest(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	if err := database.RestoreGuest(r.Context(), id); err != nil {
+		if err == sql.ErrNoRows {
+			response.ErrorMessage(w, http.StatusNotFound, "Deleted guest not found")
+			return
+		}
+		response.Error(w, r, err)
+		return
+	}
+
+	guest, err := database.GetGuestByID(database.WithPrimary(r.Context()), id)
+	if err != nil {
+		response.Error(w, r, err)
+		return
+	}
+
+	setETag(w, guest.Version)
+	response.OK(w, guest)
+}
+
+// PatchGuest applies a JSON Merge Patch, changing only the fields present in the body
+func PatchGuest(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	expected, err := ifMatchVersion(r)
+	if err != nil {
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid If-Match header")
+		return
+	}
+
+	guest, err := database.GetGuestByID(database.WithPrimary(r.Context()), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.ErrorMessage(w, http.StatusNotFound, "Guest not found")
+			return
+		}
+		response.Error(w, r, err)
+		return
+	}
+
+	if err := applyMergePatch(r, guest); err != nil {
+		patchError(w, r, err)
+		return
+	}
+
+	// If-Match wins; otherwise the version read above guards against concurrent edits
+	if expected != 0 {
+		guest.Version = expected
+	}
+
+	if err := validation.Guest(r.Context(), guest); err != nil {
+		response.Error(w, r, err)
 		return
 	}
 
-	if err := database.DeleteGuest(id); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := database.UpdateGuest(r.Context(), id, guest); err != nil {
+		response.Error(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	setETag(w, guest.Version)
+	response.OK(w, guest)
 }
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"pg-management-system/internal/importer"
+	"pg-management-system/internal/response"
+
+	"github.com/gorilla/mux"
+)
+
+// ImportData bulk-loads rooms or guests from a CSV/XLSX upload, sent either as the
+// multipart field "file" or as the raw body. Query options: format, dry_run=true,
+// mode=partial.
+func ImportData(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	opts := importer.Options{
+		Kind:    mux.Vars(r)["kind"],
+		DryRun:  q.Get("dry_run") == "true",
+		Partial: q.Get("mode") == "partial",
+	}
+
+	// Room for the file plus the multipart framing around it
+	r.Body = http.MaxBytesReader(w, r.Body, importer.MaxFileSize+1<<20)
+	var (
+		body        io.Reader = r.Body
+		filename    string
+		contentType = r.Header.Get("Content-Type")
+	)
+	if file, header, err := r.FormFile("file"); err == nil {
+		defer file.Close()
+		defer r.MultipartForm.RemoveAll()
+		body, filename, contentType = file, header.Filename, header.Header.Get("Content-Type")
+	} else if tooLarge(err) {
+		response.ErrorMessage(w, http.StatusRequestEntityTooLarge, importer.ErrTooLarge.Error())
+		return
+	}
+
+	format, err := importer.DetectFormat(q.Get("format"), filename, contentType)
+	if err != nil {
+		response.ErrorMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	table, err := importer.ReadTable(body, format)
+	if tooLarge(err) {
+		response.ErrorMessage(w, http.StatusRequestEntityTooLarge, importer.ErrTooLarge.Error())
+		return
+	}
+	if err != nil {
+		response.ErrorMessage(w, http.StatusBadRequest, "Could not read file: "+err.Error())
+		return
+	}
+
+	report, err := importer.Run(r.Context(), table, opts)
+	if err != nil {
+		if errors.Is(err, importer.ErrInvalidFile) {
+			response.ErrorMessage(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		response.Error(w, r, err)
+		return
+	}
+
+	status := http.StatusOK
+	if !report.Committed && !report.DryRun {
+		status = http.StatusUnprocessableEntity
+	}
+	response.JSON(w, status, report)
+}
+
+// tooLarge reports whether err comes from an upload over the size limit
+func tooLarge(err error) bool {
+	var maxBytes *http.MaxBytesError
+	return errors.As(err, &maxBytes) || errors.Is(err, importer.ErrTooLarge)
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"pg-management-system/internal/importer"
+
+	"github.com/gorilla/mux"
+)
+
+// oversized is a CSV just over the import limit
+func oversized() io.Reader {
+	row := "R101,2,5000\n"
+	return io.MultiReader(
+		strings.NewReader("room_number,capacity,price\n"),
+		strings.NewReader(strings.Repeat(row, importer.MaxFileSize/len(row)+1)),
+	)
+}
+
+func TestImportDataRejectsOversizedUploads(t *testing.T) {
+	raw := httptest.NewRequest(http.MethodPost, "/api/import/rooms?format=csv", oversized())
+	raw.Header.Set("Content-Type", "text/csv")
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	part, _ := mw.CreateFormFile("file", "rooms.csv")
+	io.Copy(part, oversized())
+	mw.Close()
+	form := httptest.NewRequest(http.MethodPost, "/api/import/rooms", &buf)
+	form.Header.Set("Content-Type", mw.FormDataContentType())
+
+	for name, req := range map[string]*http.Request{"raw body": raw, "multipart": form} {
+		req = mux.SetURLVars(req, map[string]string{"kind": "rooms"})
+		w := httptest.NewRecorder()
+		ImportData(w, req)
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s: status %d, want 413: %s", name, w.Code, w.Body)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"errors"
 	"os"
 	"time"
@@ -8,7 +9,10 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtKey = []byte(os.Getenv("JWT_SECRET"))
+// jwtKey is read on use so a JWT_SECRET loaded from .env after startup still applies
+func jwtKey() []byte {
+	return []byte(os.Getenv("JWT_SECRET"))
+}
 
 type Claims struct {
 	UserID int    `json:"user_id"`
@@ -18,9 +22,27 @@ type Claims struct {
 	jwt.RegisteredClaims
 }
 
+type claimsKey struct{}
+
+// ContextWithClaims stores validated token claims for handlers further down the chain
+func ContextWithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims stored by ContextWithClaims, if any
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok && claims != nil
+}
+
 func GenerateToken(userID int, email string, name string, role string) (string, error) {
 	// Set expiration time to 1 hour
-	expirationTime := time.Now().Add(1 * time.Hour)
+	return GenerateTokenWithTTL(userID, email, name, role, 1*time.Hour)
+}
+
+// GenerateTokenWithTTL issues a token that expires after ttl
+func GenerateTokenWithTTL(userID int, email string, name string, role string, ttl time.Duration) (string, error) {
+	expirationTime := time.Now().Add(ttl)
 	claims := &Claims{
 		UserID: userID,
 		Email:  email,
@@ -32,13 +54,13 @@ func GenerateToken(userID int, email string, name string, role string) (string,
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtKey)
+	return token.SignedString(jwtKey())
 }
 
 func ValidateToken(tokenString string) (*Claims, error) {
 	claims := &Claims{}
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
+		return jwtKey(), nil
 	})
 
 	if err != nil {
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"net/http"
+
+	"pg-management-system/internal/models"
+	"pg-management-system/internal/pii"
+)
+
+// requestRole is the signed-in user's role, or "" without a session
+func requestRole(r *http.Request) string {
+	if claims, ok := ClaimsFromContext(r.Context()); ok {
+		return claims.Role
+	}
+	return ""
+}
+
+// maskGuest hides the contact details the caller's role may not see in full
+func maskGuest(r *http.Request, guest *models.Guest) {
+	role := requestRole(r)
+	guest.Email = pii.Visible(role, pii.GuestEmail, guest.Email)
+	guest.Phone = pii.Visible(role, pii.GuestPhone, guest.Phone)
+}
+
+// maskDocument hides the ID number from roles that may not see it in full
+func maskDocument(r *http.Request, doc *models.GuestDocument) {
+	doc.Number = pii.Visible(requestRole(r), pii.DocumentNumber, doc.Number)
+}
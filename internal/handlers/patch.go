@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"reflect"
+
+	"pg-management-system/internal/response"
+	"pg-management-system/internal/validation"
+)
+
+// readOnlyFields may not appear in any patch; the server owns them
+var readOnlyFields = []string{"id", "version", "deleted_at"}
+
+var errUnsupportedPatch = errors.New("unsupported patch format, use application/merge-patch+json")
+
+// applyMergePatch applies the request body as a JSON Merge Patch (RFC 7386) to target,
+// which must be a pointer to a model. Fields absent from the patch keep their values
+// and fields set to null are reset to their zero value. A patch that sets one of
+// readOnlyFields or the model's own readOnly fields fails validation.
+func applyMergePatch(r *http.Request, target any, readOnly ...string) error {
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mediaType, _, err := mime.ParseMediaType(ct)
+		if err != nil || (mediaType != "application/merge-patch+json" && mediaType != "application/json") {
+			return errUnsupportedPatch
+		}
+	}
+
+	var patch any
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		return err
+	}
+	if fields, ok := patch.(map[string]any); ok {
+		vErr := &validation.Error{}
+		for _, field := range append(readOnlyFields, readOnly...) {
+			if _, ok := fields[field]; ok {
+				vErr.Fields = append(vErr.Fields, validation.FieldError{Field: field, Message: "is read-only"})
+			}
+		}
+		if len(vErr.Fields) > 0 {
+			return vErr
+		}
+	}
+
+	current, err := json.Marshal(target)
+	if err != nil {
+		return err
+	}
+	var doc any
+	if err := json.Unmarshal(current, &doc); err != nil {
+		return err
+	}
+
+	// A patch that is not an object replaces the whole document, which a model cannot be
+	result, ok := mergePatch(doc, patch).(map[string]any)
+	if !ok {
+		return errors.New("patch must leave a JSON object")
+	}
+	merged, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	v := reflect.ValueOf(target).Elem()
+	v.Set(reflect.Zero(v.Type()))
+	return json.Unmarshal(merged, target)
+}
+
+// patchError reports why applyMergePatch failed
+func patchError(w http.ResponseWriter, r *http.Request, err error) {
+	var vErr *validation.Error
+	switch {
+	case err == errUnsupportedPatch:
+		response.ErrorMessage(w, http.StatusUnsupportedMediaType, err.Error())
+	case errors.As(err, &vErr):
+		response.Error(w, r, err)
+	default:
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid patch document")
+	}
+}
+
+// mergePatch implements the MergePatch function of RFC 7386
+func mergePatch(target, patch any) any {
+	fields, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	doc, ok := target.(map[string]any)
+	if !ok {
+		doc = map[string]any{}
+	}
+	for key, value := range fields {
+		if value == nil {
+			delete(doc, key)
+			continue
+		}
+		doc[key] = mergePatch(doc[key], value)
+	}
+	return doc
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"pg-management-system/internal/database"
+	"pg-management-system/internal/models"
+	"pg-management-system/internal/validation"
+
+	"github.com/gorilla/mux"
+)
+
+func TestMergePatch(t *testing.T) {
+	// The examples of RFC 7386, appendix A
+	tests := []struct {
+		target, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, tt := range tests {
+		if got := mergePatch(decodeJSON(t, tt.target), decodeJSON(t, tt.patch)); !reflect.DeepEqual(got, decodeJSON(t, tt.want)) {
+			t.Errorf("mergePatch(%s, %s) = %v, want %s", tt.target, tt.patch, got, tt.want)
+		}
+	}
+}
+
+func decodeJSON(t *testing.T, raw string) any {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal([]byte(raw), &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func patchRequest(body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	return req
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	joined := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	guest := func() *models.Guest {
+		return &models.Guest{ID: 7, Name: "Asha", Email: "asha@example.com", Phone: "+91 98765 43210", RoomID: 3, JoinDate: joined, Version: 2}
+	}
+
+	t.Run("absent fields keep their values", func(t *testing.T) {
+		g := guest()
+		if err := applyMergePatch(patchRequest(`{"name":"Asha K"}`), g); err != nil {
+			t.Fatal(err)
+		}
+		want := guest()
+		want.Name = "Asha K"
+		if !reflect.DeepEqual(g, want) {
+			t.Errorf("got %+v, want %+v", g, want)
+		}
+	})
+
+	t.Run("null removes a field", func(t *testing.T) {
+		g := guest()
+		if err := applyMergePatch(patchRequest(`{"phone":null}`), g); err != nil {
+			t.Fatal(err)
+		}
+		if g.Phone != "" || g.Name != "Asha" || g.ID != 7 {
+			t.Errorf("got %+v", g)
+		}
+	})
+
+	t.Run("nested objects merge", func(t *testing.T) {
+		type profile struct {
+			Name    string            `json:"name"`
+			Address map[string]string `json:"address"`
+		}
+		p := &profile{Name: "Asha", Address: map[string]string{"city": "Pune", "pin": "411001"}}
+		if err := applyMergePatch(patchRequest(`{"address":{"pin":"411002","line":"MG Road"}}`), p); err != nil {
+			t.Fatal(err)
+		}
+		want := &profile{Name: "Asha", Address: map[string]string{"city": "Pune", "pin": "411002", "line": "MG Road"}}
+		if !reflect.DeepEqual(p, want) {
+			t.Errorf("got %+v, want %+v", p, want)
+		}
+	})
+
+	t.Run("a non-object patch cannot replace a model", func(t *testing.T) {
+		for _, body := range []string{`["Asha"]`, `"Asha"`, `null`} {
+			g := guest()
+			if err := applyMergePatch(patchRequest(body), g); err == nil {
+				t.Errorf("%s: replaced the guest with %+v", body, g)
+			}
+		}
+	})
+
+	t.Run("unsupported content type", func(t *testing.T) {
+		req := patchRequest(`{"name":"x"}`)
+		req.Header.Set("Content-Type", "application/json-patch+json")
+		if err := applyMergePatch(req, guest()); err != errUnsupportedPatch {
+			t.Errorf("err = %v", err)
+		}
+	})
+}
+
+func TestApplyMergePatchRejectsReadOnlyFields(t *testing.T) {
+	tests := []struct {
+		body   string
+		fields []string
+	}{
+		{`{"id":9}`, []string{"id"}},
+		{`{"version":1,"capacity":3}`, []string{"version"}},
+		{`{"deleted_at":null}`, []string{"deleted_at"}},
+		{`{"occupancy":0}`, []string{"occupancy"}},
+		{`{"id":1,"version":1,"occupancy":1}`, []string{"id", "version", "occupancy"}},
+	}
+	for _, tt := range tests {
+		room := &models.Room{ID: 1, RoomNumber: "101", Capacity: 2, Occupancy: 1, Price: 5000, Version: 4}
+		before := *room
+		err := applyMergePatch(patchRequest(tt.body), room, "occupancy")
+
+		var vErr *validation.Error
+		if !errors.As(err, &vErr) {
+			t.Errorf("%s: err = %v, want a validation error", tt.body, err)
+			continue
+		}
+		var got []string
+		for _, f := range vErr.Fields {
+			got = append(got, f.Field)
+		}
+		if !reflect.DeepEqual(got, tt.fields) {
+			t.Errorf("%s: rejected %v, want %v", tt.body, got, tt.fields)
+		}
+		if *room != before {
+			t.Errorf("%s: room changed to %+v", tt.body, room)
+		}
+
+		w := httptest.NewRecorder()
+		patchError(w, patchRequest(tt.body), err)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "validation_failed") {
+			t.Errorf("%s: status %d: %s", tt.body, w.Code, w.Body)
+		}
+	}
+
+	// occupancy is only read-only where the model says so
+	if err := applyMergePatch(patchRequest(`{"occupancy":1}`), &models.Guest{}); err != nil {
+		t.Errorf("guest patch: %v", err)
+	}
+}
+
+func TestPatchRoomWithStaleIfMatch(t *testing.T) {
+	useTestDB(t)
+	room := &models.Room{RoomNumber: fmt.Sprintf("P-%d", time.Now().UnixNano()), Capacity: 2, Price: 5000}
+	if err := database.CreateRoom(context.Background(), room); err != nil {
+		t.Fatal(err)
+	}
+
+	patch := func(ifMatch, body string) *httptest.ResponseRecorder {
+		req := patchRequest(body)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(room.ID)})
+		w := httptest.NewRecorder()
+		PatchRoom(w, req)
+		return w
+	}
+
+	stale := fmt.Sprintf(`"%d"`, room.Version)
+	w := patch(stale, `{"price":5500}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("first patch: status %d: %s", w.Code, w.Body)
+	}
+	if w.Header().Get("ETag") == stale {
+		t.Error("ETag did not move on")
+	}
+
+	if w := patch(stale, `{"price":6000}`); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("stale If-Match: status %d, want 412: %s", w.Code, w.Body)
+	}
+	got, err := database.GetRoomByID(context.Background(), room.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Price != 5500 {
+		t.Errorf("price %v after a rejected patch, want 5500", got.Price)
+	}
+}
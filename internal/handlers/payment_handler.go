@@ -1,12 +1,15 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
 	"net/http"
 	"strconv"
 
 	"pg-management-system/internal/database"
 	"pg-management-system/internal/models"
+	"pg-management-system/internal/response"
+	"pg-management-system/internal/validation"
 
 	"github.com/gorilla/mux"
 )
@@ -14,102 +17,195 @@ import (
 func CreatePayment(w http.ResponseWriter, r *http.Request) {
 	var payment models.Payment
 	if err := json.NewDecoder(r.Body).Decode(&payment); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
 
-	if err := database.CreatePayment(&payment); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := validation.Payment(r.Context(), &payment); err != nil {
+		response.Error(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(payment)
+	if err := database.CreatePayment(r.Context(), &payment); err != nil {
+		response.Error(w, r, err)
+		return
+	}
+
+	response.Created(w, payment)
 }
 
 func GetPaymentsByGuestID(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	guestID, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid Guest ID", http.StatusBadRequest)
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid Guest ID")
 		return
 	}
 
-	payments, err := database.GetPaymentsByGuestID(guestID)
+	payments, err := database.GetPaymentsByGuestID(r.Context(), guestID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		response.Error(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(payments)
+	response.OK(w, payments)
 }
 
 func GetAllPayments(w http.ResponseWriter, r *http.Request) {
-	payments, err := database.GetAllPayments()
+	payments, err := database.GetAllPayments(r.Context(), listFilter(r))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		response.Error(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(payments)
+	response.OK(w, payments)
 }
 
 func GetPaymentByID(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid Payment ID", http.StatusBadRequest)
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid Payment ID")
 		return
 	}
 
-	payment, err := database.GetPaymentByID(id)
+	payment, err := database.GetPaymentByID(r.Context(), id)
 	if err != nil {
-		http.Error(w, "Payment not found", http.StatusNotFound)
+		if err == sql.ErrNoRows {
+			response.ErrorMessage(w, http.StatusNotFound, "Payment not found")
+			return
+		}
+		response.Error(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(payment)
+	setETag(w, payment.Version)
+	response.OK(w, payment)
 }
 
 func UpdatePayment(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid Payment ID", http.StatusBadRequest)
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid Payment ID")
 		return
 	}
 
 	var payment models.Payment
 	if err := json.NewDecoder(r.Body).Decode(&payment); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
 	payment.ID = id
 
-	if err := database.UpdatePayment(&payment); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if payment.Version, err = ifMatchVersion(r); err != nil {
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid If-Match header")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(payment)
+	if err := validation.Payment(r.Context(), &payment); err != nil {
+		response.Error(w, r, err)
+		return
+	}
+
+	if err := database.UpdatePayment(r.Context(), &payment); err != nil {
+		response.Error(w, r, err)
+		return
+	}
+
+	setETag(w, payment.Version)
+	response.OK(w, payment)
 }
 
 func DeletePayment(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid Payment ID", http.StatusBadRequest)
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid Payment ID")
+		return
+	}
+
+	if err := database.DeletePayment(r.Context(), id); err != nil {
+		response.Error(w, r, err)
+		return
+	}
+
+	response.NoContent(w)
+}
+
+// RestorePayment undeletes a soft-deleted payment and returns it
+func RestorePayment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid Payment ID")
+		return
+	}
+
+	if err := database.RestorePayment(r.Context(), id); err != nil {
+		if err == sql.ErrNoRows {
+			response.ErrorMessage(w, http.StatusNotFound, "Deleted payment not found")
+			return
+		}
+		response.Error(w, r, err)
+		return
+	}
+
+	payment, err := database.GetPaymentByID(database.WithPrimary(r.Context()), id)
+	if err != nil {
+		response.Error(w, r, err)
+		return
+	}
+
+	setETag(w, payment.Version)
+	response.OK(w, payment)
+}
+
+// PatchPayment applies a JSON Merge Patch, changing only the fields present in the body
+func PatchPayment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid Payment ID")
+		return
+	}
+
+	expected, err := ifMatchVersion(r)
+	if err != nil {
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid If-Match header")
+		return
+	}
+
+	payment, err := database.GetPaymentByID(database.WithPrimary(r.Context()), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.ErrorMessage(w, http.StatusNotFound, "Payment not found")
+			return
+		}
+		response.Error(w, r, err)
+		return
+	}
+
+	if err := applyMergePatch(r, payment); err != nil {
+		patchError(w, r, err)
+		return
+	}
+
+	// If-Match wins; otherwise the version read above guards against concurrent edits
+	if expected != 0 {
+		payment.Version = expected
+	}
+
+	if err := validation.Payment(r.Context(), payment); err != nil {
+		response.Error(w, r, err)
 		return
 	}
 
-	if err := database.DeletePayment(id); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := database.UpdatePayment(r.Context(), payment); err != nil {
+		response.Error(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	setETag(w, payment.Version)
+	response.OK(w, payment)
 }
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"pg-management-system/internal/database"
+)
+
+// listFilter reads list options from the query string. Only admins may see deleted rows.
+func listFilter(r *http.Request) database.ListFilter {
+	var filter database.ListFilter
+	if r.URL.Query().Get("include_deleted") == "true" {
+		claims, ok := ClaimsFromContext(r.Context())
+		filter.IncludeDeleted = ok && claims.Role == "admin"
+	}
+	return filter
+}
+
+// ifMatchVersion returns the version named by the If-Match header, or 0 when it is absent or "*"
+func ifMatchVersion(r *http.Request) (int, error) {
+	v := strings.TrimSpace(r.Header.Get("If-Match"))
+	if v == "" || v == "*" {
+		return 0, nil
+	}
+	v = strings.TrimPrefix(v, "W/")
+	return strconv.Atoi(strings.Trim(v, `"`))
+}
+
+// setETag advertises the entity version so clients can send it back in If-Match
+func setETag(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", fmt.Sprintf(`"%d"`, version))
+}
@@ -1,12 +1,15 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
 	"net/http"
 	"strconv"
 
 	"pg-management-system/internal/database"
 	"pg-management-system/internal/models"
+	"pg-management-system/internal/response"
+	"pg-management-system/internal/validation"
 
 	"github.com/gorilla/mux"
 )
@@ -14,99 +17,178 @@ import (
 func CreateRoom(w http.ResponseWriter, r *http.Request) {
 	var room models.Room
 	if err := json.NewDecoder(r.Body).Decode(&room); err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
 
-	// Validation
-	if room.RoomNumber == "" {
-		http.Error(w, "Room number is required", http.StatusBadRequest)
-		return
-	}
-	if room.Capacity <= 0 {
-		http.Error(w, "Capacity must be greater than zero", http.StatusBadRequest)
-		return
-	}
-	if room.Price <= 0 {
-		http.Error(w, "Price must be greater than zero", http.StatusBadRequest)
+	if err := validation.Room(&room); err != nil {
+		response.Error(w, r, err)
 		return
 	}
 
-	if err := database.CreateRoom(&room); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := database.CreateRoom(r.Context(), &room); err != nil {
+		response.Error(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(room)
+	response.Created(w, room)
 }
 
 func GetAllRooms(w http.ResponseWriter, r *http.Request) {
-	rooms, err := database.GetAllRooms()
+	rooms, err := database.GetAllRooms(r.Context(), listFilter(r))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		response.Error(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(rooms)
+	response.OK(w, rooms)
 }
 
 func GetRoomByID(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid ID")
 		return
 	}
 
-	room, err := database.GetRoomByID(id)
+	room, err := database.GetRoomByID(r.Context(), id)
 	if err != nil {
-		http.Error(w, "Room not found", http.StatusNotFound)
+		if err == sql.ErrNoRows {
+			response.ErrorMessage(w, http.StatusNotFound, "Room not found")
+			return
+		}
+		response.Error(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(room)
+	setETag(w, room.Version)
+	response.OK(w, room)
 }
 
 func UpdateRoom(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid ID")
 		return
 	}
 
 	var room models.Room
 	if err := json.NewDecoder(r.Body).Decode(&room); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if room.Version, err = ifMatchVersion(r); err != nil {
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid If-Match header")
 		return
 	}
 
-	if err := database.UpdateRoom(id, &room); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := validation.Room(&room); err != nil {
+		response.Error(w, r, err)
+		return
+	}
+
+	if err := database.UpdateRoom(r.Context(), id, &room); err != nil {
+		response.Error(w, r, err)
 		return
 	}
 
 	room.ID = id
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(room)
+	setETag(w, room.Version)
+	response.OK(w, room)
 }
 
 func DeleteRoom(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	if err := database.DeleteRoom(r.Context(), id); err != nil {
+		response.Error(w, r, err)
+		return
+	}
+
+	response.NoContent(w)
+}
+
+// RestoreRoom undeletes a soft-deleted room and returns it
+func RestoreRoom(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	if err := database.RestoreRoom(r.Context(), id); err != nil {
+		if err == sql.ErrNoRows {
+			response.ErrorMessage(w, http.StatusNotFound, "Deleted room not found")
+			return
+		}
+		response.Error(w, r, err)
+		return
+	}
+
+	room, err := database.GetRoomByID(database.WithPrimary(r.Context()), id)
+	if err != nil {
+		response.Error(w, r, err)
+		return
+	}
+
+	setETag(w, room.Version)
+	response.OK(w, room)
+}
+
+// PatchRoom applies a JSON Merge Patch, changing only the fields present in the body
+func PatchRoom(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	expected, err := ifMatchVersion(r)
+	if err != nil {
+		response.ErrorMessage(w, http.StatusBadRequest, "Invalid If-Match header")
+		return
+	}
+
+	room, err := database.GetRoomByID(database.WithPrimary(r.Context()), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.ErrorMessage(w, http.StatusNotFound, "Room not found")
+			return
+		}
+		response.Error(w, r, err)
+		return
+	}
+
+	if err := applyMergePatch(r, room, "occupancy"); err != nil {
+		patchError(w, r, err)
+		return
+	}
+
+	// If-Match wins; otherwise the version read above guards against concurrent edits
+	if expected != 0 {
+		room.Version = expected
+	}
+
+	if err := validation.Room(room); err != nil {
+		response.Error(w, r, err)
 		return
 	}
 
-	if err := database.DeleteRoom(id); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := database.UpdateRoom(r.Context(), id, room); err != nil {
+		response.Error(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	setETag(w, room.Version)
+	response.OK(w, room)
 }
@@ -0,0 +1,362 @@
+// Package importer loads rooms and guests in bulk from CSV or XLSX files. Rows are
+// upserted by room number / guest email, each inside its own savepoint so one bad
+// row is reported without hiding errors in the rows after it.
+package importer
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"pg-management-system/internal/database"
+	"pg-management-system/internal/models"
+	"pg-management-system/internal/response"
+	"pg-management-system/internal/validation"
+	"pg-management-system/internal/xlsx"
+)
+
+// Supported entity kinds
+const (
+	KindRooms  = "rooms"
+	KindGuests = "guests"
+)
+
+// Supported file formats
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+// MaxFileSize bounds how much of an upload is read
+const MaxFileSize = 20 << 20
+
+// ErrTooLarge is returned for files over MaxFileSize
+var ErrTooLarge = fmt.Errorf("file is larger than %d MB", MaxFileSize>>20)
+
+// ErrInvalidFile wraps problems with the file itself, as opposed to database failures
+var ErrInvalidFile = errors.New("invalid import file")
+
+var errRollback = errors.New("import rolled back")
+
+// Options control how an import is applied
+type Options struct {
+	Kind string
+	// DryRun validates and applies every row, then rolls everything back
+	DryRun bool
+	// Partial commits the valid rows even when others fail. By default a single
+	// failing row rolls back the whole import.
+	Partial bool
+}
+
+// RowError describes why one row could not be imported. Row numbers match the
+// file, with the header on row 1.
+type RowError struct {
+	Row     int                     `json:"row"`
+	Message string                  `json:"message"`
+	Fields  []validation.FieldError `json:"fields,omitempty"`
+}
+
+// Report summarises an import
+type Report struct {
+	Kind      string     `json:"kind"`
+	DryRun    bool       `json:"dry_run"`
+	Partial   bool       `json:"partial"`
+	Committed bool       `json:"committed"`
+	Total     int        `json:"total"`
+	Created   int        `json:"created"`
+	Updated   int        `json:"updated"`
+	Failed    int        `json:"failed"`
+	Errors    []RowError `json:"errors"`
+}
+
+// DetectFormat picks the file format from an explicit value, the file name or the content type
+func DetectFormat(explicit, filename, contentType string) (string, error) {
+	switch strings.ToLower(explicit) {
+	case FormatCSV, FormatXLSX:
+		return strings.ToLower(explicit), nil
+	case "":
+	default:
+		return "", fmt.Errorf("unsupported format %q", explicit)
+	}
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return FormatCSV, nil
+	case ".xlsx":
+		return FormatXLSX, nil
+	}
+	switch {
+	case strings.Contains(contentType, "spreadsheetml"):
+		return FormatXLSX, nil
+	case strings.Contains(contentType, "csv"), strings.HasPrefix(contentType, "text/plain"):
+		return FormatCSV, nil
+	}
+	return "", errors.New("cannot tell file format; pass format=csv or format=xlsx")
+}
+
+// ReadTable reads every row of a CSV or XLSX file
+func ReadTable(r io.Reader, format string) ([][]string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxFileSize {
+		return nil, ErrTooLarge
+	}
+
+	switch format {
+	case FormatXLSX:
+		return xlsx.ReadRows(bytes.NewReader(data), int64(len(data)))
+	case FormatCSV:
+		cr := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+		cr.FieldsPerRecord = -1
+		cr.TrimLeadingSpace = true
+		return cr.ReadAll()
+	}
+	return nil, fmt.Errorf("unsupported format %q", format)
+}
+
+// Run imports the table, whose first row must name the columns
+func Run(ctx context.Context, table [][]string, opts Options) (*Report, error) {
+	if len(table) == 0 {
+		return nil, fmt.Errorf("%w: file is empty", ErrInvalidFile)
+	}
+	cols := newColumns(table[0])
+
+	var importRow func(ctx context.Context, tx *sql.Tx, row record) (bool, error)
+	switch opts.Kind {
+	case KindRooms:
+		importRow = importRoom
+		if err := cols.require("room_number", "capacity", "price"); err != nil {
+			return nil, err
+		}
+	case KindGuests:
+		importRow = importGuest
+		if err := cols.require("name", "email"); err != nil {
+			return nil, err
+		}
+		if !cols.has("room_number") && !cols.has("room_id") {
+			return nil, fmt.Errorf("%w: missing column: room_number or room_id", ErrInvalidFile)
+		}
+	default:
+		return nil, fmt.Errorf("%w: cannot import %q; use rooms or guests", ErrInvalidFile, opts.Kind)
+	}
+
+	var report *Report
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		// A serialization failure or deadlock reruns this from the start
+		report = &Report{Kind: opts.Kind, DryRun: opts.DryRun, Partial: opts.Partial, Errors: []RowError{}}
+		for i, values := range table[1:] {
+			if blank(values) {
+				continue
+			}
+			report.Total++
+			rowNum := i + 2
+
+			var created bool
+			err := database.Savepoint(ctx, tx, "import_row", func() error {
+				var err error
+				created, err = importRow(ctx, tx, record{cols: cols, values: values})
+				return err
+			})
+			if err != nil {
+				report.Failed++
+				report.Errors = append(report.Errors, rowError(rowNum, err))
+				continue
+			}
+			if created {
+				report.Created++
+			} else {
+				report.Updated++
+			}
+		}
+
+		if opts.DryRun || (report.Failed > 0 && !opts.Partial) {
+			return errRollback
+		}
+		return nil
+	})
+	if err != nil && err != errRollback {
+		return nil, err
+	}
+	report.Committed = err == nil
+	return report, nil
+}
+
+func importRoom(ctx context.Context, tx *sql.Tx, row record) (bool, error) {
+	v := &fieldErrors{}
+	room := models.Room{
+		RoomNumber: row.get("room_number"),
+		Capacity:   v.int(row, "capacity"),
+		Price:      v.float(row, "price"),
+	}
+	if err := v.err(); err != nil {
+		return false, err
+	}
+	if err := validation.Room(&room); err != nil {
+		return false, err
+	}
+	return database.UpsertRoomTx(ctx, tx, &room)
+}
+
+func importGuest(ctx context.Context, tx *sql.Tx, row record) (bool, error) {
+	v := &fieldErrors{}
+	guest := models.Guest{
+		Name:  row.get("name"),
+		Email: row.get("email"),
+		Phone: row.get("phone"),
+	}
+	if number := row.get("room_number"); number != "" {
+		id, err := database.RoomIDByNumber(ctx, tx, number)
+		if err == sql.ErrNoRows {
+			v.add("room_number", "does not refer to an existing room")
+		} else if err != nil {
+			return false, err
+		}
+		guest.RoomID = id
+	} else {
+		guest.RoomID = v.int(row, "room_id")
+	}
+	guest.JoinDate = v.date(row, "join_date")
+	if err := v.err(); err != nil {
+		return false, err
+	}
+	if err := validation.GuestTx(ctx, tx, &guest); err != nil {
+		return false, err
+	}
+	return database.UpsertGuestTx(ctx, tx, &guest)
+}
+
+// rowError describes a failed row the way the API describes a failed request.
+// Errors it does not recognise are logged and reported without their text, which
+// may name tables, constraints or values from other rows.
+func rowError(row int, err error) RowError {
+	var vErr *validation.Error
+	if errors.As(err, &vErr) {
+		return RowError{Row: row, Message: "invalid fields", Fields: vErr.Fields}
+	}
+	if p, ok := response.Classify(err); ok {
+		return RowError{Row: row, Message: p.Message, Fields: p.Fields}
+	}
+	log.Printf("import row %d: %v", row, err)
+	return RowError{Row: row, Message: "Row could not be saved"}
+}
+
+// columns maps normalised header names to their position
+type columns map[string]int
+
+func newColumns(header []string) columns {
+	cols := columns{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		name = strings.ReplaceAll(name, " ", "_")
+		if name != "" {
+			cols[name] = i
+		}
+	}
+	return cols
+}
+
+func (c columns) has(name string) bool {
+	_, ok := c[name]
+	return ok
+}
+
+func (c columns) require(names ...string) error {
+	var missing []string
+	for _, name := range names {
+		if !c.has(name) {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: missing column(s): %s", ErrInvalidFile, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+type record struct {
+	cols   columns
+	values []string
+}
+
+func (r record) get(name string) string {
+	i, ok := r.cols[name]
+	if !ok || i >= len(r.values) {
+		return ""
+	}
+	return strings.TrimSpace(r.values[i])
+}
+
+func blank(values []string) bool {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// fieldErrors collects parse failures in the same shape as validation errors
+type fieldErrors struct {
+	fields []validation.FieldError
+}
+
+func (f *fieldErrors) add(field, message string) {
+	f.fields = append(f.fields, validation.FieldError{Field: field, Message: message})
+}
+
+func (f *fieldErrors) err() error {
+	if len(f.fields) == 0 {
+		return nil
+	}
+	return &validation.Error{Fields: f.fields}
+}
+
+func (f *fieldErrors) float(row record, name string) float64 {
+	raw := row.get(name)
+	if raw == "" {
+		return 0
+	}
+	v, err := strconv.ParseFloat(strings.ReplaceAll(raw, ",", ""), 64)
+	if err != nil {
+		f.add(name, "must be a number")
+	}
+	return v
+}
+
+func (f *fieldErrors) int(row record, name string) int {
+	v := f.float(row, name)
+	if v != float64(int(v)) {
+		f.add(name, "must be a whole number")
+	}
+	return int(v)
+}
+
+// date accepts ISO dates, RFC 3339 timestamps and Excel date serials
+func (f *fieldErrors) date(row record, name string) time.Time {
+	raw := row.get(name)
+	if raw == "" {
+		return time.Time{}
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02", "2006-01-02 15:04:05"} {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return t
+		}
+	}
+	if serial, err := strconv.ParseFloat(raw, 64); err == nil && serial > 0 {
+		excelEpoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+		return excelEpoch.Add(time.Duration(serial * 24 * float64(time.Hour)))
+	}
+	f.add(name, "must be a date like 2026-01-31")
+	return time.Time{}
+}
@@ -0,0 +1,71 @@
+package importer
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"pg-management-system/internal/database"
+	"pg-management-system/internal/validation"
+
+	"github.com/lib/pq"
+)
+
+func TestRowErrorHidesDatabaseDetails(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		want   string
+		fields []validation.FieldError
+	}{
+		{
+			name:   "validation",
+			err:    &validation.Error{Fields: []validation.FieldError{{Field: "email", Message: "is required"}}},
+			want:   "invalid fields",
+			fields: []validation.FieldError{{Field: "email", Message: "is required"}},
+		},
+		{
+			name: "unique violation",
+			err: &pq.Error{Code: "23505", Table: "guests", Constraint: "guests_email_key",
+				Message: `duplicate key value violates unique constraint "guests_email_key"`, Detail: "Key (email_bidx)=(9f86d0) already exists."},
+			want:   "A record with this email already exists",
+			fields: []validation.FieldError{{Field: "email", Message: "already exists"}},
+		},
+		{
+			name: "foreign key violation",
+			err: &pq.Error{Code: "23503", Table: "guests", Constraint: "guests_room_id_fkey",
+				Message: `insert or update on table "guests" violates foreign key constraint "guests_room_id_fkey"`},
+			want:   "Referenced record does not exist or is still in use",
+			fields: []validation.FieldError{{Field: "room_id", Message: "invalid reference"}},
+		},
+		{
+			name: "room full",
+			err:  database.ErrRoomFull,
+			want: "Room is at full capacity",
+		},
+		{
+			name: "other database error",
+			err:  &pq.Error{Code: "42P01", Message: `relation "guests" does not exist`},
+			want: "Row could not be saved",
+		},
+		{
+			name: "anything else",
+			err:  errors.New("dial tcp 10.0.0.5:5432: connection refused"),
+			want: "Row could not be saved",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rowError(7, tt.err)
+			if got.Row != 7 || got.Message != tt.want || !reflect.DeepEqual(got.Fields, tt.fields) {
+				t.Errorf("rowError = %+v, want message %q and fields %v", got, tt.want, tt.fields)
+			}
+			for _, leak := range []string{"guests_", "relation", "10.0.0.5", "Key ("} {
+				if strings.Contains(got.Message, leak) {
+					t.Errorf("message %q leaks %q", got.Message, leak)
+				}
+			}
+		})
+	}
+}
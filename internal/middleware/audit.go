@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"pg-management-system/internal/database"
+	"pg-management-system/internal/handlers"
+)
+
+// AuditActor attributes mutations made during the request to the authenticated user.
+// It must run after AuthMiddleware.
+func AuditActor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := handlers.ClaimsFromContext(r.Context())
+		next.ServeHTTP(w, r.WithContext(database.WithActor(r.Context(), RequestActor(r, claims))))
+	})
+}
+
+// RequestActor describes who is making the request, for handlers that authenticate
+// without AuthMiddleware. claims may be nil.
+func RequestActor(r *http.Request, claims *handlers.Claims) database.Actor {
+	actor := database.Actor{IP: clientIP(r)}
+	if claims != nil {
+		actor.UserID = claims.UserID
+		actor.Email = claims.Email
+	}
+	return actor
+}
+
+// clientIP prefers the first X-Forwarded-For hop, falling back to the connection address
+func clientIP(r *http.Request) string {
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		return strings.TrimSpace(strings.Split(fwd, ",")[0])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http"
 	"pg-management-system/internal/handlers"
+	"pg-management-system/internal/response"
 	"strings"
 )
 
@@ -16,26 +17,30 @@ func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			http.Error(w, "Authorization header required", http.StatusUnauthorized)
+			response.ErrorMessage(w, http.StatusUnauthorized, "Authorization header required")
 			return
 		}
 
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			http.Error(w, "Invalid authorization header format", http.StatusUnauthorized)
+			response.ErrorMessage(w, http.StatusUnauthorized, "Invalid authorization header format")
 			return
 		}
 
 		tokenString := parts[1]
 		claims, err := handlers.ValidateToken(tokenString)
 		if err != nil {
-			http.Error(w, "Invalid or expired token. Please login again.", http.StatusUnauthorized)
+			response.ErrorMessage(w, http.StatusUnauthorized, "Invalid or expired token. Please login again.")
 			return
 		}
 
-		// Store email and full claims in context
-		ctx := context.WithValue(r.Context(), UserEmailKey, claims.Email)
-		ctx = context.WithValue(ctx, UserClaimsKey, claims)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		next.ServeHTTP(w, r.WithContext(WithClaims(r.Context(), claims)))
 	})
 }
+
+// WithClaims stores the authenticated user's email and full claims in ctx
+func WithClaims(ctx context.Context, claims *handlers.Claims) context.Context {
+	ctx = context.WithValue(ctx, UserEmailKey, claims.Email)
+	ctx = context.WithValue(ctx, UserClaimsKey, claims)
+	return handlers.ContextWithClaims(ctx, claims)
+}
@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"net/http"
+
+	"pg-management-system/internal/database"
+)
+
+// ReadYourWritesHeader lets a client ask for reads from the primary, e.g. right after a mutation
+const ReadYourWritesHeader = "X-Read-Your-Writes"
+
+// ReadYourWrites routes every read in the request to the primary when ReadYourWritesHeader is set
+func ReadYourWrites(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(ReadYourWritesHeader) != "" {
+			r = r.WithContext(database.WithPrimary(r.Context()))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"pg-management-system/internal/database"
+)
+
+// poolDriver counts the queries sent to each pool, named by its DSN; every query
+// finds nothing
+type poolDriver struct {
+	mu      sync.Mutex
+	queries map[string]int
+}
+
+var pools = &poolDriver{queries: map[string]int{}}
+
+func init() {
+	sql.Register("middleware-pools", pools)
+}
+
+func (d *poolDriver) Open(name string) (driver.Conn, error) { return poolConn{d, name}, nil }
+
+type poolConn struct {
+	d    *poolDriver
+	name string
+}
+
+func (c poolConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c poolConn) Close() error                        { return nil }
+func (c poolConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (c poolConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.queries[c.name]++
+	return emptyRows{}, nil
+}
+
+type emptyRows struct{}
+
+func (emptyRows) Columns() []string         { return nil }
+func (emptyRows) Close() error              { return nil }
+func (emptyRows) Next([]driver.Value) error { return io.EOF }
+
+func TestReadYourWrites(t *testing.T) {
+	primary, _ := sql.Open("middleware-pools", "primary")
+	replica, _ := sql.Open("middleware-pools", "replica")
+	prevDB, prevReplica := database.DB, database.Replica
+	database.DB, database.Replica = primary, replica
+	t.Cleanup(func() {
+		database.DB, database.Replica = prevDB, prevReplica
+		primary.Close()
+		replica.Close()
+	})
+
+	h := ReadYourWrites(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		database.GetRoomByID(r.Context(), 1)
+	}))
+
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{"without the header", "", "replica"},
+		{"with the header", "1", "primary"},
+		{"with any value", "true", "primary"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pools.mu.Lock()
+			pools.queries = map[string]int{}
+			pools.mu.Unlock()
+
+			req := httptest.NewRequest(http.MethodGet, "/api/rooms/1", nil)
+			if tt.header != "" {
+				req.Header.Set(ReadYourWritesHeader, tt.header)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), req)
+
+			pools.mu.Lock()
+			defer pools.mu.Unlock()
+			if pools.queries[tt.want] != 1 || len(pools.queries) != 1 {
+				t.Errorf("queries = %v, want one on the %s", pools.queries, tt.want)
+			}
+		})
+	}
+}
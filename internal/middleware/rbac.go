@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http"
 	"pg-management-system/internal/handlers"
+	"pg-management-system/internal/response"
 )
 
 const UserRoleKey contextKey = "user_role"
@@ -18,7 +19,7 @@ func RBAC(allowedRoles ...string) func(http.Handler) http.Handler {
 			// For now, let's assume we extract it from the token in the Authorization header
 			authHeader := r.Header.Get("Authorization")
 			if authHeader == "" {
-				http.Error(w, "Authorization header required", http.StatusUnauthorized)
+				response.ErrorMessage(w, http.StatusUnauthorized, "Authorization header required")
 				return
 			}
 
@@ -30,7 +31,7 @@ func RBAC(allowedRoles ...string) func(http.Handler) http.Handler {
 
 			claims, err := handlers.ValidateToken(tokenString)
 			if err != nil {
-				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				response.ErrorMessage(w, http.StatusUnauthorized, "Invalid token")
 				return
 			}
 
@@ -45,7 +46,7 @@ func RBAC(allowedRoles ...string) func(http.Handler) http.Handler {
 			}
 
 			if !isAllowed {
-				http.Error(w, "Forbidden: insufficient permissions", http.StatusForbidden)
+				response.ErrorMessage(w, http.StatusForbidden, "Forbidden: insufficient permissions")
 				return
 			}
 
@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+// Document types a guest's ID proof may be
+const (
+	DocumentAadhaar            = "aadhaar"
+	DocumentPassport           = "passport"
+	DocumentDrivingLicence     = "driving_licence"
+	DocumentVoterID            = "voter_id"
+	DocumentPAN                = "pan"
+	DocumentPoliceVerification = "police_verification"
+)
+
+// DocumentTypes lists every accepted document type
+var DocumentTypes = []string{
+	DocumentAadhaar,
+	DocumentPassport,
+	DocumentDrivingLicence,
+	DocumentVoterID,
+	DocumentPAN,
+	DocumentPoliceVerification,
+}
+
+// Verification statuses of a document
+const (
+	DocumentPending  = "pending"
+	DocumentVerified = "verified"
+	DocumentRejected = "rejected"
+)
+
+// GuestDocument is an ID proof kept for a guest. The file itself lives in the blob
+// store under StorageKey.
+type GuestDocument struct {
+	ID          int        `json:"id"`
+	GuestID     int        `json:"guest_id"`
+	Type        string     `json:"type"`
+	Number      string     `json:"number"`
+	Filename    string     `json:"filename"`
+	ContentType string     `json:"content_type"`
+	Size        int64      `json:"size"`
+	StorageKey  string     `json:"-"`
+	Status      string     `json:"status"`
+	Reason      string     `json:"rejection_reason,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	// Expired is set when the document is read, from ExpiresAt
+	Expired    bool       `json:"expired"`
+	UploadedBy string     `json:"uploaded_by"`
+	ReviewedBy string     `json:"reviewed_by,omitempty"`
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Version    int        `json:"version"`
+}
+
+// DocumentReview is a staff decision on a document
+type DocumentReview struct {
+	Status string `json:"status"`
+	// Reason is required when rejecting
+	Reason  string `json:"reason"`
+	Version int    `json:"version"`
+}
@@ -3,10 +3,13 @@ package models
 import "time"
 
 type Guest struct {
-	ID       int       `json:"id"`
-	Name     string    `json:"name"`
-	Email    string    `json:"email"`
-	Phone    string    `json:"phone"`
-	RoomID   int       `json:"room_id"`
-	JoinDate time.Time `json:"join_date"`
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	Email     string     `json:"email"`
+	Phone     string     `json:"phone"`
+	RoomID    int        `json:"room_id"`
+	JoinDate  time.Time  `json:"join_date"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	LeftAt    *time.Time `json:"left_at,omitempty"`
+	Version   int        `json:"version"`
 }
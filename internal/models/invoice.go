@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Invoice is one guest's rent statement for a calendar month
+type Invoice struct {
+	Number      string    `json:"number"`
+	GuestID     int       `json:"guest_id"`
+	GuestName   string    `json:"guest_name"`
+	GuestEmail  string    `json:"guest_email"`
+	RoomNumber  string    `json:"room_number"`
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+	Rent        float64   `json:"rent"`
+	Paid        float64   `json:"paid"`
+	Balance     float64   `json:"balance"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// PersistedQuery is a GraphQL document stored under the SHA-256 hash of its text
+type PersistedQuery struct {
+	Hash          string `json:"hash"`
+	Query         string `json:"query"`
+	OperationName string `json:"operation_name"`
+	// Allowlisted queries were registered ahead of time and may run in allowlist mode
+	Allowlisted bool      `json:"allowlisted"`
+	CreatedAt   time.Time `json:"created_at"`
+}
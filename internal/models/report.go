@@ -0,0 +1,9 @@
+package models
+
+// MonthlyPayments totals the payments received in one month by one payment method
+type MonthlyPayments struct {
+	Month         string  `json:"month"`
+	PaymentMethod string  `json:"payment_method"`
+	Payments      int     `json:"payments"`
+	Total         float64 `json:"total"`
+}
@@ -1,9 +1,13 @@
 package models
 
+import "time"
+
 type Room struct {
-	ID         int     `json:"id"`
-	RoomNumber string  `json:"room_number"`
-	Capacity   int     `json:"capacity"`
-	Occupancy  int     `json:"occupancy"`
-	Price      float64 `json:"price"`
+	ID         int        `json:"id"`
+	RoomNumber string     `json:"room_number"`
+	Capacity   int        `json:"capacity"`
+	Occupancy  int        `json:"occupancy"`
+	Price      float64    `json:"price"`
+	DeletedAt  *time.Time `json:"deleted_at,omitempty"`
+	Version    int        `json:"version"`
 }
@@ -0,0 +1,59 @@
+package pii
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// revealTo lists the roles that see a field in full; everyone else gets it masked.
+// Staff need guests' contact details at the front desk, but only admins handle
+// full ID numbers.
+var revealTo = map[string][]string{
+	GuestEmail:     {"admin", "staff"},
+	GuestPhone:     {"admin", "staff"},
+	DocumentNumber: {"admin"},
+}
+
+// Visible returns value as role may see it: in full, or masked
+func Visible(role, field, value string) string {
+	for _, r := range revealTo[field] {
+		if r == role {
+			return value
+		}
+	}
+	return Mask(field, value)
+}
+
+// Mask hides most of value while keeping enough to recognise it:
+// a***@example.com, ******3210, XXXXXXXX9012
+func Mask(field, value string) string {
+	if value == "" {
+		return ""
+	}
+	switch field {
+	case GuestEmail:
+		local, domain, ok := strings.Cut(value, "@")
+		if !ok || local == "" {
+			return "***"
+		}
+		_, first := utf8.DecodeRuneInString(local)
+		return local[:first] + "***@" + domain
+	case GuestPhone:
+		return keepLast(value, 4, '*')
+	default:
+		return keepLast(value, 4, 'X')
+	}
+}
+
+// keepLast replaces every character but the last n with pad, or all of them when
+// the value is too short to hide anything
+func keepLast(value string, n int, pad rune) string {
+	runes := []rune(value)
+	if len(runes) <= n*2 {
+		n = 0
+	}
+	for i := 0; i < len(runes)-n; i++ {
+		runes[i] = pad
+	}
+	return string(runes)
+}
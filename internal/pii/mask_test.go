@@ -0,0 +1,56 @@
+package pii
+
+import "testing"
+
+func TestMask(t *testing.T) {
+	tests := []struct {
+		field, value, want string
+	}{
+		{GuestEmail, "asha@example.com", "a***@example.com"},
+		{GuestEmail, "élodie@example.fr", "é***@example.fr"},
+		{GuestEmail, "鈴木@example.jp", "鈴***@example.jp"},
+		{GuestEmail, "not-an-email", "***"},
+		{GuestEmail, "@example.com", "***"},
+		{GuestPhone, "9876543210", "******3210"},
+		{GuestPhone, "+91 98765 43210", "***********3210"},
+		{GuestPhone, "12345", "*****"},
+		{DocumentNumber, "1234 5678 9012", "XXXXXXXXXX9012"},
+		{DocumentNumber, "A1234", "XXXXX"},
+		{GuestEmail, "", ""},
+	}
+	for _, tt := range tests {
+		if got := Mask(tt.field, tt.value); got != tt.want {
+			t.Errorf("Mask(%s, %q) = %q, want %q", tt.field, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestVisiblePerRole(t *testing.T) {
+	values := map[string]string{
+		GuestEmail:     "asha@example.com",
+		GuestPhone:     "9876543210",
+		DocumentNumber: "1234 5678 9012",
+	}
+	// Fields each role sees in full; the rest must be masked
+	full := map[string][]string{
+		"admin": {GuestEmail, GuestPhone, DocumentNumber},
+		"staff": {GuestEmail, GuestPhone},
+		"user":  {},
+		"":      {},
+	}
+	for role, fields := range full {
+		shown := map[string]bool{}
+		for _, field := range fields {
+			shown[field] = true
+		}
+		for field, value := range values {
+			got := Visible(role, field, value)
+			switch {
+			case shown[field] && got != value:
+				t.Errorf("%q sees %s as %q, want it in full", role, field, got)
+			case !shown[field] && got != Mask(field, value):
+				t.Errorf("%q sees %s as %q, want it masked", role, field, got)
+			}
+		}
+	}
+}
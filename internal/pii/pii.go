@@ -0,0 +1,264 @@
+// Package pii protects guests' personal data at rest and in responses.
+//
+// Values are encrypted with envelope encryption: each value gets its own random
+// data key, which encrypts it with AES-256-GCM and is itself encrypted ("wrapped")
+// with a master key from PII_KEYS. Rotating the master key only rewraps the data
+// keys. A stored value reads
+//
+//	enc:v1:<key id>:<wrapped data key>:<ciphertext>
+//
+// Values without the enc: prefix are plaintext written before encryption was
+// enabled; they are returned as-is and encrypted at the next startup.
+//
+// Encrypted values cannot be searched, so lookups and uniqueness go through a
+// blind index: an HMAC of the value under PII_INDEX_KEY. That key cannot be
+// rotated without recomputing every index.
+package pii
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Fields name the protected columns. A value is bound to its field when encrypted,
+// so it cannot be copied into another column and decrypted there.
+const (
+	GuestEmail     = "guests.email"
+	GuestPhone     = "guests.phone"
+	DocumentNumber = "guest_documents.doc_number"
+)
+
+const prefix = "enc:v1:"
+
+// ErrNotConfigured is returned when PII_KEYS or PII_INDEX_KEY is missing
+var ErrNotConfigured = errors.New("PII_KEYS and PII_INDEX_KEY must be set to store personal data")
+
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9-]{1,32}$`)
+
+// Keyring holds the master keys and the blind index key
+type Keyring struct {
+	active   string
+	masters  map[string]cipher.AEAD
+	indexKey []byte
+}
+
+// NewKeyring builds a keyring from master keys by id. New values are wrapped with
+// active; the others are kept to read values written before a rotation.
+func NewKeyring(active string, masters map[string][]byte, indexKey []byte) (*Keyring, error) {
+	k := &Keyring{active: active, masters: map[string]cipher.AEAD{}, indexKey: indexKey}
+	for id, key := range masters {
+		if !keyIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("invalid PII key id %q: use up to 32 letters, digits or '-'", id)
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("PII key %s: %w", id, err)
+		}
+		k.masters[id] = aead
+	}
+	if _, ok := k.masters[active]; !ok {
+		return nil, fmt.Errorf("active PII key %q is not in the keyring", active)
+	}
+	if len(indexKey) < 32 {
+		return nil, errors.New("PII_INDEX_KEY must be at least 32 bytes")
+	}
+	return k, nil
+}
+
+// FromEnv reads PII_KEYS, a comma-separated list of id:base64key pairs whose first
+// entry is the active key, and PII_INDEX_KEY, a base64 key. Keys are 32 bytes,
+// e.g. from `openssl rand -base64 32`.
+func FromEnv() (*Keyring, error) {
+	rawKeys, rawIndex := os.Getenv("PII_KEYS"), os.Getenv("PII_INDEX_KEY")
+	if rawKeys == "" || rawIndex == "" {
+		return nil, ErrNotConfigured
+	}
+
+	var active string
+	masters := map[string][]byte{}
+	for _, entry := range strings.Split(rawKeys, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok {
+			return nil, fmt.Errorf("PII_KEYS entry %q is not id:base64key", entry)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("PII key %s is not valid base64", id)
+		}
+		if _, dup := masters[id]; dup {
+			return nil, fmt.Errorf("PII key %s is listed twice", id)
+		}
+		if active == "" {
+			active = id
+		}
+		masters[id] = key
+	}
+	indexKey, err := base64.StdEncoding.DecodeString(rawIndex)
+	if err != nil {
+		return nil, errors.New("PII_INDEX_KEY is not valid base64")
+	}
+	return NewKeyring(active, masters, indexKey)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, errors.New("key must be 32 bytes")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// ActiveKey is the id of the master key new values are wrapped with
+func (k *Keyring) ActiveKey() string { return k.active }
+
+// Encrypt seals value for field. Empty values stay empty.
+func (k *Keyring) Encrypt(field, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	data, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	wrapped := seal(k.masters[k.active], dataKey, []byte(k.active))
+	sealed := seal(data, []byte(value), []byte(field))
+	return prefix + k.active + ":" + encode(wrapped) + ":" + encode(sealed), nil
+}
+
+// Decrypt opens a value sealed for field. Plaintext values are returned unchanged.
+func (k *Keyring) Decrypt(field, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	id, dataKey, sealed, err := k.open(value)
+	if err != nil {
+		return "", err
+	}
+	data, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plain, err := unseal(data, sealed, []byte(field))
+	if err != nil {
+		return "", fmt.Errorf("cannot decrypt %s value under key %s: %w", field, id, err)
+	}
+	return string(plain), nil
+}
+
+// Rewrap moves a sealed value to the active master key without touching its
+// ciphertext, and encrypts plaintext values. It reports whether value changed.
+func (k *Keyring) Rewrap(field, value string) (string, bool, error) {
+	if !IsEncrypted(value) {
+		if value == "" {
+			return value, false, nil
+		}
+		sealed, err := k.Encrypt(field, value)
+		return sealed, err == nil, err
+	}
+	if KeyID(value) == k.active {
+		return value, false, nil
+	}
+	_, dataKey, sealed, err := k.open(value)
+	if err != nil {
+		return "", false, err
+	}
+	wrapped := seal(k.masters[k.active], dataKey, []byte(k.active))
+	return prefix + k.active + ":" + encode(wrapped) + ":" + encode(sealed), true, nil
+}
+
+// open unwraps the data key of a sealed value
+func (k *Keyring) open(value string) (id string, dataKey, sealed []byte, err error) {
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, errors.New("malformed encrypted value")
+	}
+	id = parts[0]
+	master, ok := k.masters[id]
+	if !ok {
+		return "", nil, nil, fmt.Errorf("value is encrypted with PII key %s, which is not in PII_KEYS", id)
+	}
+	wrapped, err := decode(parts[1])
+	if err == nil {
+		sealed, err = decode(parts[2])
+	}
+	if err != nil {
+		return "", nil, nil, errors.New("malformed encrypted value")
+	}
+	if dataKey, err = unseal(master, wrapped, []byte(id)); err != nil {
+		return "", nil, nil, fmt.Errorf("cannot unwrap data key with PII key %s: %w", id, err)
+	}
+	return id, dataKey, sealed, nil
+}
+
+// Index returns the blind index of value for field. Values equal up to surrounding
+// spaces get equal indexes; case is kept, as the plaintext unique constraint did.
+func (k *Keyring) Index(field, value string) string {
+	mac := hmac.New(sha256.New, k.indexKey)
+	mac.Write([]byte(field))
+	mac.Write([]byte{0})
+	mac.Write([]byte(strings.TrimSpace(value)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// IsEncrypted reports whether a stored value is sealed
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// KeyID returns the master key a stored value is wrapped with, or "" for plaintext
+func KeyID(value string) string {
+	if !IsEncrypted(value) {
+		return ""
+	}
+	id, _, _ := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	return id
+}
+
+func seal(aead cipher.AEAD, plain, aad []byte) []byte {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plain)+aead.Overhead())
+	rand.Read(nonce)
+	return aead.Seal(nonce, nonce, plain, aad)
+}
+
+func unseal(aead cipher.AEAD, sealed, aad []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], aad)
+}
+
+func encode(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+func decode(s string) ([]byte, error) { return base64.RawURLEncoding.DecodeString(s) }
+
+var (
+	defaultOnce sync.Once
+	defaultRing *Keyring
+	defaultErr  error
+)
+
+// Default returns the keyring configured by the environment, read on first use
+func Default() (*Keyring, error) {
+	defaultOnce.Do(func() {
+		defaultRing, defaultErr = FromEnv()
+	})
+	return defaultRing, defaultErr
+}
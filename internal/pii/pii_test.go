@@ -0,0 +1,151 @@
+package pii
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func testKeyring(t *testing.T, active string, ids ...string) *Keyring {
+	t.Helper()
+	masters := map[string][]byte{}
+	for _, id := range ids {
+		masters[id] = bytes.Repeat([]byte(id[:1]), 32)
+	}
+	k, err := NewKeyring(active, masters, bytes.Repeat([]byte("i"), 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestEncryptDecryptRoundTrip(t *testing.T) {
+	k := testKeyring(t, "a1", "a1")
+
+	for _, value := range []string{"asha@example.com", "+91 98765 43210", "Ünïcødé ✓"} {
+		sealed, err := k.Encrypt(GuestEmail, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsEncrypted(sealed) || KeyID(sealed) != "a1" || strings.Contains(sealed, value) {
+			t.Errorf("Encrypt(%q) = %q", value, sealed)
+		}
+		again, _ := k.Encrypt(GuestEmail, value)
+		if again == sealed {
+			t.Error("two encryptions of one value are equal")
+		}
+		if got, err := k.Decrypt(GuestEmail, sealed); err != nil || got != value {
+			t.Errorf("Decrypt = %q, %v, want %q", got, err, value)
+		}
+		// A value is bound to its column
+		if _, err := k.Decrypt(GuestPhone, sealed); err == nil {
+			t.Error("an email decrypted as a phone")
+		}
+	}
+
+	if sealed, err := k.Encrypt(GuestEmail, ""); err != nil || sealed != "" {
+		t.Errorf("Encrypt(\"\") = %q, %v", sealed, err)
+	}
+	if got, err := k.Decrypt(GuestEmail, "plain@example.com"); err != nil || got != "plain@example.com" {
+		t.Errorf("plaintext Decrypt = %q, %v", got, err)
+	}
+	if _, err := k.Decrypt(GuestEmail, "enc:v1:a1:broken"); err == nil {
+		t.Error("malformed value decrypted")
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	old := testKeyring(t, "a1", "a1")
+	sealed, err := old.Encrypt(GuestPhone, "9876543210")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The new key is active and the old one still decrypts
+	rotated := testKeyring(t, "b2", "b2", "a1")
+	if got, err := rotated.Decrypt(GuestPhone, sealed); err != nil || got != "9876543210" {
+		t.Fatalf("Decrypt after rotation = %q, %v", got, err)
+	}
+	rewrapped, changed, err := rotated.Rewrap(GuestPhone, sealed)
+	if err != nil || !changed || KeyID(rewrapped) != "b2" {
+		t.Fatalf("Rewrap = %q, %v, %v", rewrapped, changed, err)
+	}
+	// Only the data key is rewrapped; the ciphertext stays
+	if sealed[strings.LastIndex(sealed, ":"):] != rewrapped[strings.LastIndex(rewrapped, ":"):] {
+		t.Error("Rewrap changed the ciphertext")
+	}
+	if _, changed, _ := rotated.Rewrap(GuestPhone, rewrapped); changed {
+		t.Error("Rewrap changed a value already under the active key")
+	}
+
+	// Once the old key is dropped, only rewrapped values can be read
+	retired := testKeyring(t, "b2", "b2")
+	if got, err := retired.Decrypt(GuestPhone, rewrapped); err != nil || got != "9876543210" {
+		t.Errorf("Decrypt with the old key retired = %q, %v", got, err)
+	}
+	if _, err := retired.Decrypt(GuestPhone, sealed); err == nil || !strings.Contains(err.Error(), "a1") {
+		t.Errorf("Decrypt under a dropped key: %v", err)
+	}
+
+	// Plaintext is encrypted by Rewrap
+	if sealed, changed, err := rotated.Rewrap(GuestPhone, "9123456789"); err != nil || !changed || KeyID(sealed) != "b2" {
+		t.Errorf("Rewrap of plaintext = %q, %v, %v", sealed, changed, err)
+	}
+}
+
+func TestBlindIndex(t *testing.T) {
+	k := testKeyring(t, "a1", "a1")
+
+	index := k.Index(GuestEmail, "asha@example.com")
+	if len(index) != 64 {
+		t.Fatalf("index %q is not a hex SHA-256", index)
+	}
+	if k.Index(GuestEmail, "  asha@example.com ") != index {
+		t.Error("surrounding spaces change the index")
+	}
+	if k.Index(GuestEmail, "Asha@example.com") == index {
+		t.Error("case is ignored, unlike the plaintext constraint")
+	}
+	if k.Index(GuestPhone, "asha@example.com") == index {
+		t.Error("indexes of different fields match")
+	}
+
+	// Rotating master keys keeps indexes; only PII_INDEX_KEY changes them
+	if testKeyring(t, "b2", "b2", "a1").Index(GuestEmail, "asha@example.com") != index {
+		t.Error("the index depends on the master key")
+	}
+	other, err := NewKeyring("a1", map[string][]byte{"a1": bytes.Repeat([]byte("a"), 32)}, bytes.Repeat([]byte("j"), 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Index(GuestEmail, "asha@example.com") == index {
+		t.Error("the index ignores PII_INDEX_KEY")
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	key := "YWFhYWFhYWFhYWFhYWFhYWFhYWFhYWFhYWFhYWFhYWE=" // 32 bytes of "a"
+	t.Setenv("PII_KEYS", "new:"+key+", old:"+key)
+	t.Setenv("PII_INDEX_KEY", key)
+	k, err := FromEnv()
+	if err != nil || k.ActiveKey() != "new" {
+		t.Fatalf("FromEnv = %v, %v", k, err)
+	}
+
+	for name, keys := range map[string]string{
+		"missing colon": "new" + key,
+		"bad id":        "n/w:" + key,
+		"short key":     "new:YWFh",
+		"listed twice":  "new:" + key + ",new:" + key,
+	} {
+		t.Setenv("PII_KEYS", keys)
+		if _, err := FromEnv(); err == nil {
+			t.Errorf("%s: FromEnv accepted %q", name, keys)
+		}
+	}
+
+	t.Setenv("PII_INDEX_KEY", "")
+	if _, err := FromEnv(); err != ErrNotConfigured {
+		t.Errorf("FromEnv without an index key = %v", err)
+	}
+}
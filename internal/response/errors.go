@@ -0,0 +1,181 @@
+package response
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"pg-management-system/internal/database"
+	"pg-management-system/internal/validation"
+
+	"github.com/lib/pq"
+)
+
+// errorBody is the JSON envelope returned for every API error
+type errorBody struct {
+	Error Problem `json:"error"`
+}
+
+// Problem is an error the client can act on, such as an invalid field or a conflict
+type Problem struct {
+	Status  int                     `json:"-"`
+	Code    string                  `json:"code"`
+	Message string                  `json:"message"`
+	Fields  []validation.FieldError `json:"fields,omitempty"`
+}
+
+var errorCodes = map[int]string{
+	http.StatusBadRequest:            "bad_request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusConflict:              "conflict",
+	http.StatusPreconditionFailed:    "precondition_failed",
+	http.StatusRequestEntityTooLarge: "too_large",
+	http.StatusUnsupportedMediaType:  "unsupported_media_type",
+	http.StatusUnprocessableEntity:   "unprocessable",
+	http.StatusServiceUnavailable:    "unavailable",
+	http.StatusGatewayTimeout:        "timeout",
+}
+
+// ErrorMessage sends an error envelope with a code derived from the status
+func ErrorMessage(w http.ResponseWriter, status int, message string) {
+	writeProblem(w, Problem{Status: status, Code: errorCode(status), Message: message})
+}
+
+func writeProblem(w http.ResponseWriter, p Problem) {
+	JSON(w, p.Status, errorBody{Error: p})
+}
+
+func errorCode(status int) string {
+	if code, ok := errorCodes[status]; ok {
+		return code
+	}
+	return "internal"
+}
+
+// Error classifies err and sends the matching envelope. Missing rows are 404s, while
+// unexpected failures are 500s whose details are logged rather than returned so
+// database internals never reach the client.
+func Error(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case r.Context().Err() != nil || database.IsCanceled(err):
+		ErrorMessage(w, http.StatusServiceUnavailable, "Request was cancelled")
+		return
+	case database.IsTimeout(err):
+		ErrorMessage(w, http.StatusGatewayTimeout, "Database did not respond in time")
+		return
+	}
+
+	if p, ok := Classify(err); ok {
+		writeProblem(w, p)
+		return
+	}
+
+	log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+	ErrorMessage(w, http.StatusInternalServerError, "Internal server error")
+}
+
+// Classify describes err as the Problem that Error reports for it. It returns false
+// for unexpected failures, which are reported only as internal errors.
+func Classify(err error) (Problem, bool) {
+	var vErr *validation.Error
+	if errors.As(err, &vErr) {
+		return Problem{
+			Status:  http.StatusBadRequest,
+			Code:    "validation_failed",
+			Message: "One or more fields are invalid",
+			Fields:  vErr.Fields,
+		}, true
+	}
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return problem(http.StatusNotFound, "Record not found"), true
+	case errors.Is(err, database.ErrRoomFull), errors.Is(err, database.ErrRoomOccupied), errors.Is(err, database.ErrGuestLeft):
+		return problem(http.StatusConflict, capitalize(err.Error())), true
+	case errors.Is(err, database.ErrCapacityBelowGuests):
+		return Problem{
+			Status:  http.StatusConflict,
+			Code:    "conflict",
+			Message: capitalize(err.Error()),
+			Fields:  []validation.FieldError{{Field: "capacity", Message: "is below the number of active guests"}},
+		}, true
+	case errors.Is(err, database.ErrRoomNotFound):
+		return Problem{
+			Status:  http.StatusUnprocessableEntity,
+			Code:    "unprocessable",
+			Message: "Room not found",
+			Fields:  []validation.FieldError{{Field: "room_id", Message: "does not refer to an existing room"}},
+		}, true
+	case errors.Is(err, database.ErrVersionConflict):
+		return problem(http.StatusPreconditionFailed, capitalize(err.Error())), true
+	}
+	return classifyPQError(err)
+}
+
+func problem(status int, message string) Problem {
+	return Problem{Status: status, Code: errorCode(status), Message: message}
+}
+
+// classifyPQError maps constraint violations to 409/422
+func classifyPQError(err error) (Problem, bool) {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return Problem{}, false
+	}
+	switch pqErr.Code.Class() {
+	case "23": // integrity_constraint_violation
+		field := constraintField(pqErr)
+		switch pqErr.Code {
+		case "23505": // unique_violation
+			return Problem{
+				Status:  http.StatusConflict,
+				Code:    "conflict",
+				Message: "A record with this " + field + " already exists",
+				Fields:  []validation.FieldError{{Field: field, Message: "already exists"}},
+			}, true
+		case "23503": // foreign_key_violation
+			return Problem{
+				Status:  http.StatusUnprocessableEntity,
+				Code:    "unprocessable",
+				Message: "Referenced record does not exist or is still in use",
+				Fields:  []validation.FieldError{{Field: field, Message: "invalid reference"}},
+			}, true
+		}
+		return Problem{
+			Status:  http.StatusUnprocessableEntity,
+			Code:    "unprocessable",
+			Message: "Value violates a data constraint",
+			Fields:  []validation.FieldError{{Field: field, Message: "is invalid"}},
+		}, true
+	case "22": // data_exception, e.g. value too long
+		return problem(http.StatusUnprocessableEntity, "Value is out of range or too long"), true
+	}
+	return Problem{}, false
+}
+
+// constraintField guesses the offending column from a Postgres constraint name
+// such as guests_email_key or payments_guest_id_fkey
+func constraintField(pqErr *pq.Error) string {
+	if pqErr.Column != "" {
+		return pqErr.Column
+	}
+	name := strings.TrimPrefix(pqErr.Constraint, pqErr.Table+"_")
+	for _, suffix := range []string{"_key", "_fkey", "_check"} {
+		name = strings.TrimSuffix(name, suffix)
+	}
+	if name == "" {
+		return "value"
+	}
+	return name
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,123 @@
+package response
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"pg-management-system/internal/database"
+	"pg-management-system/internal/validation"
+
+	"github.com/lib/pq"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+		fields []validation.FieldError
+	}{
+		{
+			name:   "unique violation",
+			err:    &pq.Error{Code: "23505", Table: "rooms", Constraint: "rooms_room_number_key"},
+			status: http.StatusConflict, code: "conflict",
+			fields: []validation.FieldError{{Field: "room_number", Message: "already exists"}},
+		},
+		{
+			name:   "foreign key violation",
+			err:    &pq.Error{Code: "23503", Table: "payments", Constraint: "payments_guest_id_fkey"},
+			status: http.StatusUnprocessableEntity, code: "unprocessable",
+			fields: []validation.FieldError{{Field: "guest_id", Message: "invalid reference"}},
+		},
+		{
+			name:   "check violation",
+			err:    &pq.Error{Code: "23514", Table: "rooms", Constraint: "rooms_capacity_check"},
+			status: http.StatusUnprocessableEntity, code: "unprocessable",
+			fields: []validation.FieldError{{Field: "capacity", Message: "is invalid"}},
+		},
+		{
+			name:   "value too long",
+			err:    &pq.Error{Code: "22001"},
+			status: http.StatusUnprocessableEntity, code: "unprocessable",
+		},
+		{
+			name:   "wrapped constraint violation",
+			err:    fmt.Errorf("creating guest: %w", &pq.Error{Code: "23505", Table: "guests", Column: "email_bidx"}),
+			status: http.StatusConflict, code: "conflict",
+			fields: []validation.FieldError{{Field: "email_bidx", Message: "already exists"}},
+		},
+		{
+			name:   "version conflict",
+			err:    database.ErrVersionConflict,
+			status: http.StatusPreconditionFailed, code: "precondition_failed",
+		},
+		{
+			name:   "no rows",
+			err:    sql.ErrNoRows,
+			status: http.StatusNotFound, code: "not_found",
+		},
+		{
+			name:   "wrapped no rows",
+			err:    fmt.Errorf("loading room: %w", sql.ErrNoRows),
+			status: http.StatusNotFound, code: "not_found",
+		},
+		{
+			name:   "validation",
+			err:    &validation.Error{Fields: []validation.FieldError{{Field: "price", Message: "must be greater than zero"}}},
+			status: http.StatusBadRequest, code: "validation_failed",
+			fields: []validation.FieldError{{Field: "price", Message: "must be greater than zero"}},
+		},
+		{
+			name:   "room full",
+			err:    database.ErrRoomFull,
+			status: http.StatusConflict, code: "conflict",
+		},
+		{
+			name:   "capacity below guests",
+			err:    database.ErrCapacityBelowGuests,
+			status: http.StatusConflict, code: "conflict",
+			fields: []validation.FieldError{{Field: "capacity", Message: "is below the number of active guests"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, ok := Classify(tt.err)
+			if !ok {
+				t.Fatal("not classified")
+			}
+			if p.Status != tt.status || p.Code != tt.code || !reflect.DeepEqual(p.Fields, tt.fields) {
+				t.Errorf("got %d %s %v, want %d %s %v", p.Status, p.Code, p.Fields, tt.status, tt.code, tt.fields)
+			}
+		})
+	}
+}
+
+func TestClassifyLeavesUnexpectedErrors(t *testing.T) {
+	for _, err := range []error{
+		errors.New("connection reset by peer"),
+		&pq.Error{Code: "42P01", Message: `relation "rooms" does not exist`},
+		&pq.Error{Code: "53300"},
+	} {
+		if p, ok := Classify(err); ok {
+			t.Errorf("%v classified as %+v", err, p)
+		}
+	}
+}
+
+func TestErrorHidesInternalDetails(t *testing.T) {
+	w := httptest.NewRecorder()
+	Error(w, httptest.NewRequest(http.MethodGet, "/api/rooms", nil), &pq.Error{Code: "42P01", Message: `relation "rooms" does not exist`})
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status %d, want 500", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "relation") {
+		t.Errorf("response leaks the database error: %s", w.Body)
+	}
+}
@@ -0,0 +1,39 @@
+// Package response writes every JSON body the API returns, so status codes,
+// headers and error envelopes are consistent across handlers.
+package response
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"reflect"
+)
+
+// JSON sends v with the given status. Headers are set before the status is written,
+// and a nil slice is sent as [] rather than null.
+func JSON(w http.ResponseWriter, status int, v any) {
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice && rv.IsNil() {
+		v = []struct{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// OK sends v with 200 OK
+func OK(w http.ResponseWriter, v any) {
+	JSON(w, http.StatusOK, v)
+}
+
+// Created sends v with 201 Created
+func Created(w http.ResponseWriter, v any) {
+	JSON(w, http.StatusCreated, v)
+}
+
+// NoContent sends an empty 204 response
+func NoContent(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusNoContent)
+}
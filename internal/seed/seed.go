@@ -0,0 +1,263 @@
+// Package seed generates realistic demo data from a fixed random seed, so every
+// developer who runs it against an empty database gets the same dataset.
+package seed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"pg-management-system/internal/database"
+	"pg-management-system/internal/models"
+)
+
+// ErrNotEmpty is returned when the database already has rooms
+var ErrNotEmpty = errors.New("database already has rooms; seed only runs against an empty database")
+
+// Defaults for Options fields left zero
+const (
+	DefaultSeed             = 42
+	DefaultProperties       = 3
+	DefaultRoomsPerProperty = 12
+)
+
+// DefaultUntil ends the generated history. It is fixed rather than "now" so the
+// dataset does not depend on the day it is generated.
+var DefaultUntil = time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Options shape the generated dataset
+type Options struct {
+	Seed             uint64
+	Properties       int
+	RoomsPerProperty int
+	// Until is the end of the year of history; guests still staying then are active
+	Until time.Time
+}
+
+func (o *Options) defaults() {
+	if o.Seed == 0 {
+		o.Seed = DefaultSeed
+	}
+	if o.Properties <= 0 {
+		o.Properties = DefaultProperties
+	}
+	if o.RoomsPerProperty <= 0 {
+		o.RoomsPerProperty = DefaultRoomsPerProperty
+	}
+	if o.Until.IsZero() {
+		o.Until = DefaultUntil
+	}
+}
+
+// Counts reports what was generated
+type Counts struct {
+	Properties   int `json:"properties"`
+	Rooms        int `json:"rooms"`
+	Guests       int `json:"guests"`
+	ActiveGuests int `json:"active_guests"`
+	Payments     int `json:"payments"`
+}
+
+// Run generates the dataset for opts and loads it into an empty database
+func Run(ctx context.Context, opts Options) (Counts, error) {
+	existing, err := database.GetAllRooms(ctx, database.ListFilter{IncludeDeleted: true})
+	if err != nil {
+		return Counts{}, err
+	}
+	if len(existing) > 0 {
+		return Counts{}, ErrNotEmpty
+	}
+
+	data, counts := Generate(opts)
+	if err := database.LoadSeed(ctx, data); err != nil {
+		return Counts{}, err
+	}
+	return counts, nil
+}
+
+// properties are the buildings rooms are spread across. The schema has no
+// property table, so each one is a room-number prefix, e.g. "MH-201".
+var properties = []struct{ name, code string }{
+	{"Maple House", "MH"},
+	{"Lotus Residency", "LR"},
+	{"Cedar Court", "CC"},
+	{"Banyan Nest", "BN"},
+	{"Orchid Stay", "OS"},
+	{"Jasmine Towers", "JT"},
+}
+
+// basePrice is the monthly rent per bed by room capacity
+var basePrice = map[int]float64{1: 12000, 2: 8500, 3: 7000, 4: 6000}
+
+var firstNames = []string{
+	"Aarav", "Aditi", "Akash", "Ananya", "Arjun", "Diya", "Farhan", "Gauri", "Ishaan", "Kabir",
+	"Kavya", "Meera", "Neha", "Nikhil", "Pooja", "Priya", "Rahul", "Riya", "Rohan", "Sana",
+	"Siddharth", "Sneha", "Tanvi", "Varun", "Vikram", "Zoya",
+}
+
+var lastNames = []string{
+	"Agarwal", "Bose", "Chopra", "Das", "Fernandes", "Gupta", "Iyer", "Joshi", "Khan", "Menon",
+	"Mehta", "Nair", "Patel", "Rao", "Reddy", "Sharma", "Singh", "Verma",
+}
+
+var paymentMethods = []struct {
+	name   string
+	weight int
+}{
+	{"UPI", 55},
+	{"Bank Transfer", 25},
+	{"Cash", 15},
+	{"Card", 5},
+}
+
+// Generate builds the dataset in memory. The same opts always produce the same data.
+func Generate(opts Options) (database.SeedData, Counts) {
+	opts.defaults()
+	rng := rand.New(rand.NewPCG(opts.Seed, opts.Seed^0x9e3779b97f4a7c15))
+	from := opts.Until.AddDate(-1, 0, 0)
+
+	g := generator{rng: rng, from: from, until: opts.Until, emails: map[string]int{}}
+	var data database.SeedData
+	counts := Counts{Properties: min(opts.Properties, len(properties))}
+
+	for p := 0; p < counts.Properties; p++ {
+		prop := properties[p]
+		for i := 0; i < opts.RoomsPerProperty; i++ {
+			floor, n := i/4+1, i%4+1
+			capacity := g.capacity()
+			room := models.Room{
+				RoomNumber: fmt.Sprintf("%s-%d%02d", prop.code, floor, n),
+				Capacity:   capacity,
+				// Up to 10% above the base rate, in steps of 50
+				Price: basePrice[capacity] + float64(rng.IntN(int(basePrice[capacity]/500)+1))*50,
+			}
+			roomIndex := len(data.Rooms)
+
+			for bed := 0; bed < capacity; bed++ {
+				if g.fillBed(&data, roomIndex, room.Price) {
+					room.Occupancy++
+				}
+			}
+			data.Rooms = append(data.Rooms, room)
+		}
+	}
+
+	counts.Rooms = len(data.Rooms)
+	counts.Guests = len(data.Guests)
+	counts.Payments = len(data.Payments)
+	for _, guest := range data.Guests {
+		if guest.DeletedAt == nil {
+			counts.ActiveGuests++
+		}
+	}
+	return data, counts
+}
+
+type generator struct {
+	rng         *rand.Rand
+	from, until time.Time
+	emails      map[string]int
+}
+
+// capacity favours double and triple sharing, like most PGs
+func (g *generator) capacity() int {
+	switch r := g.rng.IntN(10); {
+	case r < 2:
+		return 1
+	case r < 6:
+		return 2
+	case r < 9:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// fillBed lays out the residents of one bed over the year: some were there
+// before it began, each stays a few months, and beds stand empty for a while
+// between residents. It reports whether the bed is occupied at the end.
+func (g *generator) fillBed(data *database.SeedData, room int, price float64) bool {
+	// The first resident may have moved in up to a year before the window
+	join := g.from.AddDate(0, 0, -g.rng.IntN(365))
+	if g.rng.IntN(5) == 0 {
+		// Empty at the start; first resident arrives later
+		join = g.from.AddDate(0, 0, g.rng.IntN(120))
+	}
+
+	for join.Before(g.until) {
+		leave := join.AddDate(0, 3+g.rng.IntN(12), g.rng.IntN(28))
+		guestIndex := len(data.Guests)
+		guest := g.guest(room, join)
+		if leave.Before(g.until) {
+			// Hidden from current guests like a checkout, and marked as a past
+			// resident so it is never restored or purged
+			left := leave
+			guest.DeletedAt, guest.LeftAt = &left, &left
+		}
+		data.Guests = append(data.Guests, guest)
+		g.payments(data, guestIndex, join, leave, price)
+
+		if guest.DeletedAt == nil {
+			return true
+		}
+		// Vacant for up to six weeks before the next resident
+		join = leave.AddDate(0, 0, g.rng.IntN(45))
+	}
+	return false
+}
+
+func (g *generator) guest(room int, join time.Time) models.Guest {
+	first := firstNames[g.rng.IntN(len(firstNames))]
+	last := lastNames[g.rng.IntN(len(lastNames))]
+
+	local := strings.ToLower(first + "." + last)
+	g.emails[local]++
+	if n := g.emails[local]; n > 1 {
+		local = fmt.Sprintf("%s%d", local, n)
+	}
+
+	return models.Guest{
+		Name:     first + " " + last,
+		Email:    local + "@example.com",
+		Phone:    fmt.Sprintf("+91%d%09d", 7+g.rng.IntN(3), g.rng.IntN(1_000_000_000)),
+		RoomID:   room,
+		JoinDate: join,
+	}
+}
+
+// payments records monthly rent, due on the day the guest joined, for the part
+// of the stay inside the window. Most pay within a few days; a few months are missed.
+func (g *generator) payments(data *database.SeedData, guest int, join, leave time.Time, price float64) {
+	for due := join; due.Before(leave) && due.Before(g.until); due = due.AddDate(0, 1, 0) {
+		if due.Before(g.from) {
+			continue
+		}
+		if g.rng.IntN(25) == 0 {
+			continue
+		}
+		paid := due.AddDate(0, 0, g.rng.IntN(6)).Add(time.Duration(9+g.rng.IntN(12)) * time.Hour)
+		if !paid.Before(g.until) {
+			continue
+		}
+		data.Payments = append(data.Payments, models.Payment{
+			GuestID:       guest,
+			Amount:        price,
+			PaymentDate:   paid,
+			PaymentMethod: g.method(),
+		})
+	}
+}
+
+func (g *generator) method() string {
+	r := g.rng.IntN(100)
+	for _, m := range paymentMethods {
+		if r < m.weight {
+			return m.name
+		}
+		r -= m.weight
+	}
+	return paymentMethods[0].name
+}
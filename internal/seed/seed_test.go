@@ -0,0 +1,22 @@
+package seed
+
+import "testing"
+
+func TestDepartedGuestsAreMarkedAsLeft(t *testing.T) {
+	data, counts := Generate(Options{})
+	left := 0
+	for _, guest := range data.Guests {
+		if (guest.DeletedAt == nil) != (guest.LeftAt == nil) {
+			t.Fatalf("guest %s: deleted_at %v but left_at %v", guest.Email, guest.DeletedAt, guest.LeftAt)
+		}
+		if guest.LeftAt != nil {
+			left++
+			if !guest.LeftAt.After(guest.JoinDate) {
+				t.Errorf("guest %s left on %v before joining on %v", guest.Email, guest.LeftAt, guest.JoinDate)
+			}
+		}
+	}
+	if left == 0 || left+counts.ActiveGuests != counts.Guests {
+		t.Errorf("%d past residents and %d active of %d guests", left, counts.ActiveGuests, counts.Guests)
+	}
+}
@@ -0,0 +1,229 @@
+// Package validation checks models before they reach the database. REST handlers and
+// GraphQL resolvers share it so both reject the same input with the same messages.
+package validation
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"pg-management-system/internal/database"
+	"pg-management-system/internal/models"
+)
+
+// FieldError describes one invalid field
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error collects every invalid field of a model
+type Error struct {
+	Fields []FieldError
+}
+
+func (e *Error) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Field + ": " + f.Message
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+// Extensions exposes the field errors to GraphQL clients
+func (e *Error) Extensions() map[string]interface{} {
+	return map[string]interface{}{
+		"code":   "validation_failed",
+		"fields": e.Fields,
+	}
+}
+
+func (e *Error) add(field, format string, args ...any) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (e *Error) orNil() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+var phonePattern = regexp.MustCompile(`^\+?[0-9][0-9 -]{6,18}[0-9]$`)
+
+// Room checks a room's own fields
+func Room(room *models.Room) error {
+	v := &Error{}
+	room.RoomNumber = strings.TrimSpace(room.RoomNumber)
+	switch {
+	case room.RoomNumber == "":
+		v.add("room_number", "is required")
+	case len(room.RoomNumber) > 50:
+		v.add("room_number", "must be at most 50 characters")
+	}
+	if room.Capacity <= 0 {
+		v.add("capacity", "must be greater than zero")
+	}
+	if room.Price <= 0 {
+		v.add("price", "must be greater than zero")
+	}
+	return v.orNil()
+}
+
+// Guest checks a guest's fields and that their room exists. References are looked up
+// on the primary so a room created a moment ago is found.
+func Guest(ctx context.Context, guest *models.Guest) error {
+	return checkGuest(guest, func(id int) (bool, error) {
+		_, err := database.GetRoomByID(database.WithPrimary(ctx), id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return err == nil, err
+	})
+}
+
+// GuestTx is Guest for writes inside tx, which also sees rooms created earlier in
+// the transaction, such as by a bulk import
+func GuestTx(ctx context.Context, tx *sql.Tx, guest *models.Guest) error {
+	return checkGuest(guest, func(id int) (bool, error) {
+		return database.RoomExistsTx(ctx, tx, id)
+	})
+}
+
+func checkGuest(guest *models.Guest, roomExists func(id int) (bool, error)) error {
+	v := &Error{}
+	guest.Name = strings.TrimSpace(guest.Name)
+	switch {
+	case guest.Name == "":
+		v.add("name", "is required")
+	case len(guest.Name) > 100:
+		v.add("name", "must be at most 100 characters")
+	}
+
+	guest.Email = strings.TrimSpace(guest.Email)
+	if guest.Email == "" {
+		v.add("email", "is required")
+	} else if addr, err := mail.ParseAddress(guest.Email); err != nil || addr.Address != guest.Email || len(guest.Email) > 100 {
+		v.add("email", "must be a valid email address")
+	}
+
+	guest.Phone = strings.TrimSpace(guest.Phone)
+	if guest.Phone != "" && !phonePattern.MatchString(guest.Phone) {
+		v.add("phone", "must be 8 to 20 digits, optionally starting with +")
+	}
+
+	if guest.RoomID <= 0 {
+		v.add("room_id", "is required")
+	} else if ok, err := roomExists(guest.RoomID); err != nil {
+		return err
+	} else if !ok {
+		v.add("room_id", "does not refer to an existing room")
+	}
+	return v.orNil()
+}
+
+// Payment checks a payment's fields and that its guest exists
+func Payment(ctx context.Context, payment *models.Payment) error {
+	v := &Error{}
+	if payment.Amount <= 0 {
+		v.add("amount", "must be greater than zero")
+	} else if payment.Amount >= 1e8 {
+		v.add("amount", "is too large")
+	}
+
+	payment.PaymentMethod = strings.TrimSpace(payment.PaymentMethod)
+	switch {
+	case payment.PaymentMethod == "":
+		v.add("payment_method", "is required")
+	case len(payment.PaymentMethod) > 50:
+		v.add("payment_method", "must be at most 50 characters")
+	}
+
+	if payment.GuestID <= 0 {
+		v.add("guest_id", "is required")
+	} else if _, err := database.GetGuestByID(database.WithPrimary(ctx), payment.GuestID); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		v.add("guest_id", "does not refer to an existing guest")
+	}
+	return v.orNil()
+}
+
+var aadhaarPattern = regexp.MustCompile(`^[0-9]{12}$`)
+
+// Document checks a document's details and that its guest exists. The file itself
+// is checked when it is stored.
+func Document(ctx context.Context, doc *models.GuestDocument) error {
+	v := &Error{}
+	doc.Type = strings.TrimSpace(doc.Type)
+	if doc.Type == "" {
+		v.add("type", "is required")
+	} else if !slices.Contains(models.DocumentTypes, doc.Type) {
+		v.add("type", "must be one of %s", strings.Join(models.DocumentTypes, ", "))
+	}
+
+	doc.Number = strings.ToUpper(strings.Join(strings.Fields(doc.Number), ""))
+	switch {
+	case len(doc.Number) > 50:
+		v.add("number", "must be at most 50 characters")
+	case doc.Type == models.DocumentAadhaar && doc.Number != "" && !aadhaarPattern.MatchString(doc.Number):
+		v.add("number", "must be the 12 digits of the Aadhaar number")
+	}
+
+	if doc.ExpiresAt != nil && doc.ExpiresAt.Before(time.Now()) {
+		v.add("expires_at", "must be in the future")
+	}
+
+	if doc.GuestID <= 0 {
+		v.add("guest_id", "is required")
+	} else if _, err := database.GetGuestByID(database.WithPrimary(ctx), doc.GuestID); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		v.add("guest_id", "does not refer to an existing guest")
+	}
+	return v.orNil()
+}
+
+// DocumentReview checks a verification decision
+func DocumentReview(review *models.DocumentReview) error {
+	v := &Error{}
+	switch review.Status {
+	case models.DocumentPending, models.DocumentVerified, models.DocumentRejected:
+	case "":
+		v.add("status", "is required")
+	default:
+		v.add("status", "must be pending, verified or rejected")
+	}
+
+	review.Reason = strings.TrimSpace(review.Reason)
+	switch {
+	case review.Status == models.DocumentRejected && review.Reason == "":
+		v.add("reason", "is required when rejecting a document")
+	case len(review.Reason) > 500:
+		v.add("reason", "must be at most 500 characters")
+	}
+	return v.orNil()
+}
+
+// DocumentFile checks an uploaded file's size and the content type detected from
+// its first bytes
+func DocumentFile(size, maxSize int64, contentType string, allowed []string) error {
+	v := &Error{}
+	switch {
+	case size <= 0:
+		v.add("file", "is empty")
+	case size > maxSize:
+		v.add("file", "must be at most %d MB", maxSize>>20)
+	case !slices.Contains(allowed, contentType):
+		v.add("file", "must be a PDF, JPEG or PNG, not %s", contentType)
+	}
+	return v.orNil()
+}
@@ -0,0 +1,294 @@
+package validation
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"pg-management-system/internal/database"
+	"pg-management-system/internal/models"
+)
+
+// fakeDriver knows one room and one guest, both with id 1
+type fakeDriver struct{}
+
+func init() {
+	sql.Register("validation-fake", fakeDriver{})
+}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return fakeConn{}, nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (fakeConn) Close() error                        { return nil }
+func (fakeConn) Begin() (driver.Tx, error)           { return fakeConn{}, nil }
+func (fakeConn) Commit() error                       { return nil }
+func (fakeConn) Rollback() error                     { return nil }
+
+func (fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	exists := args[0].Value == int64(1)
+	rows := &fakeRows{}
+	switch {
+	case strings.Contains(query, "SELECT EXISTS"):
+		rows.cols = []string{"exists"}
+		rows.values = [][]driver.Value{{exists}}
+	case strings.Contains(query, "FROM rooms"):
+		rows.cols = []string{"id", "room_number", "capacity", "occupancy", "price", "deleted_at", "version"}
+		if exists {
+			rows.values = [][]driver.Value{{int64(1), "101", int64(2), int64(0), 5000.0, nil, int64(1)}}
+		}
+	case strings.Contains(query, "FROM guests"):
+		rows.cols = []string{"id", "name", "email", "phone", "room_id", "join_date", "deleted_at", "left_at", "version"}
+		if exists {
+			rows.values = [][]driver.Value{{int64(1), "Asha", "asha@example.com", "", int64(1), time.Now(), nil, nil, int64(1)}}
+		}
+	default:
+		return nil, fmt.Errorf("unexpected query %s", query)
+	}
+	return rows, nil
+}
+
+type fakeRows struct {
+	cols   []string
+	values [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.cols }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func useFakeDB(t *testing.T) {
+	t.Helper()
+	// Guests are read through the PII keyring, even though this one is plaintext
+	t.Setenv("PII_KEYS", "test:"+base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32))))
+	t.Setenv("PII_INDEX_KEY", base64.StdEncoding.EncodeToString([]byte(strings.Repeat("i", 32))))
+
+	db, err := sql.Open("validation-fake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prevDB, prevReplica := database.DB, database.Replica
+	database.DB, database.Replica = db, nil
+	t.Cleanup(func() {
+		database.DB, database.Replica = prevDB, prevReplica
+		db.Close()
+	})
+}
+
+// invalidFields lists the fields err rejects, or fails the test if err is not a
+// validation error
+func invalidFields(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var vErr *Error
+	if !errors.As(err, &vErr) {
+		t.Fatalf("err = %v, want a validation error", err)
+	}
+	var fields []string
+	for _, f := range vErr.Fields {
+		fields = append(fields, f.Field)
+	}
+	return fields
+}
+
+func TestRoom(t *testing.T) {
+	tests := []struct {
+		name string
+		room models.Room
+		want []string
+	}{
+		{"valid", models.Room{RoomNumber: "101", Capacity: 1, Price: 0.01}, nil},
+		{"room number of 50 characters", models.Room{RoomNumber: strings.Repeat("A", 50), Capacity: 1, Price: 1}, nil},
+		{"room number of 51 characters", models.Room{RoomNumber: strings.Repeat("A", 51), Capacity: 1, Price: 1}, []string{"room_number"}},
+		{"padding does not count", models.Room{RoomNumber: " " + strings.Repeat("A", 50) + " ", Capacity: 1, Price: 1}, nil},
+		{"blank room number", models.Room{RoomNumber: "   ", Capacity: 1, Price: 1}, []string{"room_number"}},
+		{"zero capacity", models.Room{RoomNumber: "101", Capacity: 0, Price: 1}, []string{"capacity"}},
+		{"negative capacity", models.Room{RoomNumber: "101", Capacity: -1, Price: 1}, []string{"capacity"}},
+		{"zero price", models.Room{RoomNumber: "101", Capacity: 1, Price: 0}, []string{"price"}},
+		{"everything wrong", models.Room{}, []string{"room_number", "capacity", "price"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := invalidFields(t, Room(&tt.room)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("invalid fields %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGuest(t *testing.T) {
+	useFakeDB(t)
+	valid := func(change func(*models.Guest)) models.Guest {
+		g := models.Guest{Name: "Asha", Email: "asha@example.com", Phone: "+91 98765 43210", RoomID: 1}
+		change(&g)
+		return g
+	}
+	tests := []struct {
+		name  string
+		guest models.Guest
+		want  []string
+	}{
+		{"valid", valid(func(g *models.Guest) {}), nil},
+		{"name of 100 characters", valid(func(g *models.Guest) { g.Name = strings.Repeat("a", 100) }), nil},
+		{"name of 101 characters", valid(func(g *models.Guest) { g.Name = strings.Repeat("a", 101) }), []string{"name"}},
+		{"blank name", valid(func(g *models.Guest) { g.Name = " " }), []string{"name"}},
+		{"email of 100 characters", valid(func(g *models.Guest) { g.Email = strings.Repeat("a", 88) + "@example.com" }), nil},
+		{"email of 101 characters", valid(func(g *models.Guest) { g.Email = strings.Repeat("a", 89) + "@example.com" }), []string{"email"}},
+		{"email with a display name", valid(func(g *models.Guest) { g.Email = "Asha <asha@example.com>" }), []string{"email"}},
+		{"email without a domain", valid(func(g *models.Guest) { g.Email = "asha" }), []string{"email"}},
+		{"missing email", valid(func(g *models.Guest) { g.Email = "" }), []string{"email"}},
+		{"no phone", valid(func(g *models.Guest) { g.Phone = "" }), nil},
+		{"phone of 8 digits", valid(func(g *models.Guest) { g.Phone = "12345678" }), nil},
+		{"phone of 7 digits", valid(func(g *models.Guest) { g.Phone = "1234567" }), []string{"phone"}},
+		{"phone of 20 digits", valid(func(g *models.Guest) { g.Phone = strings.Repeat("9", 20) }), nil},
+		{"phone of 21 digits", valid(func(g *models.Guest) { g.Phone = strings.Repeat("9", 21) }), []string{"phone"}},
+		{"phone with letters", valid(func(g *models.Guest) { g.Phone = "98765 ABCDE" }), []string{"phone"}},
+		{"no room", valid(func(g *models.Guest) { g.RoomID = 0 }), []string{"room_id"}},
+		{"unknown room", valid(func(g *models.Guest) { g.RoomID = 2 }), []string{"room_id"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			guest := tt.guest
+			if got := invalidFields(t, Guest(ctx, &guest)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Guest: invalid fields %v, want %v", got, tt.want)
+			}
+
+			// GuestTx applies the same rules, looking the room up inside the transaction
+			tx, err := database.DB.BeginTx(ctx, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tx.Rollback()
+			guest = tt.guest
+			if got := invalidFields(t, GuestTx(ctx, tx, &guest)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GuestTx: invalid fields %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPayment(t *testing.T) {
+	useFakeDB(t)
+	tests := []struct {
+		name    string
+		payment models.Payment
+		want    []string
+	}{
+		{"valid", models.Payment{GuestID: 1, Amount: 0.01, PaymentMethod: "UPI"}, nil},
+		{"largest amount", models.Payment{GuestID: 1, Amount: 99999999.99, PaymentMethod: "UPI"}, nil},
+		{"amount too large", models.Payment{GuestID: 1, Amount: 1e8, PaymentMethod: "UPI"}, []string{"amount"}},
+		{"zero amount", models.Payment{GuestID: 1, Amount: 0, PaymentMethod: "UPI"}, []string{"amount"}},
+		{"negative amount", models.Payment{GuestID: 1, Amount: -5, PaymentMethod: "UPI"}, []string{"amount"}},
+		{"method of 50 characters", models.Payment{GuestID: 1, Amount: 1, PaymentMethod: strings.Repeat("m", 50)}, nil},
+		{"method of 51 characters", models.Payment{GuestID: 1, Amount: 1, PaymentMethod: strings.Repeat("m", 51)}, []string{"payment_method"}},
+		{"blank method", models.Payment{GuestID: 1, Amount: 1, PaymentMethod: "  "}, []string{"payment_method"}},
+		{"no guest", models.Payment{Amount: 1, PaymentMethod: "UPI"}, []string{"guest_id"}},
+		{"unknown guest", models.Payment{GuestID: 2, Amount: 1, PaymentMethod: "UPI"}, []string{"guest_id"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := invalidFields(t, Payment(context.Background(), &tt.payment)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("invalid fields %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocument(t *testing.T) {
+	useFakeDB(t)
+	past, future := time.Now().Add(-time.Hour), time.Now().Add(24*time.Hour)
+	tests := []struct {
+		name string
+		doc  models.GuestDocument
+		want []string
+	}{
+		{"valid", models.GuestDocument{GuestID: 1, Type: models.DocumentPassport, Number: "K1234567"}, nil},
+		{"Aadhaar with spaces", models.GuestDocument{GuestID: 1, Type: models.DocumentAadhaar, Number: "1234 5678 9012"}, nil},
+		{"Aadhaar of 11 digits", models.GuestDocument{GuestID: 1, Type: models.DocumentAadhaar, Number: "12345678901"}, []string{"number"}},
+		{"Aadhaar of 13 digits", models.GuestDocument{GuestID: 1, Type: models.DocumentAadhaar, Number: "1234567890123"}, []string{"number"}},
+		{"Aadhaar without a number", models.GuestDocument{GuestID: 1, Type: models.DocumentAadhaar}, nil},
+		{"number of 50 characters", models.GuestDocument{GuestID: 1, Type: models.DocumentPassport, Number: strings.Repeat("K", 50)}, nil},
+		{"number of 51 characters", models.GuestDocument{GuestID: 1, Type: models.DocumentPassport, Number: strings.Repeat("K", 51)}, []string{"number"}},
+		{"missing type", models.GuestDocument{GuestID: 1}, []string{"type"}},
+		{"unknown type", models.GuestDocument{GuestID: 1, Type: "library_card"}, []string{"type"}},
+		{"expired", models.GuestDocument{GuestID: 1, Type: models.DocumentPassport, ExpiresAt: &past}, []string{"expires_at"}},
+		{"expires later", models.GuestDocument{GuestID: 1, Type: models.DocumentPassport, ExpiresAt: &future}, nil},
+		{"no guest", models.GuestDocument{Type: models.DocumentPassport}, []string{"guest_id"}},
+		{"unknown guest", models.GuestDocument{GuestID: 2, Type: models.DocumentPassport}, []string{"guest_id"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := invalidFields(t, Document(context.Background(), &tt.doc)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("invalid fields %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocumentReview(t *testing.T) {
+	tests := []struct {
+		name   string
+		review models.DocumentReview
+		want   []string
+	}{
+		{"verified", models.DocumentReview{Status: models.DocumentVerified}, nil},
+		{"back to pending", models.DocumentReview{Status: models.DocumentPending}, nil},
+		{"rejected with a reason", models.DocumentReview{Status: models.DocumentRejected, Reason: "blurred"}, nil},
+		{"rejected without a reason", models.DocumentReview{Status: models.DocumentRejected, Reason: "  "}, []string{"reason"}},
+		{"reason of 500 characters", models.DocumentReview{Status: models.DocumentRejected, Reason: strings.Repeat("r", 500)}, nil},
+		{"reason of 501 characters", models.DocumentReview{Status: models.DocumentRejected, Reason: strings.Repeat("r", 501)}, []string{"reason"}},
+		{"missing status", models.DocumentReview{}, []string{"status"}},
+		{"unknown status", models.DocumentReview{Status: "approved"}, []string{"status"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := invalidFields(t, DocumentReview(&tt.review)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("invalid fields %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocumentFile(t *testing.T) {
+	const maxSize = 5 << 20
+	allowed := []string{"application/pdf", "image/jpeg", "image/png"}
+	tests := []struct {
+		name        string
+		size        int64
+		contentType string
+		want        []string
+	}{
+		{"one byte", 1, "application/pdf", nil},
+		{"at the limit", maxSize, "image/png", nil},
+		{"one byte over", maxSize + 1, "image/png", []string{"file"}},
+		{"empty", 0, "application/pdf", []string{"file"}},
+		{"other content", 100, "text/html; charset=utf-8", []string{"file"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := invalidFields(t, DocumentFile(tt.size, maxSize, tt.contentType, allowed)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("invalid fields %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,290 @@
+// Package xlsx reads and writes the subset of Office Open XML spreadsheets the API
+// needs: a single sheet of plain values, without styles or formulas.
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Limits of the Excel file format. Sheets claiming more rows or columns are
+// rejected before anything is allocated for them.
+const (
+	maxRows    = 1 << 20
+	maxColumns = 1 << 14
+)
+
+// maxPartSize bounds how much a single part of the zip may inflate to, and
+// maxCells the number of cells a sheet may hold once padded to column
+// positions, so a small upload cannot expand into gigabytes
+var (
+	maxPartSize int64 = 256 << 20
+	maxCells          = 10_000_000
+)
+
+// ReadRows returns the values of the workbook's first sheet, one slice per row.
+// Rows are padded so cells keep their column position.
+func ReadRows(r io.ReaderAt, size int64) ([][]string, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("not an xlsx file: %w", err)
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	sheetPath, err := firstSheetPath(files)
+	if err != nil {
+		return nil, err
+	}
+
+	var shared []string
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		if shared, err = readSharedStrings(f); err != nil {
+			return nil, err
+		}
+	}
+
+	f, ok := files[sheetPath]
+	if !ok {
+		return nil, fmt.Errorf("worksheet %s missing", sheetPath)
+	}
+	return readSheet(f, shared)
+}
+
+// firstSheetPath follows workbook.xml and its relationships to the first sheet
+func firstSheetPath(files map[string]*zip.File) (string, error) {
+	var workbook struct {
+		Sheets []struct {
+			RID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+
+	if err := decodeFile(files["xl/workbook.xml"], &workbook); err != nil {
+		return "", fmt.Errorf("reading workbook: %w", err)
+	}
+	if len(workbook.Sheets) == 0 {
+		return "", errors.New("workbook has no sheets")
+	}
+	if err := decodeFile(files["xl/_rels/workbook.xml.rels"], &rels); err != nil {
+		return "", fmt.Errorf("reading workbook relationships: %w", err)
+	}
+
+	for _, rel := range rels.Relationships {
+		if rel.ID == workbook.Sheets[0].RID {
+			if strings.HasPrefix(rel.Target, "/") {
+				return strings.TrimPrefix(rel.Target, "/"), nil
+			}
+			return path.Join("xl", rel.Target), nil
+		}
+	}
+	return "", errors.New("first sheet not found in relationships")
+}
+
+func decodeFile(f *zip.File, v any) error {
+	if f == nil {
+		return errors.New("part missing")
+	}
+	rc, err := openPart(f)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(rc).Decode(v)
+}
+
+// openPart opens a zip entry, refusing to inflate it past maxPartSize whatever
+// size its header claims
+func openPart(f *zip.File) (io.ReadCloser, error) {
+	if f.UncompressedSize64 > uint64(maxPartSize) {
+		return nil, fmt.Errorf("%s is larger than %d MB", f.Name, maxPartSize>>20)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	return &partReader{Reader: io.LimitReader(rc, maxPartSize+1), closer: rc, name: f.Name}, nil
+}
+
+type partReader struct {
+	io.Reader
+	closer io.Closer
+	name   string
+	read   int64
+}
+
+func (p *partReader) Read(b []byte) (int, error) {
+	n, err := p.Reader.Read(b)
+	p.read += int64(n)
+	if p.read > maxPartSize {
+		return n, fmt.Errorf("%s is larger than %d MB", p.name, maxPartSize>>20)
+	}
+	return n, err
+}
+
+func (p *partReader) Close() error { return p.closer.Close() }
+
+// richText covers both plain <t> and run-formatted <r><t> strings
+type richText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (rt richText) String() string {
+	if len(rt.Runs) == 0 {
+		return rt.T
+	}
+	var b strings.Builder
+	for _, r := range rt.Runs {
+		b.WriteString(r.T)
+	}
+	return b.String()
+}
+
+func readSharedStrings(f *zip.File) ([]string, error) {
+	var sst struct {
+		Items []richText `xml:"si"`
+	}
+	if err := decodeFile(f, &sst); err != nil {
+		return nil, fmt.Errorf("reading shared strings: %w", err)
+	}
+	out := make([]string, len(sst.Items))
+	for i, item := range sst.Items {
+		out[i] = item.String()
+	}
+	return out, nil
+}
+
+type cell struct {
+	Ref    string   `xml:"r,attr"`
+	Type   string   `xml:"t,attr"`
+	Value  string   `xml:"v"`
+	Inline richText `xml:"is"`
+}
+
+// readSheet streams the sheet's rows so large files are not decoded into one tree
+func readSheet(f *zip.File, shared []string) ([][]string, error) {
+	rc, err := openPart(f)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var rows [][]string
+	cells := 0
+	dec := xml.NewDecoder(rc)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading worksheet: %w", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+
+		var row struct {
+			Num   int    `xml:"r,attr"`
+			Cells []cell `xml:"c"`
+		}
+		if err := dec.DecodeElement(&row, &start); err != nil {
+			return nil, fmt.Errorf("reading worksheet row: %w", err)
+		}
+
+		if row.Num > maxRows || len(rows) >= maxRows {
+			return nil, fmt.Errorf("worksheet has more than %d rows", maxRows)
+		}
+		// Sparse sheets skip empty rows; keep row numbers aligned with the file
+		for row.Num > len(rows)+1 {
+			rows = append(rows, nil)
+		}
+
+		var values []string
+		for i, c := range row.Cells {
+			col := i
+			if c.Ref != "" {
+				if col, err = columnIndex(c.Ref); err != nil {
+					return nil, err
+				}
+			}
+			if col >= maxColumns {
+				return nil, fmt.Errorf("row %d has more than %d columns", len(rows)+1, maxColumns)
+			}
+			if col >= len(values) {
+				if cells += col + 1 - len(values); cells > maxCells {
+					return nil, fmt.Errorf("worksheet has more than %d cells", maxCells)
+				}
+			}
+			for len(values) < col {
+				values = append(values, "")
+			}
+			v, err := c.value(shared)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values[:col], v)
+		}
+		rows = append(rows, values)
+	}
+}
+
+func (c cell) value(shared []string) (string, error) {
+	switch c.Type {
+	case "s":
+		idx, err := strconv.Atoi(c.Value)
+		if err != nil || idx < 0 || idx >= len(shared) {
+			return "", fmt.Errorf("cell %s: bad shared string index %q", c.Ref, c.Value)
+		}
+		return shared[idx], nil
+	case "inlineStr":
+		return c.Inline.String(), nil
+	case "b":
+		if c.Value == "1" {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	default:
+		return c.Value, nil
+	}
+}
+
+// columnIndex converts a cell reference such as "AB12" to a zero-based column
+func columnIndex(ref string) (int, error) {
+	col := 0
+	for _, ch := range ref {
+		if ch >= 'A' && ch <= 'Z' {
+			// Stop before the letters can overflow; no valid column gets this far
+			if col > maxColumns {
+				return 0, fmt.Errorf("cell reference %q is beyond column %d", ref, maxColumns)
+			}
+			col = col*26 + int(ch-'A'+1)
+			continue
+		}
+		break
+	}
+	if col == 0 {
+		return 0, fmt.Errorf("bad cell reference %q", ref)
+	}
+	if col > maxColumns {
+		return 0, fmt.Errorf("cell reference %q is beyond column %d", ref, maxColumns)
+	}
+	return col - 1, nil
+}
@@ -0,0 +1,148 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	testWorkbook = `<workbook xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="S" sheetId="1" r:id="rId1"/></sheets></workbook>`
+	testRels = `<Relationships><Relationship Id="rId1" Target="worksheets/sheet1.xml"/></Relationships>`
+)
+
+// workbook zips a workbook whose first sheet holds sheetData; parts overrides or
+// adds other parts, and an empty body drops the part
+func workbook(t *testing.T, sheetData string, parts map[string]string) []byte {
+	t.Helper()
+	all := map[string]string{
+		"xl/workbook.xml":            testWorkbook,
+		"xl/_rels/workbook.xml.rels": testRels,
+		"xl/worksheets/sheet1.xml":   `<worksheet><sheetData>` + sheetData + `</sheetData></worksheet>`,
+	}
+	for name, body := range parts {
+		all[name] = body
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range all {
+		if body == "" {
+			continue
+		}
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(body))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func readRows(data []byte) ([][]string, error) {
+	return ReadRows(bytes.NewReader(data), int64(len(data)))
+}
+
+func TestReadRows(t *testing.T) {
+	data := workbook(t, `<row r="1"><c r="A1" t="s"><v>0</v></c><c r="C1" t="inlineStr"><is><t>x</t></is></c></row>`+
+		`<row r="3"><c r="B3"><v>42</v></c><c r="D3" t="b"><v>1</v></c></row>`,
+		map[string]string{"xl/sharedStrings.xml": `<sst><si><r><t>ro</t></r><r><t>om</t></r></si></sst>`})
+
+	rows, err := readRows(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"room", "", "x"}, nil, {"", "42", "", "TRUE"}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %q, want %q", rows, want)
+	}
+}
+
+func TestReadRowsRejectsMalformedSheets(t *testing.T) {
+	tests := []struct {
+		name      string
+		sheetData string
+		parts     map[string]string
+		want      string
+	}{
+		{"no workbook", ``, map[string]string{"xl/workbook.xml": ""}, "reading workbook"},
+		{"no sheets", ``, map[string]string{"xl/workbook.xml": `<workbook><sheets/></workbook>`}, "no sheets"},
+		{"sheet missing", ``, map[string]string{"xl/worksheets/sheet1.xml": ""}, "missing"},
+		{"broken XML", `<row r="1"><c r="A1"><v>1</row>`, nil, "reading worksheet"},
+		{"bad shared string", `<row r="1"><c r="A1" t="s"><v>3</v></c></row>`, nil, "bad shared string index"},
+		{"bad reference", `<row r="1"><c r="11"><v>1</v></c></row>`, nil, "bad cell reference"},
+		{"row past the limit", `<row r="1048577"><c r="A1048577"><v>1</v></c></row>`, nil, "more than 1048576 rows"},
+		{"column past the limit", `<row r="1"><c r="XFE1"><v>1</v></c></row>`, nil, "beyond column 16384"},
+		{"column that overflows int", `<row r="1"><c r="` + strings.Repeat("Z", 40) + `1"><v>1</v></c></row>`, nil, "beyond column 16384"},
+		{"unreferenced cells past the limit", `<row r="1">` + strings.Repeat(`<c><v>1</v></c>`, maxColumns+1) + `</row>`, nil, "more than 16384 columns"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readRows(workbook(t, tt.sheetData, tt.parts))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := readRows([]byte("room_number,capacity\n")); err == nil || !strings.Contains(err.Error(), "not an xlsx file") {
+		t.Errorf("CSV read as xlsx: err = %v", err)
+	}
+}
+
+func TestReadRowsRejectsOversizedSheets(t *testing.T) {
+	defer func(size int64, cells int) { maxPartSize, maxCells = size, cells }(maxPartSize, maxCells)
+	maxPartSize, maxCells = 64<<10, 1000
+
+	// Whitespace compresses to almost nothing but still has to be inflated
+	padding := strings.Repeat(" ", int(maxPartSize))
+	if _, err := readRows(workbook(t, `<row r="1"><c r="A1"><v>1</v></c></row>`+padding, nil)); err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Errorf("inflated sheet: err = %v", err)
+	}
+	if _, err := readRows(workbook(t, ``, map[string]string{"xl/sharedStrings.xml": `<sst>` + padding + `</sst>`})); err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Errorf("inflated shared strings: err = %v", err)
+	}
+
+	// A zip bomb understates its size in the header; it must still fail rather than
+	// inflate the whole part
+	var deflated bytes.Buffer
+	fw, _ := flate.NewWriter(&deflated, flate.BestCompression)
+	fw.Write([]byte(`<worksheet><sheetData><row r="1"><c r="A1"><v>1</v></c></row>` + padding + `</sheetData></worksheet>`))
+	fw.Close()
+	var bomb bytes.Buffer
+	zw := zip.NewWriter(&bomb)
+	for name, body := range map[string]string{"xl/workbook.xml": testWorkbook, "xl/_rels/workbook.xml.rels": testRels} {
+		f, _ := zw.Create(name)
+		f.Write([]byte(body))
+	}
+	f, err := zw.CreateRaw(&zip.FileHeader{
+		Name:               "xl/worksheets/sheet1.xml",
+		Method:             zip.Deflate,
+		CompressedSize64:   uint64(deflated.Len()),
+		UncompressedSize64: 100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(deflated.Bytes())
+	zw.Close()
+	if _, err := readRows(bomb.Bytes()); err == nil {
+		t.Errorf("understated sheet size: err = %v", err)
+	}
+
+	// A handful of far-right cells would otherwise be padded into a huge grid
+	var sparse strings.Builder
+	for r := 1; r <= 3; r++ {
+		sparse.WriteString(`<row><c r="ZZ1"><v>1</v></c></row>`)
+	}
+	if _, err := readRows(workbook(t, sparse.String(), nil)); err == nil || !strings.Contains(err.Error(), "more than 1000 cells") {
+		t.Errorf("padded cells: err = %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package xlsx
+
+import (
+	"bytes"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestWriterRoundTrip(t *testing.T) {
+	joined := time.Date(2026, 3, 1, 9, 30, 0, 0, time.UTC)
+	wide := make([]any, 30)
+	for i := range wide {
+		wide[i] = i
+	}
+	rows := [][]any{
+		{"id", "name", "price", "joined", "left"},
+		{1, "Asha & <Ravi>", 5000.5, joined, (*time.Time)(nil)},
+		{int64(2), "  padded  ", 0.1, &joined, nil, "after a gap"},
+		{},
+		wide,
+	}
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, `Rooms & "Guests"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if err := w.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readRows(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wideText := make([]string, 30)
+	for i := range wideText {
+		wideText[i] = strconv.Itoa(i)
+	}
+	want := [][]string{
+		{"id", "name", "price", "joined", "left"},
+		{"1", "Asha & <Ravi>", "5000.5", "2026-03-01T09:30:00Z", ""},
+		{"2", "  padded  ", "0.1", "2026-03-01T09:30:00Z", "", "after a gap"},
+		nil,
+		wideText,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %q\nwant %q", got, want)
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA", maxColumns - 1: "XFD"} {
+		if got := columnName(i); got != want {
+			t.Errorf("columnName(%d) = %s, want %s", i, got, want)
+		}
+		if back, err := columnIndex(want + "1"); err != nil || back != i {
+			t.Errorf("columnIndex(%s1) = %d, %v, want %d", want, back, err, i)
+		}
+	}
+}
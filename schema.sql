@@ -4,18 +4,27 @@ CREATE TABLE IF NOT EXISTS rooms (
     room_number VARCHAR(50) NOT NULL,
     capacity INT NOT NULL,
     occupancy INT DEFAULT 0,
-    price DECIMAL(10, 2) NOT NULL
+    price DECIMAL(10, 2) NOT NULL,
+    deleted_at TIMESTAMP,
+    version INT NOT NULL DEFAULT 1
 );
 
 -- Create Guests Table
 CREATE TABLE IF NOT EXISTS guests (
     id SERIAL PRIMARY KEY,
     name VARCHAR(100) NOT NULL,
-    email VARCHAR(100) UNIQUE NOT NULL,
-    phone VARCHAR(20),
+    email TEXT NOT NULL,
+    phone TEXT,
+    email_bidx CHAR(64),
     room_id INT REFERENCES rooms(id),
-    join_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    join_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP,
+    -- set for past residents, who checked out rather than being deleted
+    left_at TIMESTAMP,
+    version INT NOT NULL DEFAULT 1
 );
+-- email and phone are encrypted by the application; uniqueness uses the blind index
+CREATE UNIQUE INDEX IF NOT EXISTS guests_email_key ON guests (email_bidx);
 
 -- Create Payments Table
 CREATE TABLE IF NOT EXISTS payments (
@@ -23,7 +32,9 @@ CREATE TABLE IF NOT EXISTS payments (
     guest_id INT REFERENCES guests(id),
     amount DECIMAL(10, 2) NOT NULL,
     payment_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    payment_method VARCHAR(50)
+    payment_method VARCHAR(50),
+    deleted_at TIMESTAMP,
+    version INT NOT NULL DEFAULT 1
 );
 
 -- Create Users Table
@@ -35,3 +46,52 @@ CREATE TABLE IF NOT EXISTS users (
     role VARCHAR(20) DEFAULT 'user',
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
+
+-- Create Audit Log Table
+CREATE TABLE IF NOT EXISTS audit_log (
+    id SERIAL PRIMARY KEY,
+    actor_id INT,
+    actor_email VARCHAR(100) NOT NULL DEFAULT '',
+    action VARCHAR(20) NOT NULL,
+    entity VARCHAR(50) NOT NULL,
+    entity_id INT NOT NULL,
+    before JSONB,
+    after JSONB,
+    ip VARCHAR(64) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS audit_log_entity_idx ON audit_log (entity, entity_id);
+CREATE INDEX IF NOT EXISTS audit_log_created_at_idx ON audit_log (created_at);
+
+-- Create Persisted Queries Table
+CREATE TABLE IF NOT EXISTS persisted_queries (
+    hash CHAR(64) PRIMARY KEY,
+    query TEXT NOT NULL,
+    operation_name VARCHAR(200) NOT NULL DEFAULT '',
+    allowlisted BOOLEAN NOT NULL DEFAULT FALSE,
+    registered_by INT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS persisted_queries_registered_by_idx ON persisted_queries (registered_by) WHERE NOT allowlisted;
+
+-- Create Guest Documents Table (files live in the blob store under storage_key)
+CREATE TABLE IF NOT EXISTS guest_documents (
+    id SERIAL PRIMARY KEY,
+    guest_id INT NOT NULL REFERENCES guests(id),
+    doc_type VARCHAR(30) NOT NULL,
+    doc_number TEXT NOT NULL DEFAULT '',
+    filename VARCHAR(255) NOT NULL DEFAULT '',
+    content_type VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL,
+    storage_key VARCHAR(200) NOT NULL UNIQUE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'verified', 'rejected')),
+    rejection_reason TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMP,
+    uploaded_by VARCHAR(100) NOT NULL DEFAULT '',
+    reviewed_by VARCHAR(100) NOT NULL DEFAULT '',
+    reviewed_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    version INT NOT NULL DEFAULT 1
+);
+CREATE INDEX IF NOT EXISTS guest_documents_guest_id_idx ON guest_documents (guest_id);
+CREATE INDEX IF NOT EXISTS guest_documents_expires_at_idx ON guest_documents (expires_at) WHERE expires_at IS NOT NULL;